@@ -6,4 +6,29 @@ const (
 	RoleSuperAdmin Role = "super_admin"
 	RoleAdmin      Role = "admin"
 	RoleUser       Role = "user"
-)
\ No newline at end of file
+)
+
+// roleLevels orders roles by privilege: super_admin > admin > user
+var roleLevels = map[Role]int{
+	RoleUser:       1,
+	RoleAdmin:      2,
+	RoleSuperAdmin: 3,
+}
+
+// Level returns the privilege level of the role. Unknown roles have level 0.
+func (r Role) Level() int {
+	return roleLevels[r]
+}
+
+// AtLeast reports whether r grants every privilege of other
+func (r Role) AtLeast(other Role) bool {
+	return r.Level() > 0 && r.Level() >= other.Level()
+}
+
+// IsValid reports whether r is a known role
+func (r Role) IsValid() bool {
+	return r.Level() > 0
+}
+
+// ClaimsContextKey is the gin.Context key under which RequireAuth stores the caller's *utils.JWTClaims
+const ClaimsContextKey = "auth_claims"
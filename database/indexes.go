@@ -0,0 +1,279 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"lem-be/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// IndexSpec declares an index the application relies on
+type IndexSpec struct {
+	Collection    string
+	Keys          bson.D
+	Unique        bool
+	TTL           bool   // Documents are removed once the time in the (single) key field has passed
+	PartialFilter bson.D // Only documents matching the filter are indexed
+}
+
+// Name returns the index name MongoDB would generate for the keys, e.g. "provider_1_provider_id_1"
+func (spec IndexSpec) Name() string {
+	parts := make([]string, 0, len(spec.Keys))
+	for _, key := range spec.Keys {
+		parts = append(parts, fmt.Sprintf("%s_%v", key.Key, key.Value))
+	}
+	return strings.Join(parts, "_")
+}
+
+func (spec IndexSpec) model() mongo.IndexModel {
+	opts := options.Index().SetName(spec.Name())
+	if spec.Unique {
+		opts.SetUnique(true)
+	}
+	if spec.TTL {
+		opts.SetExpireAfterSeconds(0)
+	}
+	if spec.PartialFilter != nil {
+		opts.SetPartialFilterExpression(spec.PartialFilter)
+	}
+	return mongo.IndexModel{Keys: spec.Keys, Options: opts}
+}
+
+// ttl is the expiry index shared by every collection holding short-lived records
+func ttl(collection string) IndexSpec {
+	return IndexSpec{Collection: collection, Keys: bson.D{{Key: "expires_at", Value: 1}}, TTL: true}
+}
+
+// Indexes is the declared index set. Local users have no provider_id and users without
+// linked identities or passkeys have no such arrays, so those unique indexes are partial.
+var Indexes = []IndexSpec{
+	{Collection: "users", Keys: bson.D{{Key: "email", Value: 1}}, Unique: true},
+	{
+		Collection:    "users",
+		Keys:          bson.D{{Key: "provider", Value: 1}, {Key: "provider_id", Value: 1}},
+		Unique:        true,
+		PartialFilter: bson.D{{Key: "provider_id", Value: bson.D{{Key: "$gt", Value: ""}}}},
+	},
+	{
+		Collection:    "users",
+		Keys:          bson.D{{Key: "identities.provider", Value: 1}, {Key: "identities.provider_id", Value: 1}},
+		Unique:        true,
+		PartialFilter: bson.D{{Key: "identities.provider_id", Value: bson.D{{Key: "$exists", Value: true}}}},
+	},
+	{
+		Collection:    "users",
+		Keys:          bson.D{{Key: "webauthn_credentials.id", Value: 1}},
+		Unique:        true,
+		PartialFilter: bson.D{{Key: "webauthn_credentials.id", Value: bson.D{{Key: "$exists", Value: true}}}},
+	},
+
+	{Collection: "otps", Keys: bson.D{{Key: "email", Value: 1}, {Key: "purpose", Value: 1}}, Unique: true},
+	ttl("otps"),
+
+	{Collection: "refresh_tokens", Keys: bson.D{{Key: "jti", Value: 1}}, Unique: true},
+	{Collection: "refresh_tokens", Keys: bson.D{{Key: "family_id", Value: 1}}},
+	{Collection: "refresh_tokens", Keys: bson.D{{Key: "user_id", Value: 1}}},
+	ttl("refresh_tokens"),
+
+	{Collection: "revoked_tokens", Keys: bson.D{{Key: "jti", Value: 1}}, Unique: true},
+	ttl("revoked_tokens"),
+
+	{Collection: "user_revocations", Keys: bson.D{{Key: "user_id", Value: 1}}, Unique: true},
+	ttl("user_revocations"),
+
+	{Collection: "failed_attempts", Keys: bson.D{{Key: "key", Value: 1}}, Unique: true},
+	ttl("failed_attempts"),
+
+	{Collection: "webauthn_sessions", Keys: bson.D{{Key: "session_id", Value: 1}}, Unique: true},
+	ttl("webauthn_sessions"),
+
+	{Collection: "signing_keys", Keys: bson.D{{Key: "successor_of", Value: 1}}, Unique: true},
+}
+
+// IndexDrift describes a difference between the declared and the actual indexes
+type IndexDrift struct {
+	Collection string
+	Index      string
+	Problem    string // "missing", "missing, not created: duplicate values ...", "options differ: ..." or "undeclared"
+}
+
+func (d IndexDrift) String() string {
+	return fmt.Sprintf("%s.%s: %s", d.Collection, d.Index, d.Problem)
+}
+
+// actualIndex is the subset of listIndexes output that is compared against IndexSpec
+type actualIndex struct {
+	Name                    string   `bson:"name"`
+	Unique                  bool     `bson:"unique"`
+	ExpireAfterSeconds      *int64   `bson:"expireAfterSeconds"`
+	PartialFilterExpression bson.Raw `bson:"partialFilterExpression"`
+}
+
+// CheckIndexes compares the declared indexes with the ones present in db
+func CheckIndexes(ctx context.Context, db *mongo.Database) ([]IndexDrift, error) {
+	declared := map[string]map[string]IndexSpec{}
+	for _, spec := range Indexes {
+		if declared[spec.Collection] == nil {
+			declared[spec.Collection] = map[string]IndexSpec{}
+		}
+		declared[spec.Collection][spec.Name()] = spec
+	}
+
+	var drift []IndexDrift
+	for collection, specs := range declared {
+		cursor, err := db.Collection(collection).Indexes().List(ctx)
+		if err != nil {
+			return nil, err
+		}
+		var actual []actualIndex
+		if err := cursor.All(ctx, &actual); err != nil {
+			return nil, err
+		}
+
+		found := map[string]bool{}
+		for _, index := range actual {
+			if index.Name == "_id_" {
+				continue
+			}
+			spec, ok := specs[index.Name]
+			if !ok {
+				drift = append(drift, IndexDrift{Collection: collection, Index: index.Name, Problem: "undeclared"})
+				continue
+			}
+			found[index.Name] = true
+			if problem := compareIndex(spec, index); problem != "" {
+				drift = append(drift, IndexDrift{Collection: collection, Index: index.Name, Problem: "options differ: " + problem})
+			}
+		}
+		for name := range specs {
+			if !found[name] {
+				drift = append(drift, IndexDrift{Collection: collection, Index: name, Problem: "missing"})
+			}
+		}
+	}
+	return drift, nil
+}
+
+func compareIndex(spec IndexSpec, actual actualIndex) string {
+	var problems []string
+	if spec.Unique != actual.Unique {
+		problems = append(problems, fmt.Sprintf("unique is %t, declared %t", actual.Unique, spec.Unique))
+	}
+	if isTTL := actual.ExpireAfterSeconds != nil; isTTL != spec.TTL {
+		problems = append(problems, fmt.Sprintf("TTL is %t, declared %t", isTTL, spec.TTL))
+	} else if isTTL && *actual.ExpireAfterSeconds != 0 {
+		problems = append(problems, fmt.Sprintf("expireAfterSeconds is %d, declared 0", *actual.ExpireAfterSeconds))
+	}
+	declaredFilter := ""
+	if spec.PartialFilter != nil {
+		raw, err := bson.Marshal(spec.PartialFilter)
+		if err == nil {
+			declaredFilter = bson.Raw(raw).String()
+		}
+	}
+	actualFilter := ""
+	if actual.PartialFilterExpression != nil {
+		actualFilter = actual.PartialFilterExpression.String()
+	}
+	if declaredFilter != actualFilter {
+		problems = append(problems, fmt.Sprintf("partial filter is %q, declared %q", actualFilter, declaredFilter))
+	}
+	return strings.Join(problems, "; ")
+}
+
+// EnsureIndexes creates missing declared indexes and logs any drift it cannot fix.
+// Indexes whose options differ are left alone; changing them needs a migration. A unique index
+// whose collection already holds duplicates is not created either; the duplicates are reported instead.
+func EnsureIndexes(db *mongo.Database) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	log := utils.NewLogger("Database", "EnsureIndexes").WithContext(ctx)
+	drift, err := CheckIndexes(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	missing := map[string]bool{}
+	for _, d := range drift {
+		if d.Problem == "missing" {
+			missing[d.Collection+"."+d.Index] = true
+		} else {
+			log.Warnf("Index drift on %s", d)
+		}
+	}
+
+	for _, spec := range Indexes {
+		if !missing[spec.Collection+"."+spec.Name()] {
+			continue
+		}
+		if spec.Unique {
+			duplicates, err := findDuplicates(ctx, db, spec)
+			if err != nil {
+				return fmt.Errorf("check index %s.%s for duplicates: %w", spec.Collection, spec.Name(), err)
+			}
+			if len(duplicates) > 0 {
+				d := IndexDrift{Collection: spec.Collection, Index: spec.Name(), Problem: "missing, not created: duplicate values " + strings.Join(duplicates, ", ")}
+				log.Warnf("Index drift on %s", d)
+				continue
+			}
+		}
+		if _, err := db.Collection(spec.Collection).Indexes().CreateOne(ctx, spec.model()); err != nil {
+			return fmt.Errorf("create index %s.%s: %w", spec.Collection, spec.Name(), err)
+		}
+		log.Infof("Created index %s.%s", spec.Collection, spec.Name())
+	}
+	return nil
+}
+
+// maxReportedDuplicates caps how many duplicate values findDuplicates describes
+const maxReportedDuplicates = 20
+
+// findDuplicates describes the key values that more than one document of the collection shares,
+// with the ids of those documents, which would make creating the unique index fail
+func findDuplicates(ctx context.Context, db *mongo.Database, spec IndexSpec) ([]string, error) {
+	var pipeline mongo.Pipeline
+	if spec.PartialFilter != nil {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: spec.PartialFilter}})
+	}
+	// Keys inside arrays index every element, so each element is compared on its own
+	unwound := map[string]bool{}
+	group := bson.D{}
+	for _, key := range spec.Keys {
+		if prefix, _, nested := strings.Cut(key.Key, "."); nested && !unwound[prefix] {
+			unwound[prefix] = true
+			pipeline = append(pipeline, bson.D{{Key: "$unwind", Value: bson.M{"path": "$" + prefix, "preserveNullAndEmptyArrays": true}}})
+		}
+		group = append(group, bson.E{Key: strings.ReplaceAll(key.Key, ".", "_"), Value: "$" + key.Key})
+	}
+	pipeline = append(pipeline,
+		bson.D{{Key: "$group", Value: bson.M{"_id": group, "ids": bson.M{"$addToSet": "$_id"}}}},
+		// One document may repeat a value in its own array; only values shared by documents conflict
+		bson.D{{Key: "$match", Value: bson.M{"ids.1": bson.M{"$exists": true}}}},
+		bson.D{{Key: "$limit", Value: maxReportedDuplicates}},
+	)
+
+	cursor, err := db.Collection(spec.Collection).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var groups []struct {
+		Value bson.Raw `bson:"_id"`
+		IDs   []any    `bson:"ids"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+
+	duplicates := make([]string, 0, len(groups))
+	for _, g := range groups {
+		duplicates = append(duplicates, fmt.Sprintf("%s in %v", g.Value, g.IDs))
+	}
+	return duplicates, nil
+}
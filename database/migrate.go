@@ -0,0 +1,300 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"lem-be/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrMigrationLocked       = errors.New("another instance holds the migration lock")
+	ErrIrreversibleMigration = errors.New("migration cannot be rolled back")
+)
+
+// migrationLockTTL bounds how long a crashed instance can block migrations. The holder renews the
+// lock every migrationLockRenewInterval, so migrations may run longer than this.
+const (
+	migrationLockTTL           = 2 * time.Minute
+	migrationLockRenewInterval = migrationLockTTL / 4
+)
+
+// Migration is one ordered schema change. Down is nil when the change cannot be undone.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context, db *mongo.Database) error
+	Down        func(ctx context.Context, db *mongo.Database) error
+}
+
+// MigrationRecord is stored in schema_migrations for every applied migration
+type MigrationRecord struct {
+	Version     int       `bson:"_id"`
+	Description string    `bson:"description"`
+	AppliedAt   time.Time `bson:"applied_at"`
+}
+
+// MigrationStatus reports whether a known migration has been applied
+type MigrationStatus struct {
+	Version     int
+	Description string
+	Reversible  bool
+	AppliedAt   *time.Time
+}
+
+// migrationLock is the single document in migration_lock while an instance migrates
+type migrationLock struct {
+	ID        string    `bson:"_id"`
+	Owner     string    `bson:"owner"`
+	LockedAt  time.Time `bson:"locked_at"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+// sortedMigrations returns the registered migrations in version order
+func sortedMigrations() []Migration {
+	sorted := append([]Migration(nil), migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	return sorted
+}
+
+// MigrationStatuses lists every registered migration with its applied time, if any
+func MigrationStatuses(ctx context.Context, db *mongo.Database) ([]MigrationStatus, error) {
+	applied, err := appliedMigrations(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []MigrationStatus
+	for _, migration := range sortedMigrations() {
+		status := MigrationStatus{
+			Version:     migration.Version,
+			Description: migration.Description,
+			Reversible:  migration.Down != nil,
+		}
+		if record, ok := applied[migration.Version]; ok {
+			status.AppliedAt = &record.AppliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// MigrateUp applies pending migrations up to and including target (0 applies all).
+// It returns the versions it applied.
+func MigrateUp(ctx context.Context, db *mongo.Database, target int) ([]int, error) {
+	ctx, release, err := acquireMigrationLock(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	log := utils.NewLogger("Database", "MigrateUp").WithContext(ctx)
+	applied, err := appliedMigrations(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []int
+	for _, migration := range sortedMigrations() {
+		if target > 0 && migration.Version > target {
+			break
+		}
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		log.Infof("Applying migration %d: %s", migration.Version, migration.Description)
+		if err := migration.Up(ctx, db); err != nil {
+			return done, fmt.Errorf("migration %d failed: %w", migration.Version, err)
+		}
+		if _, err := db.Collection("schema_migrations").InsertOne(ctx, MigrationRecord{
+			Version:     migration.Version,
+			Description: migration.Description,
+			AppliedAt:   time.Now(),
+		}); err != nil {
+			return done, fmt.Errorf("record migration %d: %w", migration.Version, err)
+		}
+		done = append(done, migration.Version)
+	}
+	return done, nil
+}
+
+// MigrateDown rolls back the most recently applied migrations, newest first
+func MigrateDown(ctx context.Context, db *mongo.Database, steps int) ([]int, error) {
+	ctx, release, err := acquireMigrationLock(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	log := utils.NewLogger("Database", "MigrateDown").WithContext(ctx)
+	applied, err := appliedMigrations(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	sorted := sortedMigrations()
+	var done []int
+	for i := len(sorted) - 1; i >= 0 && len(done) < steps; i-- {
+		migration := sorted[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		if migration.Down == nil {
+			return done, fmt.Errorf("migration %d: %w", migration.Version, ErrIrreversibleMigration)
+		}
+
+		log.Infof("Rolling back migration %d: %s", migration.Version, migration.Description)
+		if err := migration.Down(ctx, db); err != nil {
+			return done, fmt.Errorf("rollback of migration %d failed: %w", migration.Version, err)
+		}
+		if _, err := db.Collection("schema_migrations").DeleteOne(ctx, bson.M{"_id": migration.Version}); err != nil {
+			return done, fmt.Errorf("unrecord migration %d: %w", migration.Version, err)
+		}
+		done = append(done, migration.Version)
+	}
+	return done, nil
+}
+
+// RunMigrations applies pending migrations at startup. Replicas starting together wait for
+// whichever one holds the lock instead of migrating concurrently.
+func RunMigrations(db *mongo.Database) error {
+	ctx, cancel := context.WithTimeout(context.Background(), utils.GetEnvDuration("MIGRATION_TIMEOUT", 10*time.Minute))
+	defer cancel()
+
+	log := utils.NewLogger("Database", "RunMigrations").WithContext(ctx)
+	for {
+		applied, err := MigrateUp(ctx, db, 0)
+		if err == nil {
+			if len(applied) > 0 {
+				log.Infof("Applied migrations %v", applied)
+			}
+			return nil
+		}
+		if !errors.Is(err, ErrMigrationLocked) {
+			return err
+		}
+
+		log.Info("Waiting for another instance to finish migrating")
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for the migration lock: %w", ctx.Err())
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+func appliedMigrations(ctx context.Context, db *mongo.Database) (map[int]MigrationRecord, error) {
+	cursor, err := db.Collection("schema_migrations").Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	var records []MigrationRecord
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]MigrationRecord, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+// acquireMigrationLock takes the lock document, or an expired one left by a crashed instance, and
+// renews it until the returned function releases it. The returned context is cancelled if the lock is lost.
+func acquireMigrationLock(ctx context.Context, db *mongo.Database) (context.Context, func(), error) {
+	locks := db.Collection("migration_lock")
+	owner, err := lockOwner()
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	lock := migrationLock{ID: "schema", Owner: owner, LockedAt: now, ExpiresAt: now.Add(migrationLockTTL)}
+
+	_, err = locks.InsertOne(ctx, lock)
+	if mongo.IsDuplicateKeyError(err) {
+		result := locks.FindOneAndReplace(ctx,
+			bson.M{"_id": lock.ID, "expires_at": bson.M{"$lt": now}},
+			lock,
+			options.FindOneAndReplace().SetReturnDocument(options.After),
+		)
+		err = result.Err()
+		if err == mongo.ErrNoDocuments {
+			return nil, nil, ErrMigrationLocked
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lockCtx, stopRenewing := context.WithCancel(ctx)
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		renewMigrationLock(lockCtx, locks, lock.ID, owner)
+		stopRenewing()
+	}()
+
+	return lockCtx, func() {
+		stopRenewing()
+		<-renewed
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if _, err := locks.DeleteOne(ctx, bson.M{"_id": lock.ID, "owner": owner}); err != nil {
+			utils.NewLogger("Database", "releaseMigrationLock").Errorf("Failed to release migration lock: %v", err)
+		}
+	}, nil
+}
+
+// renewMigrationLock extends the lock until ctx is done. It returns early if the lock was taken
+// over or cannot be renewed before it expires, so the caller can stop migrating.
+func renewMigrationLock(ctx context.Context, locks *mongo.Collection, id, owner string) {
+	log := utils.NewLogger("Database", "renewMigrationLock").WithContext(ctx)
+	ticker := time.NewTicker(migrationLockRenewInterval)
+	defer ticker.Stop()
+
+	expiresAt := time.Now().Add(migrationLockTTL)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		next := time.Now().Add(migrationLockTTL)
+		result, err := locks.UpdateOne(ctx, bson.M{"_id": id, "owner": owner}, bson.M{"$set": bson.M{"expires_at": next}})
+		switch {
+		case err == nil && result.MatchedCount == 0:
+			log.Error("Migration lock was taken over by another instance")
+			return
+		case err == nil:
+			expiresAt = next
+		case ctx.Err() != nil:
+			return
+		case time.Until(expiresAt) < migrationLockRenewInterval:
+			log.Errorf("Failed to renew migration lock before it expires: %v", err)
+			return
+		default:
+			log.Warnf("Failed to renew migration lock, retrying: %v", err)
+		}
+	}
+}
+
+func lockOwner() (string, error) {
+	hostname, _ := os.Hostname()
+	id, err := utils.GenerateRandomID()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/%d/%s", hostname, os.Getpid(), id), nil
+}
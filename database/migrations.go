@@ -0,0 +1,141 @@
+package database
+
+import (
+	"context"
+
+	"lem-be/constants"
+	"lem-be/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// migrations is the ordered schema history. Never renumber or edit an applied migration; add a new one.
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "purge OTP records stored before codes were hashed",
+		// Affected users simply request a new code
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			result, err := db.Collection("otps").DeleteMany(ctx, bson.M{"code": bson.M{"$exists": true}})
+			if err != nil {
+				return err
+			}
+			utils.NewLogger("Migration", "PurgePlaintextOTPs").WithContext(ctx).Infof("Deleted %d plaintext OTP records", result.DeletedCount)
+			return nil
+		},
+	},
+	{
+		Version:     2,
+		Description: "mark password users as local and bootstrapped superusers as verified",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			users := db.Collection("users")
+			if _, err := users.UpdateMany(ctx,
+				bson.M{"password": bson.M{"$gt": ""}, "provider": bson.M{"$in": bson.A{nil, ""}}},
+				bson.M{"$set": bson.M{"provider": "local"}},
+			); err != nil {
+				return err
+			}
+			_, err := users.UpdateMany(ctx,
+				bson.M{"role": constants.RoleSuperAdmin, "email_verified": bson.M{"$ne": true}},
+				bson.M{"$set": bson.M{"email_verified": true}},
+			)
+			return err
+		},
+	},
+	{
+		Version:     3,
+		Description: "copy provider/provider_id of social users into identities",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("users").UpdateMany(ctx,
+				bson.M{
+					"provider":    bson.M{"$nin": bson.A{nil, "", "local"}},
+					"provider_id": bson.M{"$gt": ""},
+					// Skip users who already have an identity for their sign-up provider
+					"$expr": bson.M{"$not": bson.A{bson.M{"$in": bson.A{
+						"$provider",
+						bson.M{"$ifNull": bson.A{"$identities.provider", bson.A{}}},
+					}}}},
+				},
+				mongo.Pipeline{{{Key: "$set", Value: bson.M{
+					"identities": bson.M{"$concatArrays": bson.A{
+						bson.M{"$ifNull": bson.A{"$identities", bson.A{}}},
+						bson.A{bson.M{
+							"provider":    "$provider",
+							"provider_id": "$provider_id",
+							"email":       "$email",
+							"linked_at":   "$created_at",
+						}},
+					}},
+				}}}},
+			)
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("users").UpdateMany(ctx,
+				bson.M{"provider_id": bson.M{"$gt": ""}, "identities": bson.M{"$exists": true}},
+				mongo.Pipeline{{{Key: "$set", Value: bson.M{
+					"identities": bson.M{"$filter": bson.M{
+						"input": "$identities",
+						"cond": bson.M{"$not": bson.A{bson.M{"$and": bson.A{
+							bson.M{"$eq": bson.A{"$$this.provider", "$provider"}},
+							bson.M{"$eq": bson.A{"$$this.provider_id", "$provider_id"}},
+						}}}},
+					}},
+				}}}},
+			)
+			return err
+		},
+	},
+	{
+		Version:     4,
+		Description: "store user emails trimmed and in lower case",
+		// Accounts whose emails differ only in case cannot all keep theirs; they are logged and left for an admin.
+		// Collisions are found up front because the unique email index may not exist yet.
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			log := utils.NewLogger("Migration", "NormalizeEmails").WithContext(ctx)
+			users := db.Collection("users")
+			cursor, err := users.Find(ctx,
+				bson.M{"email": bson.M{"$type": "string"}},
+				options.Find().SetProjection(bson.M{"email": 1}),
+			)
+			if err != nil {
+				return err
+			}
+			type record struct {
+				ID    any    `bson:"_id"`
+				Email string `bson:"email"`
+			}
+			var records []record
+			if err := cursor.All(ctx, &records); err != nil {
+				return err
+			}
+
+			// Group by the normalized form the same way utils.NormalizeEmail computes it
+			groups := map[string][]record{}
+			for _, r := range records {
+				email := utils.NormalizeEmail(r.Email)
+				groups[email] = append(groups[email], r)
+			}
+
+			for email, group := range groups {
+				if len(group) > 1 {
+					ids := make([]any, len(group))
+					for i, r := range group {
+						ids[i] = r.ID
+					}
+					log.Warnf("Left %d accounts unchanged: their emails all normalize to %s (ids %v)", len(group), email, ids)
+					continue
+				}
+				if group[0].Email == email {
+					continue
+				}
+				if _, err := users.UpdateOne(ctx, bson.M{"_id": group[0].ID}, bson.M{"$set": bson.M{"email": email}}); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"lem-be/models"
+	"lem-be/services"
+	"lem-be/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AccountHandler interface {
+	HandleRequestEmailChange(c *gin.Context)
+	HandleConfirmEmailChange(c *gin.Context)
+	HandleDeleteAccount(c *gin.Context)
+}
+
+type accountHandler struct {
+	accountService services.AccountService
+}
+
+func NewAccountHandler(accountService services.AccountService) AccountHandler {
+	return &accountHandler{accountService: accountService}
+}
+
+// HandleRequestEmailChange sends a confirmation code to the new email address
+func (h *accountHandler) HandleRequestEmailChange(c *gin.Context) {
+	var req models.ChangeEmailRequest
+	log := utils.NewLogger("AccountHandler", "HandleRequestEmailChange").WithContext(c.Request.Context())
+	claims := currentClaims(c)
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Warnf("Invalid request body: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	if err := h.accountService.RequestEmailChange(c.Request.Context(), claims.UserID, req); err != nil {
+		respondAccountError(c, err, "Failed to start email change")
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "Check the new inbox for a confirmation code."})
+}
+
+// HandleConfirmEmailChange switches the account to the new email address
+func (h *accountHandler) HandleConfirmEmailChange(c *gin.Context) {
+	var req models.ConfirmEmailChangeRequest
+	log := utils.NewLogger("AccountHandler", "HandleConfirmEmailChange").WithContext(c.Request.Context())
+	claims := currentClaims(c)
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Warnf("Invalid request body: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	user, err := h.accountService.ConfirmEmailChange(c.Request.Context(), claims.UserID, req)
+	if err != nil {
+		respondAccountError(c, err, "Failed to change email")
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// HandleDeleteAccount deletes the authenticated user's account
+func (h *accountHandler) HandleDeleteAccount(c *gin.Context) {
+	claims := currentClaims(c)
+
+	if err := h.accountService.DeleteAccount(c.Request.Context(), claims.UserID); err != nil {
+		respondAccountError(c, err, "Failed to delete account")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Account deleted"})
+}
+
+// respondAccountError maps account service errors to HTTP responses
+func respondAccountError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrEmailUnchanged):
+		c.JSON(http.StatusBadRequest, gin.H{"error": message, "details": err.Error()})
+	case errors.Is(err, services.ErrInvalidOTP):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired confirmation code"})
+	case errors.Is(err, services.ErrEmailAlreadyRegistered):
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
+	case errors.Is(err, services.ErrSuperAdminSelfDelete):
+		c.JSON(http.StatusForbidden, gin.H{"error": message, "details": err.Error()})
+	case errors.Is(err, services.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	default:
+		utils.NewLogger("AccountHandler", "respondAccountError").WithContext(c.Request.Context()).Errorf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message, "details": err.Error()})
+	}
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"lem-be/models"
+	"lem-be/services"
+	"lem-be/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AdminUserHandler interface {
+	HandleListUsers(c *gin.Context)
+	HandleGetUser(c *gin.Context)
+	HandleCreateUser(c *gin.Context)
+	HandleUpdateUserRole(c *gin.Context)
+	HandleDisableUser(c *gin.Context)
+	HandleEnableUser(c *gin.Context)
+	HandleDeleteUser(c *gin.Context)
+	HandleUnlockUser(c *gin.Context)
+}
+
+type adminUserHandler struct {
+	adminUserService services.AdminUserService
+}
+
+func NewAdminUserHandler(adminUserService services.AdminUserService) AdminUserHandler {
+	return &adminUserHandler{adminUserService: adminUserService}
+}
+
+// HandleListUsers lists users with pagination, filtering and sorting
+func (h *adminUserHandler) HandleListUsers(c *gin.Context) {
+	var query models.ListUsersQuery
+	log := utils.NewLogger("AdminUserHandler", "HandleListUsers").WithContext(c.Request.Context())
+
+	if err := c.ShouldBindQuery(&query); err != nil {
+		log.Warnf("Invalid query: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query", "details": err.Error()})
+		return
+	}
+
+	resp, err := h.adminUserService.ListUsers(c.Request.Context(), query)
+	if err != nil {
+		log.Errorf("Failed to list users: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list users", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// HandleGetUser returns a single user
+func (h *adminUserHandler) HandleGetUser(c *gin.Context) {
+	user, err := h.adminUserService.GetUser(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondAdminUserError(c, "HandleGetUser", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// HandleCreateUser provisions a new local account
+func (h *adminUserHandler) HandleCreateUser(c *gin.Context) {
+	var req models.CreateUserRequest
+	log := utils.NewLogger("AdminUserHandler", "HandleCreateUser").WithContext(c.Request.Context())
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Warnf("Invalid request body: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	user, err := h.adminUserService.CreateUser(c.Request.Context(), currentClaims(c), req)
+	if err != nil {
+		respondAdminUserError(c, "HandleCreateUser", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, user)
+}
+
+// HandleUpdateUserRole changes a user's role
+func (h *adminUserHandler) HandleUpdateUserRole(c *gin.Context) {
+	var req models.UpdateUserRoleRequest
+	log := utils.NewLogger("AdminUserHandler", "HandleUpdateUserRole").WithContext(c.Request.Context())
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Warnf("Invalid request body: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	user, err := h.adminUserService.UpdateRole(c.Request.Context(), currentClaims(c), c.Param("id"), req.Role)
+	if err != nil {
+		respondAdminUserError(c, "HandleUpdateUserRole", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// HandleDisableUser disables a user and ends their sessions
+func (h *adminUserHandler) HandleDisableUser(c *gin.Context) {
+	user, err := h.adminUserService.SetDisabled(c.Request.Context(), currentClaims(c), c.Param("id"), true)
+	if err != nil {
+		respondAdminUserError(c, "HandleDisableUser", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// HandleEnableUser re-enables a disabled user
+func (h *adminUserHandler) HandleEnableUser(c *gin.Context) {
+	user, err := h.adminUserService.SetDisabled(c.Request.Context(), currentClaims(c), c.Param("id"), false)
+	if err != nil {
+		respondAdminUserError(c, "HandleEnableUser", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// HandleDeleteUser deletes a user
+func (h *adminUserHandler) HandleDeleteUser(c *gin.Context) {
+	if err := h.adminUserService.DeleteUser(c.Request.Context(), currentClaims(c), c.Param("id")); err != nil {
+		respondAdminUserError(c, "HandleDeleteUser", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User deleted"})
+}
+
+// HandleUnlockUser lifts a login lockout
+func (h *adminUserHandler) HandleUnlockUser(c *gin.Context) {
+	if err := h.adminUserService.UnlockUser(c.Request.Context(), currentClaims(c), c.Param("id")); err != nil {
+		respondAdminUserError(c, "HandleUnlockUser", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User unlocked"})
+}
+
+// respondAdminUserError maps AdminUserService errors to HTTP responses
+func respondAdminUserError(c *gin.Context, method string, err error) {
+	log := utils.NewLogger("AdminUserHandler", method).WithContext(c.Request.Context())
+	if respondPasswordPolicyError(c, err) {
+		return
+	}
+
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	case errors.Is(err, services.ErrInsufficientPrivileges), errors.Is(err, services.ErrCannotModifySelf):
+		log.Warnf("Admin action denied: %v", err)
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions", "details": err.Error()})
+	case errors.Is(err, services.ErrEmailAlreadyRegistered):
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
+	default:
+		log.Errorf("Admin user operation failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Operation failed", "details": err.Error()})
+	}
+}
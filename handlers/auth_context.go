@@ -0,0 +1,14 @@
+package handlers
+
+import (
+	"lem-be/constants"
+	"lem-be/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// currentClaims returns the access token claims stored by the RequireAuth middleware
+func currentClaims(c *gin.Context) *utils.JWTClaims {
+	claims, _ := c.MustGet(constants.ClaimsContextKey).(*utils.JWTClaims)
+	return claims
+}
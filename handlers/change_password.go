@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"lem-be/models"
+	"lem-be/services"
+	"lem-be/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ChangePasswordHandler interface {
+	HandleChangePassword(c *gin.Context)
+}
+
+type changePasswordHandler struct {
+	changePasswordService services.ChangePasswordService
+}
+
+func NewChangePasswordHandler(changePasswordService services.ChangePasswordService) ChangePasswordHandler {
+	return &changePasswordHandler{changePasswordService: changePasswordService}
+}
+
+// HandleChangePassword changes the password of the authenticated user and returns a new token pair
+func (h *changePasswordHandler) HandleChangePassword(c *gin.Context) {
+	var req models.ChangePasswordRequest
+	log := utils.NewLogger("ChangePasswordHandler", "HandleChangePassword").WithContext(c.Request.Context())
+	claims := currentClaims(c)
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Warnf("Invalid request body: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	tokens, err := h.changePasswordService.ChangePassword(c.Request.Context(), claims.UserID, req)
+	if err != nil {
+		if respondPasswordPolicyError(c, err) {
+			return
+		}
+		var throttled *services.TooManyAttemptsError
+		switch {
+		case errors.As(err, &throttled):
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed attempts. Please try again later."})
+		case errors.Is(err, services.ErrInvalidPassword):
+			c.JSON(http.StatusForbidden, gin.H{"error": "Current password is incorrect"})
+		case errors.Is(err, services.ErrPasswordUnchanged), errors.Is(err, services.ErrNoPasswordSet):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Password change not allowed", "details": err.Error()})
+		case errors.Is(err, services.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		default:
+			log.Errorf("Password change failed for user %s: %v", claims.UserID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password", "details": err.Error()})
+		}
+		return
+	}
+
+	log.Infof("Password changed for user %s", claims.UserID)
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Password changed successfully. All other sessions have been signed out.",
+		"access_token":  tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+	})
+}
@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"lem-be/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type JWKSHandler interface {
+	HandleJWKS(c *gin.Context)
+}
+
+type jwksHandler struct{}
+
+func NewJWKSHandler() JWKSHandler {
+	return &jwksHandler{}
+}
+
+// HandleJWKS publishes the public keys other services use to verify our tokens
+func (h *jwksHandler) HandleJWKS(c *gin.Context) {
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(utils.JWKSCacheMaxAge.Seconds())))
+	c.JSON(http.StatusOK, utils.GetJWKS())
+}
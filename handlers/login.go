@@ -1,7 +1,10 @@
 package handlers
 
 import (
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
 
 	"lem-be/models"
 	"lem-be/services"
@@ -40,8 +43,19 @@ func (h LoginHandler) HandleLogin(c *gin.Context) {
 
 	log.Infof("Login attempt for email %s", req.Email)
 
-	resp, err := h.loginService.Login(c.Request.Context(), req)
+	resp, err := h.loginService.Login(c.Request.Context(), req, c.ClientIP())
 	if err != nil {
+		var throttled *services.TooManyAttemptsError
+		if errors.As(err, &throttled) {
+			log.Warnf("Login throttled for email %s: %v", req.Email, err)
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error": "Too many failed login attempts. Please try again later.",
+				"retry_after_seconds": int(math.Ceil(throttled.RetryAfter.Seconds())),
+			})
+			return
+		}
+
 		// Handle authentication errors with 401 Unauthorized
 		if err.Error() == "user not found" || err.Error() == "invalid password" {
 			log.Warnf("Authentication failed for email %s: %s", req.Email, err.Error())
@@ -50,6 +64,20 @@ func (h LoginHandler) HandleLogin(c *gin.Context) {
 			})
 			return
 		}
+		if errors.Is(err, services.ErrAccountDisabled) {
+			log.Warnf("Login refused for disabled account %s", req.Email)
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Account disabled",
+			})
+			return
+		}
+		if errors.Is(err, services.ErrEmailNotVerified) {
+			log.Warnf("Login refused for unverified email %s", req.Email)
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Email address not verified",
+			})
+			return
+		}
 		
 		// Handle other errors with 500 Internal Server Error
 		log.Errorf("Login failed for email %s: %v", req.Email, err)
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"lem-be/models"
+	"lem-be/services"
+	"lem-be/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MFAHandler interface {
+	HandleBeginTOTP(c *gin.Context)
+	HandleConfirmTOTP(c *gin.Context)
+	HandleDisableTOTP(c *gin.Context)
+	HandleVerify(c *gin.Context)
+}
+
+type mfaHandler struct {
+	mfaService services.MFAService
+}
+
+func NewMFAHandler(mfaService services.MFAService) MFAHandler {
+	return &mfaHandler{mfaService: mfaService}
+}
+
+// HandleBeginTOTP starts TOTP enrollment and returns the secret and otpauth:// URI for the authenticator app
+func (h *mfaHandler) HandleBeginTOTP(c *gin.Context) {
+	log := utils.NewLogger("MFAHandler", "HandleBeginTOTP").WithContext(c.Request.Context())
+	claims := currentClaims(c)
+
+	enrollment, err := h.mfaService.BeginTOTPEnrollment(c.Request.Context(), claims.UserID)
+	if err != nil {
+		log.Warnf("TOTP enrollment failed for user %s: %v", claims.UserID, err)
+		respondMFAError(c, err, "Failed to start two-factor enrollment")
+		return
+	}
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// HandleConfirmTOTP enables MFA with the first code and returns the recovery codes
+func (h *mfaHandler) HandleConfirmTOTP(c *gin.Context) {
+	var req models.ConfirmTOTPRequest
+	log := utils.NewLogger("MFAHandler", "HandleConfirmTOTP").WithContext(c.Request.Context())
+	claims := currentClaims(c)
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Warnf("Invalid request body: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	codes, err := h.mfaService.ConfirmTOTPEnrollment(c.Request.Context(), claims.UserID, req)
+	if err != nil {
+		log.Warnf("TOTP confirmation failed for user %s: %v", claims.UserID, err)
+		respondMFAError(c, err, "Failed to enable two-factor authentication")
+		return
+	}
+	c.JSON(http.StatusOK, codes)
+}
+
+// HandleDisableTOTP turns off MFA after checking a current TOTP or recovery code
+func (h *mfaHandler) HandleDisableTOTP(c *gin.Context) {
+	var req models.DisableTOTPRequest
+	log := utils.NewLogger("MFAHandler", "HandleDisableTOTP").WithContext(c.Request.Context())
+	claims := currentClaims(c)
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Warnf("Invalid request body: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	if err := h.mfaService.DisableTOTP(c.Request.Context(), claims.UserID, req); err != nil {
+		log.Warnf("Disabling MFA failed for user %s: %v", claims.UserID, err)
+		respondMFAError(c, err, "Failed to disable two-factor authentication")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// HandleVerify exchanges an MFA challenge token and a TOTP or recovery code for a token pair
+func (h *mfaHandler) HandleVerify(c *gin.Context) {
+	var req models.MFAVerifyRequest
+	log := utils.NewLogger("MFAHandler", "HandleVerify").WithContext(c.Request.Context())
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Warnf("Invalid request body: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	tokens, err := h.mfaService.Verify(c.Request.Context(), req)
+	if err != nil {
+		log.Warnf("MFA verification failed: %v", err)
+		respondMFAError(c, err, "Failed to verify second factor")
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// respondMFAError maps MFA service errors to HTTP responses
+func respondMFAError(c *gin.Context, err error, message string) {
+	var throttled *services.TooManyAttemptsError
+	switch {
+	case errors.As(err, &throttled):
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed attempts. Please try again later."})
+	case errors.Is(err, services.ErrInvalidMFACode), errors.Is(err, services.ErrInvalidMFAChallenge):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": message, "details": err.Error()})
+	case errors.Is(err, services.ErrAccountDisabled):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account disabled"})
+	case errors.Is(err, services.ErrMFAAlreadyEnabled), errors.Is(err, services.ErrMFANotEnabled), errors.Is(err, services.ErrMFAEnrollmentAbsent):
+		c.JSON(http.StatusConflict, gin.H{"error": message, "details": err.Error()})
+	case errors.Is(err, services.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	default:
+		utils.NewLogger("MFAHandler", "respondMFAError").WithContext(c.Request.Context()).Errorf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message, "details": err.Error()})
+	}
+}
@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+
+	"lem-be/models"
+	"lem-be/services"
+	"lem-be/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type OAuthHandler interface {
+	HandleLogin(c *gin.Context)
+	HandleCallback(c *gin.Context)
+	HandleListProviders(c *gin.Context)
+	HandleStartLink(c *gin.Context)
+	HandleUnlink(c *gin.Context)
+}
+
+type oauthHandler struct {
+	oauthService services.OAuthService
+}
+
+func NewOAuthHandler(oauthService services.OAuthService) OAuthHandler {
+	return &oauthHandler{oauthService: oauthService}
+}
+
+// oauthStateCookiePath scopes the state cookie to one provider's OAuth routes
+func oauthStateCookiePath(provider string) string {
+	return "/api/v1/auth/" + provider
+}
+
+// HandleLogin redirects the user to the :provider login page.
+// A random state is bound to the browser through a signed, short-lived cookie to prevent login CSRF.
+func (h *oauthHandler) HandleLogin(c *gin.Context) {
+	log := utils.NewLogger("OAuthHandler", "HandleLogin").WithContext(c.Request.Context())
+
+	provider, err := utils.GetOAuthProvider(c.Param("provider"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown login provider"})
+		return
+	}
+
+	redirectURI := c.Query("redirect_uri")
+	if redirectURI != "" && !utils.IsAllowedRedirectURI(redirectURI) {
+		log.Warnf("Rejected redirect_uri %q not in allowlist", redirectURI)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "redirect_uri is not allowed"})
+		return
+	}
+
+	authURL, err := beginOAuthFlow(c, provider, redirectURI, "")
+	if err != nil {
+		log.Errorf("Failed to start %s login: %v", provider.Name, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+
+	log.Infof("Redirecting to %s login", provider.Name)
+	c.Redirect(http.StatusTemporaryRedirect, authURL)
+}
+
+// HandleCallback handles the callback from :provider, resolves the account and issues a JWT
+func (h *oauthHandler) HandleCallback(c *gin.Context) {
+	log := utils.NewLogger("OAuthHandler", "HandleCallback").WithContext(c.Request.Context())
+
+	provider, err := utils.GetOAuthProvider(c.Param("provider"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown login provider"})
+		return
+	}
+
+	// Verify the state before touching the authorization code; the cookie is single-use
+	cookieValue, _ := c.Cookie(utils.OAuthStateCookie)
+	setStateCookie(c, provider.Name, "", -1)
+	state, err := utils.DecodeOAuthState(cookieValue, provider.Name, c.Query("state"))
+	if err != nil {
+		log.Warnf("OAuth state verification failed: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired OAuth state"})
+		return
+	}
+	if providerErr := c.Query("error"); providerErr != "" {
+		log.Warnf("%s returned error %q", provider.Name, providerErr)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login was not completed", "details": providerErr})
+		return
+	}
+
+	if state.LinkUserID != "" {
+		h.finishLink(c, provider, state)
+		return
+	}
+
+	user, tokens, err := h.oauthService.HandleCallback(c.Request.Context(), provider, c.Query("code"), state.CodeVerifier, state.Nonce)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrOAuthExchange), errors.Is(err, utils.ErrInvalidIDToken):
+			log.Warnf("%s authentication failed: %v", provider.Name, err)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed", "details": err.Error()})
+		case errors.Is(err, services.ErrProviderEmailUnverified):
+			c.JSON(http.StatusForbidden, gin.H{"error": "Provider account email is not verified"})
+		case errors.Is(err, services.ErrAccountDisabled):
+			c.JSON(http.StatusForbidden, gin.H{"error": "Account disabled"})
+		case errors.Is(err, services.ErrAccountLinkRequired):
+			c.JSON(http.StatusConflict, gin.H{"error": "Account link required", "details": err.Error()})
+		default:
+			log.Errorf("Failed to handle %s callback: %v", provider.Name, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to handle login callback", "details": err.Error()})
+		}
+		return
+	}
+
+	if tokens.MFARequired {
+		log.Infof("%s login for email %s awaits a second factor", provider.Name, user.Email)
+		if state.RedirectURI != "" {
+			fragment := url.Values{"mfa_required": {"true"}, "mfa_token": {tokens.MFAToken}}
+			c.Redirect(http.StatusFound, state.RedirectURI+"#"+fragment.Encode())
+			return
+		}
+		c.JSON(http.StatusOK, tokens)
+		return
+	}
+
+	log.Infof("%s login successful for email %s", provider.Name, user.Email)
+
+	// Hand the tokens to the allowlisted client in the URL fragment, which never reaches its server logs
+	if state.RedirectURI != "" {
+		fragment := url.Values{
+			"access_token":  {tokens.AccessToken},
+			"refresh_token": {tokens.RefreshToken},
+			"token_type":    {"Bearer"},
+		}
+		c.Redirect(http.StatusFound, state.RedirectURI+"#"+fragment.Encode())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Login successful",
+		"user": gin.H{
+			"email": user.Email,
+			"role":  user.Role,
+		},
+		"access_token":  tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+	})
+}
+
+// HandleListProviders returns the names of the enabled login providers
+func (h *oauthHandler) HandleListProviders(c *gin.Context) {
+	names := []string{}
+	for _, provider := range utils.OAuthProviders() {
+		names = append(names, provider.Name)
+	}
+	c.JSON(http.StatusOK, gin.H{"providers": names})
+}
+
+// HandleStartLink begins linking a provider account to the authenticated user.
+// The route requires a recent authentication; the response carries the provider URL the browser must open,
+// and the state cookie set alongside it routes the callback to the link flow.
+func (h *oauthHandler) HandleStartLink(c *gin.Context) {
+	var req models.LinkIdentityRequest
+	log := utils.NewLogger("OAuthHandler", "HandleStartLink").WithContext(c.Request.Context())
+	claims := currentClaims(c)
+
+	provider, err := utils.GetOAuthProvider(c.Param("provider"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown login provider"})
+		return
+	}
+	// The body is optional
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+			return
+		}
+	}
+	if req.RedirectURI != "" && !utils.IsAllowedRedirectURI(req.RedirectURI) {
+		log.Warnf("Rejected redirect_uri %q not in allowlist", req.RedirectURI)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "redirect_uri is not allowed"})
+		return
+	}
+
+	authURL, err := beginOAuthFlow(c, provider, req.RedirectURI, claims.UserID)
+	if err != nil {
+		log.Errorf("Failed to start %s link: %v", provider.Name, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start account linking"})
+		return
+	}
+	log.Infof("User %s started linking %s", claims.UserID, provider.Name)
+	c.JSON(http.StatusOK, gin.H{"authorization_url": authURL})
+}
+
+// HandleUnlink removes a linked provider account from the authenticated user
+func (h *oauthHandler) HandleUnlink(c *gin.Context) {
+	log := utils.NewLogger("OAuthHandler", "HandleUnlink").WithContext(c.Request.Context())
+	claims := currentClaims(c)
+
+	if err := h.oauthService.UnlinkIdentity(c.Request.Context(), claims.UserID, c.Param("provider")); err != nil {
+		respondIdentityError(c, err)
+		return
+	}
+	log.Infof("User %s unlinked %s", claims.UserID, c.Param("provider"))
+	c.JSON(http.StatusOK, gin.H{"message": "Identity unlinked"})
+}
+
+// finishLink completes a link flow started by HandleStartLink
+func (h *oauthHandler) finishLink(c *gin.Context, provider *utils.OAuthProvider, state *utils.OAuthState) {
+	log := utils.NewLogger("OAuthHandler", "finishLink").WithContext(c.Request.Context())
+
+	user, err := h.oauthService.LinkIdentity(c.Request.Context(), state.LinkUserID, provider, c.Query("code"), state.CodeVerifier, state.Nonce)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrOAuthExchange), errors.Is(err, utils.ErrInvalidIDToken):
+			log.Warnf("%s authentication failed: %v", provider.Name, err)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed", "details": err.Error()})
+		default:
+			respondIdentityError(c, err)
+		}
+		return
+	}
+
+	log.Infof("%s linked to %s", provider.Name, user.Email)
+	if state.RedirectURI != "" {
+		c.Redirect(http.StatusFound, state.RedirectURI+"#"+url.Values{"linked": {provider.Name}}.Encode())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Identity linked", "identities": user.Identities})
+}
+
+// respondIdentityError maps link/unlink errors to HTTP responses
+func respondIdentityError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrIdentityLinkedElsewhere), errors.Is(err, services.ErrProviderAlreadyLinked):
+		c.JSON(http.StatusConflict, gin.H{"error": "Identity cannot be linked", "details": err.Error()})
+	case errors.Is(err, services.ErrIdentityNotLinked):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Identity not linked"})
+	case errors.Is(err, services.ErrLastSignInMethod):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Identity cannot be unlinked", "details": err.Error()})
+	case errors.Is(err, services.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	case errors.Is(err, services.ErrAccountDisabled):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account disabled"})
+	default:
+		utils.NewLogger("OAuthHandler", "respondIdentityError").WithContext(c.Request.Context()).Errorf("Identity operation failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update linked identities", "details": err.Error()})
+	}
+}
+
+// beginOAuthFlow stores a fresh signed state cookie and returns the provider authorization URL.
+// A non-empty linkUserID turns the callback into a link for that user instead of a login.
+func beginOAuthFlow(c *gin.Context, provider *utils.OAuthProvider, redirectURI, linkUserID string) (string, error) {
+	state, err := utils.NewOAuthState(provider.Name, redirectURI)
+	if err != nil {
+		return "", err
+	}
+	state.LinkUserID = linkUserID
+	cookieValue, err := utils.EncodeOAuthState(state)
+	if err != nil {
+		return "", err
+	}
+	setStateCookie(c, provider.Name, cookieValue, int(utils.OAuthStateTTL.Seconds()))
+	return provider.AuthCodeURL(state), nil
+}
+
+// setStateCookie writes (or clears, with maxAge -1) the OAuth state cookie.
+// SameSite=Lax lets the cookie accompany the top-level redirect back from the provider.
+func setStateCookie(c *gin.Context, provider, value string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(utils.OAuthStateCookie, value, maxAge, oauthStateCookiePath(provider), "", os.Getenv("GIN_MODE") == "release", true)
+}
@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"lem-be/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondPasswordPolicyError writes the violated password rules and reports whether err was a policy error
+func respondPasswordPolicyError(c *gin.Context, err error) bool {
+	var weak *services.PasswordPolicyError
+	if !errors.As(err, &weak) {
+		return false
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "Password does not meet the requirements", "violations": weak.Violations})
+	return true
+}
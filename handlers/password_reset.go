@@ -2,9 +2,12 @@ package handlers
 
 import (
 	"crypto/rand"
+	"errors"
 	"fmt"
+	"math"
 	"math/big"
 	"net/http"
+	"strconv"
 
 	"lem-be/models"
 	"lem-be/services"
@@ -66,6 +69,16 @@ func (h *passwordResetHandler) HandleVerifyOTP(c *gin.Context) {
 	token, err := h.passwordResetService.VerifyOTP(c, req)
 	if err != nil {
 		log.Warnf("OTP verification failed for email %s: %v", req.Email, err)
+		var throttled *services.TooManyAttemptsError
+		if errors.As(err, &throttled) {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed attempts. Please try again later."})
+			return
+		}
+		if errors.Is(err, services.ErrInvalidOTP) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to verify OTP", "details": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify OTP", "details": err.Error()})
 		return
 	}
@@ -89,6 +102,9 @@ func (h *passwordResetHandler) HandleResetPassword(c *gin.Context) {
 	log.Info("Resetting password using token")
 
 	if err := h.passwordResetService.ResetPassword(c, req); err != nil {
+		if respondPasswordPolicyError(c, err) {
+			return
+		}
 		log.Errorf("Failed to reset password: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password", "details": err.Error()})
 		return
@@ -96,7 +112,7 @@ func (h *passwordResetHandler) HandleResetPassword(c *gin.Context) {
 
 	log.Info("Password reset successfully")
 
-	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully. All sessions have been signed out."})
 }
 
 func generateOTP() (string, error) {
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+
+	"lem-be/models"
+	"lem-be/services"
+	"lem-be/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// passwordlessDeviceCookie holds the secret that binds sign-in codes to the browser that requested them
+const passwordlessDeviceCookie = "passwordless_device"
+
+// passwordlessDeviceCookieMaxAge keeps the secret across several sign-ins; it is refreshed on every request
+const passwordlessDeviceCookieMaxAge = 24 * 60 * 60
+
+type PasswordlessHandler interface {
+	HandleStart(c *gin.Context)
+	HandleVerify(c *gin.Context)
+}
+
+type passwordlessHandler struct {
+	passwordlessService services.PasswordlessService
+}
+
+func NewPasswordlessHandler(passwordlessService services.PasswordlessService) PasswordlessHandler {
+	return &passwordlessHandler{passwordlessService: passwordlessService}
+}
+
+// HandleStart emails a sign-in code or link and binds it to this browser
+func (h *passwordlessHandler) HandleStart(c *gin.Context) {
+	var req models.PasswordlessStartRequest
+	log := utils.NewLogger("PasswordlessHandler", "HandleStart").WithContext(c.Request.Context())
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Warnf("Invalid email address: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email address"})
+		return
+	}
+
+	device, _ := c.Cookie(passwordlessDeviceCookie)
+	device, err := h.passwordlessService.Start(c.Request.Context(), req, device)
+	if err != nil {
+		if errors.Is(err, services.ErrPasswordlessDisabled) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Passwordless login is not enabled"})
+			return
+		}
+		log.Errorf("Failed to start passwordless login for %s: %v", req.Email, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send sign-in email", "details": err.Error()})
+		return
+	}
+	if device != "" {
+		c.SetCookie(passwordlessDeviceCookie, device, passwordlessDeviceCookieMaxAge, "/api/v1/auth/passwordless", "", os.Getenv("GIN_MODE") == "release", true)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If an account exists, a sign-in email has been sent."})
+}
+
+// HandleVerify exchanges a typed code, or the token the frontend read from the emailed link, for a token pair
+func (h *passwordlessHandler) HandleVerify(c *gin.Context) {
+	var req models.PasswordlessVerifyRequest
+	log := utils.NewLogger("PasswordlessHandler", "HandleVerify").WithContext(c.Request.Context())
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Warnf("Invalid request: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	device, _ := c.Cookie(passwordlessDeviceCookie)
+	tokens, err := h.passwordlessService.Verify(c.Request.Context(), req, device, c.ClientIP())
+	if err != nil {
+		log.Warnf("Passwordless login failed for email %s: %v", req.Email, err)
+		var throttled *services.TooManyAttemptsError
+		switch {
+		case errors.As(err, &throttled):
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed attempts. Please try again later."})
+		case errors.Is(err, services.ErrPasswordlessDisabled):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Passwordless login is not enabled"})
+		case errors.Is(err, services.ErrInvalidOTP), errors.Is(err, services.ErrOTPDeviceMismatch):
+			// Identical answers, so a guess cannot tell whether a code is pending for the email
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired sign-in code"})
+		case errors.Is(err, services.ErrAccountDisabled):
+			c.JSON(http.StatusForbidden, gin.H{"error": "Account disabled"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Passwordless login failed", "details": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
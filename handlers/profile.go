@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"lem-be/models"
+	"lem-be/services"
+	"lem-be/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+type ProfileHandler interface {
+	HandleGetMe(c *gin.Context)
+	HandleUpdateMe(c *gin.Context)
+}
+
+type profileHandler struct {
+	profileService services.ProfileService
+}
+
+func NewProfileHandler(profileService services.ProfileService) ProfileHandler {
+	return &profileHandler{profileService: profileService}
+}
+
+// HandleGetMe returns the authenticated user
+func (h *profileHandler) HandleGetMe(c *gin.Context) {
+	log := utils.NewLogger("ProfileHandler", "HandleGetMe").WithContext(c.Request.Context())
+	claims := currentClaims(c)
+
+	user, err := h.profileService.GetProfile(c.Request.Context(), claims.UserID)
+	if err != nil {
+		if errors.Is(err, services.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		log.Errorf("Failed to load profile for user %s: %v", claims.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load profile", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// HandleUpdateMe updates the authenticated user's profile fields
+func (h *profileHandler) HandleUpdateMe(c *gin.Context) {
+	var req models.UpdateProfileRequest
+	log := utils.NewLogger("ProfileHandler", "HandleUpdateMe").WithContext(c.Request.Context())
+	claims := currentClaims(c)
+
+	// Reject unknown fields so attempts to set role, provider, etc. fail loudly instead of being ignored
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		log.Warnf("Invalid profile update from user %s: %v", claims.UserID, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+	if err := binding.Validator.ValidateStruct(&req); err != nil {
+		log.Warnf("Invalid profile update from user %s: %v", claims.UserID, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	user, err := h.profileService.UpdateProfile(c.Request.Context(), claims.UserID, req)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidAvatarURL), errors.Is(err, services.ErrInvalidLocale), errors.Is(err, services.ErrInvalidTimezone):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		case errors.Is(err, services.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		default:
+			log.Errorf("Failed to update profile for user %s: %v", claims.UserID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile", "details": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
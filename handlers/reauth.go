@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"lem-be/models"
+	"lem-be/services"
+	"lem-be/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ReauthHandler interface {
+	HandleReauth(c *gin.Context)
+}
+
+type reauthHandler struct {
+	reauthService services.ReauthService
+}
+
+func NewReauthHandler(reauthService services.ReauthService) ReauthHandler {
+	return &reauthHandler{reauthService: reauthService}
+}
+
+// HandleReauth checks the password and/or second factor again and returns an access token with a fresh auth_time
+func (h *reauthHandler) HandleReauth(c *gin.Context) {
+	var req models.ReauthRequest
+	log := utils.NewLogger("ReauthHandler", "HandleReauth").WithContext(c.Request.Context())
+	claims := currentClaims(c)
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Warnf("Invalid request body: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	tokens, err := h.reauthService.Reauthenticate(c.Request.Context(), claims, req)
+	if err != nil {
+		log.Warnf("Re-authentication failed for user %s: %v", claims.UserID, err)
+		var throttled *services.TooManyAttemptsError
+		switch {
+		case errors.As(err, &throttled):
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed attempts. Please try again later."})
+		case errors.Is(err, services.ErrInvalidPassword):
+			c.JSON(http.StatusForbidden, gin.H{"error": "Password is incorrect"})
+		case errors.Is(err, services.ErrInvalidMFACode):
+			c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor code is incorrect"})
+		case errors.Is(err, services.ErrSecondFactorRequired), errors.Is(err, services.ErrNoPasswordSet), errors.Is(err, services.ErrMFANotEnabled):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Re-authentication failed", "details": err.Error()})
+		case errors.Is(err, services.ErrSessionEnded):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has ended", "details": err.Error()})
+		case errors.Is(err, services.ErrAccountDisabled):
+			c.JSON(http.StatusForbidden, gin.H{"error": "Account disabled"})
+		case errors.Is(err, services.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Re-authentication failed", "details": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
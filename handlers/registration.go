@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"lem-be/models"
+	"lem-be/services"
+	"lem-be/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RegistrationHandler interface {
+	HandleRegister(c *gin.Context)
+	HandleVerifyEmail(c *gin.Context)
+	HandleResendVerification(c *gin.Context)
+}
+
+type registrationHandler struct {
+	registrationService services.RegistrationService
+}
+
+func NewRegistrationHandler(registrationService services.RegistrationService) RegistrationHandler {
+	return &registrationHandler{registrationService: registrationService}
+}
+
+// HandleRegister creates a local account pending email verification
+func (h *registrationHandler) HandleRegister(c *gin.Context) {
+	var req models.RegisterRequest
+	log := utils.NewLogger("RegistrationHandler", "HandleRegister").WithContext(c.Request.Context())
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Warnf("Invalid request body: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	log.Infof("Registration attempt for email %s", req.Email)
+
+	if err := h.registrationService.Register(c.Request.Context(), req); err != nil {
+		if respondPasswordPolicyError(c, err) {
+			return
+		}
+		log.Errorf("Registration failed for email %s: %v", req.Email, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Registration failed", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Check your inbox to verify your email address."})
+}
+
+// HandleVerifyEmail confirms an email address with the code typed in or read from the emailed link by the frontend
+func (h *registrationHandler) HandleVerifyEmail(c *gin.Context) {
+	var req models.VerifyEmailRequest
+	log := utils.NewLogger("RegistrationHandler", "HandleVerifyEmail").WithContext(c.Request.Context())
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Warnf("Invalid request: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if err := h.registrationService.VerifyEmail(c.Request.Context(), req); err != nil {
+		if errors.Is(err, services.ErrInvalidVerificationCode) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification code"})
+			return
+		}
+		log.Errorf("Email verification failed for %s: %v", req.Email, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Email verification failed", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
+}
+
+// HandleResendVerification sends a new verification code to a pending account
+func (h *registrationHandler) HandleResendVerification(c *gin.Context) {
+	var req models.ResendVerificationRequest
+	log := utils.NewLogger("RegistrationHandler", "HandleResendVerification").WithContext(c.Request.Context())
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Warnf("Invalid email address: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email address"})
+		return
+	}
+
+	if err := h.registrationService.ResendVerification(c.Request.Context(), req); err != nil {
+		log.Errorf("Failed to resend verification to %s: %v", req.Email, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resend verification", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If a pending account exists, a new verification code has been sent."})
+}
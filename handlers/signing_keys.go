@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"lem-be/services"
+	"lem-be/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SigningKeyHandler interface {
+	HandleListKeys(c *gin.Context)
+	HandleRotateKey(c *gin.Context)
+}
+
+type signingKeyHandler struct {
+	signingKeyService services.SigningKeyService
+}
+
+func NewSigningKeyHandler(signingKeyService services.SigningKeyService) SigningKeyHandler {
+	return &signingKeyHandler{signingKeyService: signingKeyService}
+}
+
+// HandleListKeys lists the keys of the signing key ring
+func (h *signingKeyHandler) HandleListKeys(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"keys": h.signingKeyService.List()})
+}
+
+// HandleRotateKey publishes a freshly generated key that becomes the signing key after utils.KeyActivationDelay
+func (h *signingKeyHandler) HandleRotateKey(c *gin.Context) {
+	log := utils.NewLogger("SigningKeyHandler", "HandleRotateKey").WithContext(c.Request.Context())
+
+	claims := currentClaims(c)
+
+	key, err := h.signingKeyService.Rotate(c.Request.Context())
+	if err != nil {
+		if errors.Is(err, services.ErrKeyRotationPending) || errors.Is(err, services.ErrStaticSigningKey) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Signing key cannot be rotated", "details": err.Error()})
+			return
+		}
+		log.Errorf("Key rotation requested by %s failed: %v", claims.Email, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate signing key", "details": err.Error()})
+		return
+	}
+
+	log.Infof("Signing key %s added by %s, active from %s", key.ID, claims.Email, key.ActivateAt)
+	c.JSON(http.StatusOK, gin.H{"message": "Signing key rotated", "key": key})
+}
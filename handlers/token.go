@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"lem-be/models"
+	"lem-be/services"
+	"lem-be/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TokenHandler interface {
+	HandleRefresh(c *gin.Context)
+	HandleLogout(c *gin.Context)
+	HandleLogoutAll(c *gin.Context)
+}
+
+type tokenHandler struct {
+	tokenService services.TokenService
+}
+
+func NewTokenHandler(tokenService services.TokenService) TokenHandler {
+	return &tokenHandler{tokenService: tokenService}
+}
+
+// HandleRefresh rotates a refresh token and returns a new access/refresh pair
+func (h *tokenHandler) HandleRefresh(c *gin.Context) {
+	var req models.RefreshTokenRequest
+	log := utils.NewLogger("TokenHandler", "HandleRefresh").WithContext(c.Request.Context())
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Warnf("Invalid request body: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	resp, err := h.tokenService.Refresh(c.Request.Context(), req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidRefreshToken) || errors.Is(err, services.ErrRefreshTokenReused) {
+			log.Warnf("Refresh rejected: %v", err)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+			return
+		}
+
+		log.Errorf("Token refresh failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Token refresh failed", "details": err.Error()})
+		return
+	}
+
+	log.Info("Token refreshed successfully")
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// HandleLogout revokes the presented access token and its session
+func (h *tokenHandler) HandleLogout(c *gin.Context) {
+	log := utils.NewLogger("TokenHandler", "HandleLogout").WithContext(c.Request.Context())
+	claims := currentClaims(c)
+
+	if err := h.tokenService.Logout(c.Request.Context(), claims); err != nil {
+		log.Errorf("Logout failed for user %s: %v", claims.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Logout failed", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+// HandleLogoutAll revokes every session of the authenticated user
+func (h *tokenHandler) HandleLogoutAll(c *gin.Context) {
+	log := utils.NewLogger("TokenHandler", "HandleLogoutAll").WithContext(c.Request.Context())
+	claims := currentClaims(c)
+
+	if err := h.tokenService.LogoutAll(c.Request.Context(), claims.UserID); err != nil {
+		log.Errorf("Logout-all failed for user %s: %v", claims.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Logout failed", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out of all sessions"})
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+
+	"lem-be/models"
+	"lem-be/services"
+	"lem-be/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type WebAuthnHandler interface {
+	HandleBeginRegistration(c *gin.Context)
+	HandleFinishRegistration(c *gin.Context)
+	HandleListCredentials(c *gin.Context)
+	HandleDeleteCredential(c *gin.Context)
+	HandleBeginLogin(c *gin.Context)
+	HandleFinishLogin(c *gin.Context)
+}
+
+type webAuthnHandler struct {
+	webAuthnService services.WebAuthnService
+}
+
+func NewWebAuthnHandler(webAuthnService services.WebAuthnService) WebAuthnHandler {
+	return &webAuthnHandler{webAuthnService: webAuthnService}
+}
+
+// HandleBeginRegistration returns the options for navigator.credentials.create()
+func (h *webAuthnHandler) HandleBeginRegistration(c *gin.Context) {
+	log := utils.NewLogger("WebAuthnHandler", "HandleBeginRegistration").WithContext(c.Request.Context())
+	claims := currentClaims(c)
+
+	options, err := h.webAuthnService.BeginRegistration(c.Request.Context(), claims.UserID)
+	if err != nil {
+		log.Warnf("Passkey registration could not start for user %s: %v", claims.UserID, err)
+		respondWebAuthnError(c, err, "Failed to start passkey registration")
+		return
+	}
+	c.JSON(http.StatusOK, options)
+}
+
+// HandleFinishRegistration stores the credential created by the browser
+func (h *webAuthnHandler) HandleFinishRegistration(c *gin.Context) {
+	var req models.FinishWebAuthnRequest
+	log := utils.NewLogger("WebAuthnHandler", "HandleFinishRegistration").WithContext(c.Request.Context())
+	claims := currentClaims(c)
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Warnf("Invalid request body: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	credential, err := h.webAuthnService.FinishRegistration(c.Request.Context(), claims.UserID, req)
+	if err != nil {
+		log.Warnf("Passkey registration failed for user %s: %v", claims.UserID, err)
+		respondWebAuthnError(c, err, "Failed to register passkey")
+		return
+	}
+	c.JSON(http.StatusCreated, credential)
+}
+
+// HandleListCredentials lists the current user's passkeys
+func (h *webAuthnHandler) HandleListCredentials(c *gin.Context) {
+	claims := currentClaims(c)
+
+	credentials, err := h.webAuthnService.ListCredentials(c.Request.Context(), claims.UserID)
+	if err != nil {
+		respondWebAuthnError(c, err, "Failed to list passkeys")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"credentials": credentials})
+}
+
+// HandleDeleteCredential removes a passkey identified by its base64url credential ID
+func (h *webAuthnHandler) HandleDeleteCredential(c *gin.Context) {
+	log := utils.NewLogger("WebAuthnHandler", "HandleDeleteCredential").WithContext(c.Request.Context())
+	claims := currentClaims(c)
+
+	credentialID, err := base64.RawURLEncoding.DecodeString(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Passkey not found"})
+		return
+	}
+
+	if err := h.webAuthnService.DeleteCredential(c.Request.Context(), claims.UserID, credentialID); err != nil {
+		log.Warnf("Removing passkey failed for user %s: %v", claims.UserID, err)
+		respondWebAuthnError(c, err, "Failed to remove passkey")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Passkey removed"})
+}
+
+// HandleBeginLogin returns the options for navigator.credentials.get()
+func (h *webAuthnHandler) HandleBeginLogin(c *gin.Context) {
+	var req models.BeginWebAuthnLoginRequest
+	log := utils.NewLogger("WebAuthnHandler", "HandleBeginLogin").WithContext(c.Request.Context())
+
+	// An empty body starts a discoverable login
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			log.Warnf("Invalid request body: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+			return
+		}
+	}
+
+	options, err := h.webAuthnService.BeginLogin(c.Request.Context(), req)
+	if err != nil {
+		log.Warnf("Passkey login could not start: %v", err)
+		respondWebAuthnError(c, err, "Failed to start passkey login")
+		return
+	}
+	c.JSON(http.StatusOK, options)
+}
+
+// HandleFinishLogin exchanges a verified assertion for a token pair
+func (h *webAuthnHandler) HandleFinishLogin(c *gin.Context) {
+	var req models.FinishWebAuthnRequest
+	log := utils.NewLogger("WebAuthnHandler", "HandleFinishLogin").WithContext(c.Request.Context())
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Warnf("Invalid request body: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	tokens, err := h.webAuthnService.FinishLogin(c.Request.Context(), req)
+	if err != nil {
+		log.Warnf("Passkey login failed: %v", err)
+		respondWebAuthnError(c, err, "Passkey login failed")
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// respondWebAuthnError maps WebAuthn service errors to HTTP responses
+func respondWebAuthnError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrWebAuthnDisabled):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Passkeys are not enabled"})
+	case errors.Is(err, services.ErrWebAuthnVerification), errors.Is(err, services.ErrWebAuthnSessionInvalid),
+		errors.Is(err, services.ErrInvalidMFAChallenge), errors.Is(err, services.ErrWebAuthnCloneDetected):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": message, "details": err.Error()})
+	case errors.Is(err, services.ErrWebAuthnNoCredentials):
+		c.JSON(http.StatusBadRequest, gin.H{"error": message, "details": err.Error()})
+	case errors.Is(err, services.ErrAccountDisabled):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account disabled"})
+	case errors.Is(err, services.ErrWebAuthnCredentialExists):
+		c.JSON(http.StatusConflict, gin.H{"error": message, "details": err.Error()})
+	case errors.Is(err, services.ErrWebAuthnCredentialNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Passkey not found"})
+	case errors.Is(err, services.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	default:
+		utils.NewLogger("WebAuthnHandler", "respondWebAuthnError").WithContext(c.Request.Context()).Errorf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message, "details": err.Error()})
+	}
+}
@@ -3,8 +3,10 @@ package main
 import (
 	"context"
 	"os"
+	"time"
 
 	"lem-be/database"
+	"lem-be/repository"
 	"lem-be/router"
 	"lem-be/services"
 	"lem-be/utils"
@@ -45,18 +47,78 @@ func main() {
 		}
 	}()
 
+	// "migrate status|up|down" manages schema migrations and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		code := runMigrateCommand(os.Args[2:])
+		database.Close()
+		os.Exit(code)
+	}
+
+	// Apply pending migrations before indexes are built on the migrated data
+	if os.Getenv("MIGRATE_ON_START") != "false" {
+		if err := database.RunMigrations(database.GetDB()); err != nil {
+			log.Errorf("Failed to apply database migrations: %v", err)
+			os.Exit(1)
+		}
+	}
+
+	// Create unique and TTL indexes and report drift from the declared set
+	if err := database.EnsureIndexes(database.GetDB()); err != nil {
+		log.Errorf("Failed to ensure MongoDB indexes: %v", err)
+		os.Exit(1)
+	}
+
+	repos := repository.NewMongoRepositories(database.GetDB())
+
 	// Bootstrap superuser
 	log.Info("Bootstrapping superuser...")	
-	if err := services.InitSuperuser(database.GetDB()); err != nil {
+	if err := services.InitSuperuser(repos.Users, services.PasswordStrengthPolicy()); err != nil {
 		log.Errorf("Error bootstrapping superuser: %v", err)
+	} else {
+		log.Info("Superuser bootstrapped successfully")
+	}
+
+	// Initialize JWT signing keys
+	if err := services.InitSigningKeys(repos.SigningKeys); err != nil {
+		log.Errorf("Failed to initialize JWT signing keys: %v", err)
+		os.Exit(1)
 	}
-	log.Info("Superuser bootstrapped successfully")
 
-	// Initialize OAuth2 config
-	utils.InitOAuthConfig()
+	// Rotate signing keys on schedule and retire keys whose tokens have expired
+	rotationInterval, err := time.ParseDuration(os.Getenv("JWT_KEY_ROTATION_INTERVAL"))
+	if err != nil && os.Getenv("JWT_KEY_ROTATION_INTERVAL") != "" {
+		log.Errorf("Invalid JWT_KEY_ROTATION_INTERVAL: %v", err)
+	}
+	rotationCtx, stopRotation := context.WithCancel(context.Background())
+	defer stopRotation()
+	services.StartKeyRotation(rotationCtx, repos.SigningKeys, rotationInterval)
+
+	// OTP codes are stored as keyed hashes and cannot be issued without the secret
+	if _, err := utils.GetOTPSecret(); err != nil {
+		log.Errorf("Failed to initialize OTP hashing: %v", err)
+		os.Exit(1)
+	}
+
+	// Initialize token revocation store
+	if err := services.InitRevocationStore(repos.Revocations); err != nil {
+		log.Errorf("Failed to initialize token revocation store: %v", err)
+		os.Exit(1)
+	}
+
+	// Initialize OAuth2 login providers
+	if err := utils.InitOAuthConfig(); err != nil {
+		log.Errorf("Failed to initialize OAuth providers: %v", err)
+		os.Exit(1)
+	}
+
+	// Passkeys are enabled when a WebAuthn relying party is configured
+	if err := utils.InitWebAuthn(); err != nil {
+		log.Errorf("Failed to initialize WebAuthn: %v", err)
+		os.Exit(1)
+	}
 
 	// Initialize Gin router
-	r := router.Setup()
+	r := router.Setup(repos)
 
 	// Get port from environment or use default
 	port := os.Getenv("PORT")
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"lem-be/database"
+)
+
+const migrateUsage = `usage: migrate <command>
+
+commands:
+  status          list migrations and whether they are applied
+  up [version]    apply pending migrations, optionally only up to version
+  down [steps]    roll back the last applied migration, or the last steps migrations`
+
+// runMigrateCommand implements the "migrate" subcommand and returns the process exit code
+func runMigrateCommand(args []string) int {
+	if len(args) == 0 || len(args) > 2 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	number := 0
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			fmt.Fprintf(os.Stderr, "invalid number %q\n", args[1])
+			return 2
+		}
+		number = n
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+	db := database.GetDB()
+
+	switch args[0] {
+	case "status":
+		statuses, err := database.MigrationStatuses(ctx, db)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read migration status: %v\n", err)
+			return 1
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tAPPLIED\tREVERSIBLE\tDESCRIPTION")
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%t\t%s\n", status.Version, applied, status.Reversible, status.Description)
+		}
+		w.Flush()
+		return 0
+	case "up":
+		applied, err := database.MigrateUp(ctx, db, number)
+		for _, version := range applied {
+			fmt.Printf("applied %d\n", version)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "migrate up: %v\n", err)
+			return 1
+		}
+		if len(applied) == 0 {
+			fmt.Println("no pending migrations")
+		}
+		return 0
+	case "down":
+		if number == 0 {
+			number = 1
+		}
+		rolledBack, err := database.MigrateDown(ctx, db, number)
+		for _, version := range rolledBack {
+			fmt.Printf("rolled back %d\n", version)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "migrate down: %v\n", err)
+			return 1
+		}
+		if len(rolledBack) == 0 {
+			fmt.Println("no applied migrations")
+		}
+		return 0
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+}
@@ -0,0 +1,12 @@
+package models
+
+// ChangeEmailRequest asks for a confirmation code to be sent to the new address
+type ChangeEmailRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ConfirmEmailChangeRequest switches the account to the new address with the code sent there
+type ConfirmEmailChangeRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Code  string `json:"code" binding:"required"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import "lem-be/constants"
+
+type ListUsersQuery struct {
+	Page        int            `form:"page" binding:"omitempty,min=1"`
+	PageSize    int            `form:"page_size" binding:"omitempty,min=1,max=100"`
+	Role        constants.Role `form:"role" binding:"omitempty,oneof=super_admin admin user"`
+	Provider    string         `form:"provider"`
+	EmailPrefix string         `form:"email_prefix"`
+	Sort        string         `form:"sort" binding:"omitempty,oneof=email role provider created_at updated_at"`
+	Order       string         `form:"order" binding:"omitempty,oneof=asc desc"`
+}
+
+type ListUsersResponse struct {
+	Users    []User `json:"users"`
+	Page     int    `json:"page"`
+	PageSize int    `json:"page_size"`
+	Total    int64  `json:"total"`
+}
+
+type CreateUserRequest struct {
+	Email    string         `json:"email" binding:"required,email"`
+	Password string         `json:"password" binding:"required"`
+	Role     constants.Role `json:"role" binding:"required,oneof=super_admin admin user"`
+}
+
+type UpdateUserRoleRequest struct {
+	Role constants.Role `json:"role" binding:"required,oneof=super_admin admin user"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// FailedAttempt counts consecutive failures for one throttling key, e.g. "login-account:alice@example.com"
+type FailedAttempt struct {
+	Key           string     `bson:"key" json:"key"`
+	Failures      int        `bson:"failures" json:"failures"`
+	LastFailureAt time.Time  `bson:"last_failure_at" json:"last_failure_at"`
+	BlockedUntil  *time.Time `bson:"blocked_until,omitempty" json:"blocked_until,omitempty"`
+	ExpiresAt     time.Time  `bson:"expires_at" json:"expires_at"`
+}
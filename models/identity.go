@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Identity is an external provider account linked to a user
+type Identity struct {
+	Provider   string    `bson:"provider" json:"provider"`       // e.g., "google", "github"
+	ProviderID string    `bson:"provider_id" json:"provider_id"` // Stable account ID at the provider
+	Email      string    `bson:"email,omitempty" json:"email,omitempty"`
+	LinkedAt   time.Time `bson:"linked_at" json:"linked_at"`
+}
+
+// LinkIdentityRequest starts linking a provider account to the logged-in user
+type LinkIdentityRequest struct {
+	RedirectURI string `json:"redirect_uri"`
+}
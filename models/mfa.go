@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// MFA holds a user's TOTP second factor. Only its status is exposed in API responses.
+type MFA struct {
+	Enabled            bool       `bson:"enabled" json:"enabled"` // False while enrollment awaits its first code
+	TOTPSecret         string     `bson:"totp_secret" json:"-"`   // Encrypted with utils.EncryptTOTPSecret
+	LastTOTPStep       int64      `bson:"last_totp_step,omitempty" json:"-"`
+	RecoveryCodeHashes []string   `bson:"recovery_code_hashes,omitempty" json:"-"`
+	EnabledAt          *time.Time `bson:"enabled_at,omitempty" json:"enabled_at,omitempty"`
+}
+
+// TOTPEnrollmentResponse carries the new secret for the authenticator app; otpauth_uri is the QR code payload
+type TOTPEnrollmentResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+// ConfirmTOTPRequest completes enrollment with the first code from the authenticator app
+type ConfirmTOTPRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// RecoveryCodesResponse lists single-use recovery codes; they are shown only once
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// DisableTOTPRequest turns off the second factor; code is a current TOTP or a recovery code
+type DisableTOTPRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// MFAVerifyRequest completes a two-step login with either a TOTP code or a recovery code
+type MFAVerifyRequest struct {
+	MFAToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code" binding:"required_without=RecoveryCode"`
+	RecoveryCode string `json:"recovery_code" binding:"required_without=Code"`
+}
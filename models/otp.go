@@ -2,9 +2,24 @@ package models
 
 import "time"
 
-// OTPRecord represents a numeric code sent to a user for password reset
+// OTP purposes; a user can hold one pending code per purpose
+const (
+	OTPPurposePasswordReset     = "password_reset"
+	OTPPurposeEmailVerification = "email_verification"
+	OTPPurposeLogin             = "login"
+	OTPPurposeLoginLink         = "login_link" // Random token of an emailed sign-in link, never a typed code
+	OTPPurposeEmailChange       = "email_change"
+)
+
+// OTPRecord represents a numeric code sent to a user for password reset, email verification, passwordless login
+// or an email change (keyed by the new address), or the token of a sign-in link.
+// Only a keyed hash of the code is stored (see utils.HashOTP).
 type OTPRecord struct {
-	Email     string    `bson:"email" json:"email"`
-	Code      string    `bson:"code" json:"code"`
-	ExpiresAt time.Time `bson:"expires_at" json:"expires_at"`
+	Email      string    `bson:"email" json:"email"`
+	Purpose    string    `bson:"purpose" json:"purpose"`
+	CodeHash   string    `bson:"code_hash" json:"-"`
+	Attempts   int       `bson:"attempts" json:"attempts"` // Wrong guesses so far; the code is invalidated at the limit
+	DeviceHash string    `bson:"device_hash" json:"-"`     // Set when the code only works from the device that requested it
+	LastSentAt time.Time `bson:"last_sent_at" json:"last_sent_at"`
+	ExpiresAt  time.Time `bson:"expires_at" json:"expires_at"`
 }
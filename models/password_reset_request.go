@@ -11,5 +11,10 @@ type VerifyOTPRequest struct {
 
 type ResetPasswordRequest struct {
 	ResetToken  string `json:"reset_token" binding:"required"`
-	NewPassword string `json:"new_password" binding:"required,min=6"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
 }
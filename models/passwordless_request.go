@@ -0,0 +1,12 @@
+package models
+
+type PasswordlessStartRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// PasswordlessVerifyRequest carries either a typed code or the token the frontend read from the emailed link
+type PasswordlessVerifyRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Code  string `json:"code" binding:"required_without=Token"`
+	Token string `json:"token" binding:"required_without=Code"`
+}
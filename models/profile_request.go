@@ -0,0 +1,10 @@
+package models
+
+// UpdateProfileRequest is a partial update of the caller's profile. Omitted fields are left unchanged
+// and an empty string clears a field. Any other field (role, provider, ...) is rejected.
+type UpdateProfileRequest struct {
+	DisplayName *string `json:"display_name" binding:"omitempty,max=100"`
+	AvatarURL   *string `json:"avatar_url" binding:"omitempty,max=2048"`
+	Locale      *string `json:"locale" binding:"omitempty,max=35"`
+	Timezone    *string `json:"timezone" binding:"omitempty,max=64"`
+}
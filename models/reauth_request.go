@@ -0,0 +1,8 @@
+package models
+
+// ReauthRequest proves the signed-in user's identity again with their password, a second factor, or both
+type ReauthRequest struct {
+	Password     string `json:"password" binding:"required_without_all=Code RecoveryCode"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
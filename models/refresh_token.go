@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// RefreshTokenRecord tracks an issued refresh token within its rotation family.
+// Every token of a login session shares the same FamilyID, AuthTime and AMR.
+type RefreshTokenRecord struct {
+	JTI       string     `bson:"jti" json:"jti"`
+	FamilyID  string     `bson:"family_id" json:"family_id"`
+	UserID    string     `bson:"user_id" json:"user_id"`
+	AuthTime  time.Time  `bson:"auth_time,omitempty" json:"auth_time,omitempty"` // Copied into the auth_time claim of refreshed access tokens
+	AMR       []string   `bson:"amr,omitempty" json:"amr,omitempty"`
+	ExpiresAt time.Time  `bson:"expires_at" json:"expires_at"`
+	UsedAt    *time.Time `bson:"used_at,omitempty" json:"used_at,omitempty"`
+	RevokedAt *time.Time `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `bson:"created_at" json:"created_at"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
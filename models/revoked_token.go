@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// RevokedToken marks a single token (by jti) as revoked until it would have expired anyway
+type RevokedToken struct {
+	JTI       string    `bson:"jti" json:"jti"`
+	UserID    string    `bson:"user_id" json:"user_id"`
+	ExpiresAt time.Time `bson:"expires_at" json:"expires_at"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+}
+
+// UserRevocation revokes every token of a user stamped with an epoch below Epoch.
+// Epoch only ever increases; tokens carry the value current when they were issued.
+type UserRevocation struct {
+	UserID    string    `bson:"user_id" json:"user_id"`
+	Epoch     int64     `bson:"epoch" json:"epoch"`
+	ExpiresAt time.Time `bson:"expires_at" json:"expires_at"`
+}
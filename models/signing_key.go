@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// SigningKeyRecord is a JWT signing key shared by every instance of the server.
+// The PKCS#8 private key is encrypted with JWT_KEY_ENCRYPTION_KEY.
+type SigningKeyRecord struct {
+	ID         string `bson:"_id"` // kid, the RFC 7638 thumbprint of the public key
+	Algorithm  string `bson:"algorithm"`
+	PrivateKey string `bson:"private_key"`
+	// SuccessorOf is the kid of the key this one replaces; it is unique so that
+	// instances rotating at the same time cannot both add a key
+	SuccessorOf string    `bson:"successor_of"`
+	CreatedAt   time.Time `bson:"created_at"`
+	ActivateAt  time.Time `bson:"activate_at"`
+}
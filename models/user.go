@@ -10,12 +10,26 @@ import (
 
 // User represents a user in the system
 type User struct {
-	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
-	Email      string             `bson:"email" json:"email"`
-	Password   string             `bson:"password,omitempty" json:"-"` // Optional for OAuth users
-	Role       auth_constants.Role     `bson:"role" json:"role"`
-	Provider   string             `bson:"provider" json:"provider"`       // e.g., "google", "local"
-	ProviderID string             `bson:"provider_id" json:"provider_id"` // e.g., Google Subject ID
-	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
-	UpdatedAt  time.Time          `bson:"updated_at" json:"updated_at"`
+	ID            primitive.ObjectID   `bson:"_id,omitempty" json:"id,omitempty"`
+	Email         string               `bson:"email" json:"email"`
+	Password      string               `bson:"password,omitempty" json:"-"` // Optional for OAuth users
+	Role          auth_constants.Role  `bson:"role" json:"role"`
+	Provider      string               `bson:"provider" json:"provider"`       // Provider the account was created with, e.g., "google", "local"
+	ProviderID    string               `bson:"provider_id" json:"provider_id"` // e.g., Google Subject ID
+	Identities    []Identity           `bson:"identities,omitempty" json:"identities,omitempty"`
+	EmailVerified bool                 `bson:"email_verified" json:"email_verified"`
+	Disabled      bool                 `bson:"disabled" json:"disabled"`
+	MFA           *MFA                 `bson:"mfa,omitempty" json:"mfa,omitempty"`
+	WebAuthn      []WebAuthnCredential `bson:"webauthn_credentials,omitempty" json:"webauthn_credentials,omitempty"`
+	Profile       Profile              `bson:"profile" json:"profile"`
+	CreatedAt     time.Time            `bson:"created_at" json:"created_at"`
+	UpdatedAt     time.Time            `bson:"updated_at" json:"updated_at"`
+}
+
+// Profile holds the user-editable profile fields
+type Profile struct {
+	DisplayName string `bson:"display_name,omitempty" json:"display_name,omitempty"`
+	AvatarURL   string `bson:"avatar_url,omitempty" json:"avatar_url,omitempty"`
+	Locale      string `bson:"locale,omitempty" json:"locale,omitempty"`     // BCP 47 tag, e.g. "en-US"
+	Timezone    string `bson:"timezone,omitempty" json:"timezone,omitempty"` // IANA name, e.g. "Europe/Berlin"
 }
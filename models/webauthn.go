@@ -0,0 +1,61 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+)
+
+// WebAuthn ceremonies stored between their begin and finish requests
+const (
+	WebAuthnCeremonyRegistration = "registration"
+	WebAuthnCeremonyLogin        = "login"
+)
+
+// WebAuthnCredential is a passkey or security key registered to a user
+type WebAuthnCredential struct {
+	ID              protocol.URLEncodedBase64 `bson:"id" json:"id"` // Credential ID chosen by the authenticator, base64url in JSON
+	Name            string                    `bson:"name,omitempty" json:"name,omitempty"`
+	PublicKey       []byte                    `bson:"public_key" json:"-"` // COSE-encoded
+	AttestationType string                    `bson:"attestation_type,omitempty" json:"-"`
+	Transports      []string                  `bson:"transports,omitempty" json:"transports,omitempty"`
+	AAGUID          []byte                    `bson:"aaguid,omitempty" json:"aaguid,omitempty"` // Identifies the authenticator model
+	SignCount       uint32                    `bson:"sign_count" json:"-"`
+	CloneWarning    bool                      `bson:"clone_warning,omitempty" json:"clone_warning,omitempty"` // Sign count went backwards; the credential is refused
+	Flags           uint8                     `bson:"flags" json:"-"`                                         // Authenticator data flags from the last ceremony
+	Discoverable    bool                      `bson:"discoverable" json:"discoverable"`                       // Usable without typing an email
+	CreatedAt       time.Time                 `bson:"created_at" json:"created_at"`
+	LastUsedAt      *time.Time                `bson:"last_used_at,omitempty" json:"last_used_at,omitempty"`
+}
+
+// WebAuthnSession holds the challenge of an in-flight ceremony until it is answered once
+type WebAuthnSession struct {
+	ID        string    `bson:"session_id"`
+	Ceremony  string    `bson:"ceremony"`
+	UserID    string    `bson:"user_id,omitempty"` // Empty for discoverable logins
+	MFA       bool      `bson:"mfa,omitempty"`     // Login answers an MFA challenge rather than replacing the password
+	Data      []byte    `bson:"data"`              // JSON-encoded webauthn.SessionData
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+// BeginWebAuthnLoginRequest starts a passkey login. Without an email any discoverable credential is accepted;
+// with an mfa_token the assertion completes a two-step login instead.
+type BeginWebAuthnLoginRequest struct {
+	Email    string `json:"email" binding:"omitempty,email"`
+	MFAToken string `json:"mfa_token"`
+}
+
+// WebAuthnOptionsResponse carries the options for navigator.credentials.create/get and the session they belong to
+type WebAuthnOptionsResponse struct {
+	SessionID string `json:"session_id"`
+	Options   any    `json:"options"`
+}
+
+// FinishWebAuthnRequest answers a ceremony with the credential returned by the browser
+type FinishWebAuthnRequest struct {
+	SessionID  string          `json:"session_id" binding:"required"`
+	Name       string          `json:"name" binding:"max=64"` // Registration only
+	MFAToken   string          `json:"mfa_token"`             // MFA logins only
+	Credential json.RawMessage `json:"credential" binding:"required"`
+}
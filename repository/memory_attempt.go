@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"lem-be/models"
+)
+
+type memoryAttemptRepository struct {
+	mu       sync.Mutex
+	attempts map[string]models.FailedAttempt
+}
+
+func NewMemoryAttemptRepository() AttemptRepository {
+	return &memoryAttemptRepository{attempts: map[string]models.FailedAttempt{}}
+}
+
+func (r *memoryAttemptRepository) Find(ctx context.Context, key string) (models.FailedAttempt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	attempt, ok := r.attempts[key]
+	if !ok {
+		return models.FailedAttempt{}, ErrNotFound
+	}
+	return attempt, nil
+}
+
+func (r *memoryAttemptRepository) DeleteExpired(ctx context.Context, key string, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if attempt, ok := r.attempts[key]; ok && !attempt.ExpiresAt.After(now) {
+		delete(r.attempts, key)
+	}
+	return nil
+}
+
+func (r *memoryAttemptRepository) IncrementFailure(ctx context.Context, key string, at, expiresAt time.Time) (models.FailedAttempt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	attempt := r.attempts[key]
+	attempt.Key = key
+	attempt.Failures++
+	attempt.LastFailureAt = at
+	attempt.ExpiresAt = expiresAt
+	r.attempts[key] = attempt
+	return attempt, nil
+}
+
+func (r *memoryAttemptRepository) DecrementFailure(ctx context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if attempt, ok := r.attempts[key]; ok && attempt.Failures > 0 {
+		attempt.Failures--
+		r.attempts[key] = attempt
+	}
+	return nil
+}
+
+func (r *memoryAttemptRepository) SetBlock(ctx context.Context, key string, blockedUntil, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if attempt, ok := r.attempts[key]; ok {
+		attempt.BlockedUntil = &blockedUntil
+		attempt.ExpiresAt = expiresAt
+		r.attempts[key] = attempt
+	}
+	return nil
+}
+
+func (r *memoryAttemptRepository) Delete(ctx context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.attempts, key)
+	return nil
+}
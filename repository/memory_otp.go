@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"lem-be/models"
+)
+
+type memoryOTPRepository struct {
+	mu      sync.Mutex
+	records map[string]models.OTPRecord
+}
+
+func NewMemoryOTPRepository() OTPRepository {
+	return &memoryOTPRepository{records: map[string]models.OTPRecord{}}
+}
+
+func otpKey(email, purpose string) string {
+	return purpose + "\x00" + email
+}
+
+func (r *memoryOTPRepository) Find(ctx context.Context, email, purpose string) (models.OTPRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	record, ok := r.records[otpKey(email, purpose)]
+	if !ok {
+		return models.OTPRecord{}, ErrNotFound
+	}
+	return record, nil
+}
+
+func (r *memoryOTPRepository) Save(ctx context.Context, record models.OTPRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records[otpKey(record.Email, record.Purpose)] = record
+	return nil
+}
+
+func (r *memoryOTPRepository) IncrementAttempts(ctx context.Context, email, purpose string, maxAttempts int) (models.OTPRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := otpKey(email, purpose)
+	record, ok := r.records[key]
+	if !ok || record.Attempts >= maxAttempts || !record.ExpiresAt.After(time.Now()) {
+		return models.OTPRecord{}, ErrNotFound
+	}
+	record.Attempts++
+	r.records[key] = record
+	return record, nil
+}
+
+func (r *memoryOTPRepository) Delete(ctx context.Context, email, purpose string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.records, otpKey(email, purpose))
+	return nil
+}
+
+func (r *memoryOTPRepository) Consume(ctx context.Context, email, purpose, codeHash string, maxAttempts int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := otpKey(email, purpose)
+	record, ok := r.records[key]
+	if !ok || record.CodeHash != codeHash || record.Attempts > maxAttempts {
+		return ErrNotFound
+	}
+	delete(r.records, key)
+	return nil
+}
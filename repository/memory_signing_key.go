@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"context"
+	"sync"
+
+	"lem-be/models"
+)
+
+type memorySigningKeyRepository struct {
+	mu   sync.Mutex
+	keys map[string]models.SigningKeyRecord
+}
+
+func NewMemorySigningKeyRepository() SigningKeyRepository {
+	return &memorySigningKeyRepository{keys: map[string]models.SigningKeyRecord{}}
+}
+
+func (r *memorySigningKeyRepository) List(ctx context.Context) ([]models.SigningKeyRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	records := make([]models.SigningKeyRecord, 0, len(r.keys))
+	for _, record := range r.keys {
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func (r *memorySigningKeyRepository) Create(ctx context.Context, record models.SigningKeyRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.keys {
+		if existing.ID == record.ID || existing.SuccessorOf == record.SuccessorOf {
+			return ErrDuplicate
+		}
+	}
+	r.keys[record.ID] = record
+	return nil
+}
+
+func (r *memorySigningKeyRepository) Delete(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.keys, id)
+	return nil
+}
@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"lem-be/models"
+)
+
+type memoryRefreshTokenRepository struct {
+	mu      sync.Mutex
+	records map[string]models.RefreshTokenRecord
+}
+
+func NewMemoryRefreshTokenRepository() RefreshTokenRepository {
+	return &memoryRefreshTokenRepository{records: map[string]models.RefreshTokenRecord{}}
+}
+
+func (r *memoryRefreshTokenRepository) Create(ctx context.Context, record models.RefreshTokenRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.records[record.JTI]; ok {
+		return ErrDuplicate
+	}
+	r.records[record.JTI] = record
+	return nil
+}
+
+func (r *memoryRefreshTokenRepository) FindByJTI(ctx context.Context, jti string) (models.RefreshTokenRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	record, ok := r.records[jti]
+	if !ok {
+		return models.RefreshTokenRecord{}, ErrNotFound
+	}
+	return record, nil
+}
+
+func (r *memoryRefreshTokenRepository) MarkUsed(ctx context.Context, jti string, at time.Time) (models.RefreshTokenRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	record, ok := r.records[jti]
+	if !ok || record.UsedAt != nil || record.RevokedAt != nil {
+		return models.RefreshTokenRecord{}, ErrNotFound
+	}
+	record.UsedAt = &at
+	r.records[jti] = record
+	return record, nil
+}
+
+func (r *memoryRefreshTokenRepository) RevokeFamily(ctx context.Context, familyID string, at time.Time) error {
+	r.revokeWhere(func(record models.RefreshTokenRecord) bool { return record.FamilyID == familyID }, at)
+	return nil
+}
+
+func (r *memoryRefreshTokenRepository) SetFamilyAuth(ctx context.Context, familyID string, authTime time.Time, amr []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	updated := 0
+	for jti, record := range r.records {
+		if record.FamilyID == familyID && record.RevokedAt == nil {
+			record.AuthTime = authTime
+			record.AMR = append([]string(nil), amr...)
+			r.records[jti] = record
+			updated++
+		}
+	}
+	if updated == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *memoryRefreshTokenRepository) RevokeUser(ctx context.Context, userID string, at time.Time) error {
+	r.revokeWhere(func(record models.RefreshTokenRecord) bool { return record.UserID == userID }, at)
+	return nil
+}
+
+func (r *memoryRefreshTokenRepository) revokeWhere(match func(models.RefreshTokenRecord) bool, at time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for jti, record := range r.records {
+		if record.RevokedAt == nil && match(record) {
+			record.RevokedAt = &at
+			r.records[jti] = record
+		}
+	}
+}
+
+type memoryRevocationRepository struct {
+	mu     sync.Mutex
+	tokens map[string]models.RevokedToken
+	users  map[string]models.UserRevocation
+}
+
+func NewMemoryRevocationRepository() RevocationRepository {
+	return &memoryRevocationRepository{
+		tokens: map[string]models.RevokedToken{},
+		users:  map[string]models.UserRevocation{},
+	}
+}
+
+func (r *memoryRevocationRepository) RevokeToken(ctx context.Context, token models.RevokedToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.tokens[token.JTI]; !ok {
+		r.tokens[token.JTI] = token
+	}
+	return nil
+}
+
+func (r *memoryRevocationRepository) InsertToken(ctx context.Context, token models.RevokedToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.tokens[token.JTI]; ok {
+		return ErrDuplicate
+	}
+	r.tokens[token.JTI] = token
+	return nil
+}
+
+func (r *memoryRevocationRepository) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.tokens[jti]
+	return ok, nil
+}
+
+func (r *memoryRevocationRepository) SetUserRevocation(ctx context.Context, revocation models.UserRevocation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if stored, ok := r.users[revocation.UserID]; ok && stored.Epoch >= revocation.Epoch {
+		revocation.Epoch = stored.Epoch + 1
+	}
+	r.users[revocation.UserID] = revocation
+	return nil
+}
+
+func (r *memoryRevocationRepository) FindUserRevocation(ctx context.Context, userID string) (models.UserRevocation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	revocation, ok := r.users[userID]
+	if !ok {
+		return models.UserRevocation{}, ErrNotFound
+	}
+	return revocation, nil
+}
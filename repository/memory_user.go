@@ -0,0 +1,406 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"lem-be/models"
+	"lem-be/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memoryUserRepository mirrors the Mongo repository, including its unique email and identity indexes
+type memoryUserRepository struct {
+	mu    sync.Mutex
+	users map[primitive.ObjectID]models.User
+}
+
+func NewMemoryUserRepository() UserRepository {
+	return &memoryUserRepository{users: map[primitive.ObjectID]models.User{}}
+}
+
+func (r *memoryUserRepository) FindByID(ctx context.Context, id string) (models.User, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.User{}, ErrNotFound
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[objectID]
+	if !ok {
+		return models.User{}, ErrNotFound
+	}
+	return copyUser(user), nil
+}
+
+func (r *memoryUserRepository) FindByEmail(ctx context.Context, email string) (models.User, error) {
+	email = utils.NormalizeEmail(email)
+	return r.findFirst(func(user models.User) bool { return user.Email == email })
+}
+
+func (r *memoryUserRepository) FindByIdentity(ctx context.Context, provider, providerID string) (models.User, error) {
+	return r.findFirst(func(user models.User) bool { return hasIdentity(user, provider, providerID) })
+}
+
+func (r *memoryUserRepository) List(ctx context.Context, query models.ListUsersQuery) ([]models.User, int64, error) {
+	r.mu.Lock()
+	matched := []models.User{}
+	for _, user := range r.users {
+		if query.Role != "" && user.Role != query.Role {
+			continue
+		}
+		if query.Provider != "" && user.Provider != query.Provider {
+			continue
+		}
+		if query.EmailPrefix != "" && !strings.HasPrefix(user.Email, query.EmailPrefix) {
+			continue
+		}
+		matched = append(matched, copyUser(user))
+	}
+	r.mu.Unlock()
+
+	sort.Slice(matched, func(i, j int) bool {
+		cmp := compareUsers(matched[i], matched[j], query.Sort)
+		if cmp == 0 {
+			cmp = bytes.Compare(matched[i].ID[:], matched[j].ID[:])
+		}
+		if query.Order == "desc" {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+
+	total := int64(len(matched))
+	start := (query.Page - 1) * query.PageSize
+	if start > len(matched) {
+		start = len(matched)
+	}
+	end := start + query.PageSize
+	if end > len(matched) {
+		end = len(matched)
+	}
+	return matched[start:end], total, nil
+}
+
+func (r *memoryUserRepository) Create(ctx context.Context, user *models.User) error {
+	user.Email = utils.NormalizeEmail(user.Email)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.users {
+		if existing.Email == user.Email {
+			return ErrDuplicate
+		}
+		if user.ProviderID != "" && hasIdentity(existing, user.Provider, user.ProviderID) {
+			return ErrDuplicate
+		}
+		for _, identity := range user.Identities {
+			if hasIdentity(existing, identity.Provider, identity.ProviderID) {
+				return ErrDuplicate
+			}
+		}
+	}
+
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
+	r.users[user.ID] = copyUser(*user)
+	return nil
+}
+
+func (r *memoryUserRepository) Update(ctx context.Context, id string, update UserUpdate) (models.User, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.User{}, ErrNotFound
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[objectID]
+	if !ok {
+		return models.User{}, ErrNotFound
+	}
+
+	if update.Email != nil {
+		email := utils.NormalizeEmail(*update.Email)
+		for otherID, other := range r.users {
+			if otherID != objectID && other.Email == email {
+				return models.User{}, ErrDuplicate
+			}
+		}
+		user.Email = email
+	}
+	if update.Password != nil {
+		user.Password = *update.Password
+	}
+	if update.Role != nil {
+		user.Role = *update.Role
+	}
+	if update.EmailVerified != nil {
+		user.EmailVerified = *update.EmailVerified
+	}
+	if update.Disabled != nil {
+		user.Disabled = *update.Disabled
+	}
+	if update.ProviderID != nil {
+		user.ProviderID = *update.ProviderID
+	}
+	if update.DisplayName != nil {
+		user.Profile.DisplayName = *update.DisplayName
+	}
+	if update.AvatarURL != nil {
+		user.Profile.AvatarURL = *update.AvatarURL
+	}
+	if update.Locale != nil {
+		user.Profile.Locale = *update.Locale
+	}
+	if update.Timezone != nil {
+		user.Profile.Timezone = *update.Timezone
+	}
+	user.UpdatedAt = time.Now()
+
+	r.users[objectID] = user
+	return copyUser(user), nil
+}
+
+func (r *memoryUserRepository) Delete(ctx context.Context, id string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.users[objectID]; !ok {
+		return ErrNotFound
+	}
+	delete(r.users, objectID)
+	return nil
+}
+
+func (r *memoryUserRepository) AddIdentity(ctx context.Context, id string, identity models.Identity) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[objectID]
+	if !ok {
+		return ErrConflict
+	}
+	for _, linked := range user.Identities {
+		if linked.Provider == identity.Provider {
+			return ErrConflict
+		}
+	}
+	for otherID, other := range r.users {
+		if otherID != objectID && hasIdentity(other, identity.Provider, identity.ProviderID) {
+			return ErrDuplicate
+		}
+	}
+
+	user.Identities = append(append([]models.Identity(nil), user.Identities...), identity)
+	user.UpdatedAt = time.Now()
+	r.users[objectID] = user
+	return nil
+}
+
+func (r *memoryUserRepository) RemoveIdentity(ctx context.Context, id, provider string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[objectID]
+	if !ok {
+		return nil
+	}
+	identities := []models.Identity{}
+	for _, identity := range user.Identities {
+		if identity.Provider != provider {
+			identities = append(identities, identity)
+		}
+	}
+	user.Identities = identities
+	user.UpdatedAt = time.Now()
+	r.users[objectID] = user
+	return nil
+}
+
+func (r *memoryUserRepository) SetMFA(ctx context.Context, id string, mfa *models.MFA) error {
+	return r.modify(id, func(user *models.User) error {
+		if mfa != nil {
+			copied := *mfa
+			mfa = &copied
+		}
+		user.MFA = mfa
+		user.UpdatedAt = time.Now()
+		return nil
+	})
+}
+
+func (r *memoryUserRepository) UseTOTPStep(ctx context.Context, id string, step int64) error {
+	err := r.modify(id, func(user *models.User) error {
+		if user.MFA == nil || !user.MFA.Enabled || user.MFA.LastTOTPStep >= step {
+			return ErrConflict
+		}
+		user.MFA.LastTOTPStep = step
+		return nil
+	})
+	if err == ErrNotFound {
+		return ErrConflict
+	}
+	return err
+}
+
+func (r *memoryUserRepository) UseRecoveryCode(ctx context.Context, id, codeHash string) error {
+	return r.modify(id, func(user *models.User) error {
+		if user.MFA == nil || !user.MFA.Enabled {
+			return ErrNotFound
+		}
+		for i, hash := range user.MFA.RecoveryCodeHashes {
+			if hash == codeHash {
+				user.MFA.RecoveryCodeHashes = append(user.MFA.RecoveryCodeHashes[:i:i], user.MFA.RecoveryCodeHashes[i+1:]...)
+				return nil
+			}
+		}
+		return ErrNotFound
+	})
+}
+
+func (r *memoryUserRepository) FindByWebAuthnCredential(ctx context.Context, credentialID []byte) (models.User, error) {
+	return r.findFirst(func(user models.User) bool { return webAuthnCredentialIndex(user, credentialID) >= 0 })
+}
+
+func (r *memoryUserRepository) AddWebAuthnCredential(ctx context.Context, id string, credential models.WebAuthnCredential) error {
+	return r.modify(id, func(user *models.User) error {
+		// modify holds the lock, so this check and the append below are atomic
+		for _, other := range r.users {
+			if webAuthnCredentialIndex(other, credential.ID) >= 0 {
+				return ErrDuplicate
+			}
+		}
+		user.WebAuthn = append(user.WebAuthn, credential)
+		user.UpdatedAt = time.Now()
+		return nil
+	})
+}
+
+func (r *memoryUserRepository) UpdateWebAuthnCredential(ctx context.Context, id string, credential models.WebAuthnCredential) error {
+	return r.modify(id, func(user *models.User) error {
+		i := webAuthnCredentialIndex(*user, credential.ID)
+		if i < 0 {
+			return ErrNotFound
+		}
+		user.WebAuthn[i] = credential
+		return nil
+	})
+}
+
+func (r *memoryUserRepository) RemoveWebAuthnCredential(ctx context.Context, id string, credentialID []byte) error {
+	return r.modify(id, func(user *models.User) error {
+		i := webAuthnCredentialIndex(*user, credentialID)
+		if i < 0 {
+			return ErrNotFound
+		}
+		user.WebAuthn = append(user.WebAuthn[:i:i], user.WebAuthn[i+1:]...)
+		user.UpdatedAt = time.Now()
+		return nil
+	})
+}
+
+// modify applies change to a copy of the stored user and saves it unless change fails
+func (r *memoryUserRepository) modify(id string, change func(user *models.User) error) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[objectID]
+	if !ok {
+		return ErrNotFound
+	}
+	user = copyUser(user)
+	if err := change(&user); err != nil {
+		return err
+	}
+	r.users[objectID] = user
+	return nil
+}
+
+func (r *memoryUserRepository) findFirst(match func(models.User) bool) (models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, user := range r.users {
+		if match(user) {
+			return copyUser(user), nil
+		}
+	}
+	return models.User{}, ErrNotFound
+}
+
+func webAuthnCredentialIndex(user models.User, credentialID []byte) int {
+	for i, credential := range user.WebAuthn {
+		if bytes.Equal(credential.ID, credentialID) {
+			return i
+		}
+	}
+	return -1
+}
+
+// hasIdentity matches a linked identity or the provider/provider_id the account was created with
+func hasIdentity(user models.User, provider, providerID string) bool {
+	if user.Provider == provider && user.ProviderID == providerID {
+		return true
+	}
+	for _, identity := range user.Identities {
+		if identity.Provider == provider && identity.ProviderID == providerID {
+			return true
+		}
+	}
+	return false
+}
+
+// copyUser keeps callers from mutating stored identities, credentials or MFA settings through shared references
+func copyUser(user models.User) models.User {
+	if user.Identities != nil {
+		user.Identities = append([]models.Identity(nil), user.Identities...)
+	}
+	if user.WebAuthn != nil {
+		user.WebAuthn = append([]models.WebAuthnCredential(nil), user.WebAuthn...)
+	}
+	if user.MFA != nil {
+		mfa := *user.MFA
+		mfa.RecoveryCodeHashes = append([]string(nil), mfa.RecoveryCodeHashes...)
+		user.MFA = &mfa
+	}
+	return user
+}
+
+// compareUsers orders users by one of the sort fields accepted by models.ListUsersQuery
+func compareUsers(a, b models.User, field string) int {
+	switch field {
+	case "email":
+		return strings.Compare(a.Email, b.Email)
+	case "role":
+		return strings.Compare(string(a.Role), string(b.Role))
+	case "provider":
+		return strings.Compare(a.Provider, b.Provider)
+	case "updated_at":
+		return a.UpdatedAt.Compare(b.UpdatedAt)
+	default:
+		return a.CreatedAt.Compare(b.CreatedAt)
+	}
+}
@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"lem-be/models"
+)
+
+type memoryWebAuthnSessionRepository struct {
+	mu       sync.Mutex
+	sessions map[string]models.WebAuthnSession
+}
+
+func NewMemoryWebAuthnSessionRepository() WebAuthnSessionRepository {
+	return &memoryWebAuthnSessionRepository{sessions: map[string]models.WebAuthnSession{}}
+}
+
+func (r *memoryWebAuthnSessionRepository) Save(ctx context.Context, session models.WebAuthnSession) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.sessions[session.ID]; ok {
+		return ErrDuplicate
+	}
+	r.sessions[session.ID] = session
+	return nil
+}
+
+func (r *memoryWebAuthnSessionRepository) Take(ctx context.Context, id string) (models.WebAuthnSession, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	session, ok := r.sessions[id]
+	if !ok {
+		return models.WebAuthnSession{}, ErrNotFound
+	}
+	delete(r.sessions, id)
+	if !session.ExpiresAt.After(time.Now()) {
+		return models.WebAuthnSession{}, ErrNotFound
+	}
+	return session, nil
+}
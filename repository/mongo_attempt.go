@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"lem-be/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoAttemptRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoAttemptRepository(db *mongo.Database) AttemptRepository {
+	return &mongoAttemptRepository{collection: db.Collection("failed_attempts")}
+}
+
+func (r *mongoAttemptRepository) Find(ctx context.Context, key string) (models.FailedAttempt, error) {
+	var attempt models.FailedAttempt
+	err := r.collection.FindOne(ctx, bson.M{"key": key}).Decode(&attempt)
+	if err == mongo.ErrNoDocuments {
+		return models.FailedAttempt{}, ErrNotFound
+	}
+	return attempt, err
+}
+
+func (r *mongoAttemptRepository) DeleteExpired(ctx context.Context, key string, now time.Time) error {
+	_, err := r.collection.DeleteOne(ctx, bson.M{"key": key, "expires_at": bson.M{"$lte": now}})
+	return err
+}
+
+func (r *mongoAttemptRepository) IncrementFailure(ctx context.Context, key string, at, expiresAt time.Time) (models.FailedAttempt, error) {
+	var attempt models.FailedAttempt
+	err := r.collection.FindOneAndUpdate(ctx,
+		bson.M{"key": key},
+		bson.M{
+			"$inc": bson.M{"failures": 1},
+			"$set": bson.M{"last_failure_at": at, "expires_at": expiresAt},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&attempt)
+	return attempt, err
+}
+
+func (r *mongoAttemptRepository) DecrementFailure(ctx context.Context, key string) error {
+	_, err := r.collection.UpdateOne(ctx,
+		bson.M{"key": key, "failures": bson.M{"$gt": 0}},
+		bson.M{"$inc": bson.M{"failures": -1}},
+	)
+	return err
+}
+
+func (r *mongoAttemptRepository) SetBlock(ctx context.Context, key string, blockedUntil, expiresAt time.Time) error {
+	_, err := r.collection.UpdateOne(ctx,
+		bson.M{"key": key},
+		bson.M{"$set": bson.M{"blocked_until": blockedUntil, "expires_at": expiresAt}},
+	)
+	return err
+}
+
+func (r *mongoAttemptRepository) Delete(ctx context.Context, key string) error {
+	_, err := r.collection.DeleteOne(ctx, bson.M{"key": key})
+	return err
+}
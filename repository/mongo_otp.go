@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"lem-be/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoOTPRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoOTPRepository(db *mongo.Database) OTPRepository {
+	return &mongoOTPRepository{collection: db.Collection("otps")}
+}
+
+func (r *mongoOTPRepository) Find(ctx context.Context, email, purpose string) (models.OTPRecord, error) {
+	var record models.OTPRecord
+	err := r.collection.FindOne(ctx, bson.M{"email": email, "purpose": purpose}).Decode(&record)
+	if err == mongo.ErrNoDocuments {
+		return models.OTPRecord{}, ErrNotFound
+	}
+	return record, err
+}
+
+func (r *mongoOTPRepository) Save(ctx context.Context, record models.OTPRecord) error {
+	_, err := r.collection.UpdateOne(ctx,
+		bson.M{"email": record.Email, "purpose": record.Purpose},
+		bson.M{"$set": record},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+func (r *mongoOTPRepository) IncrementAttempts(ctx context.Context, email, purpose string, maxAttempts int) (models.OTPRecord, error) {
+	var record models.OTPRecord
+	err := r.collection.FindOneAndUpdate(ctx,
+		bson.M{
+			"email":      email,
+			"purpose":    purpose,
+			"attempts":   bson.M{"$lt": maxAttempts},
+			"expires_at": bson.M{"$gt": time.Now()},
+		},
+		bson.M{"$inc": bson.M{"attempts": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&record)
+	if err == mongo.ErrNoDocuments {
+		return models.OTPRecord{}, ErrNotFound
+	}
+	return record, err
+}
+
+func (r *mongoOTPRepository) Delete(ctx context.Context, email, purpose string) error {
+	_, err := r.collection.DeleteOne(ctx, bson.M{"email": email, "purpose": purpose})
+	return err
+}
+
+func (r *mongoOTPRepository) Consume(ctx context.Context, email, purpose, codeHash string, maxAttempts int) error {
+	result, err := r.collection.DeleteOne(ctx, bson.M{
+		"email":     email,
+		"purpose":   purpose,
+		"code_hash": codeHash,
+		"attempts":  bson.M{"$lte": maxAttempts},
+	})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"context"
+
+	"lem-be/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type mongoSigningKeyRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoSigningKeyRepository(db *mongo.Database) SigningKeyRepository {
+	return &mongoSigningKeyRepository{collection: db.Collection("signing_keys")}
+}
+
+func (r *mongoSigningKeyRepository) List(ctx context.Context) ([]models.SigningKeyRecord, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	var records []models.SigningKeyRecord
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func (r *mongoSigningKeyRepository) Create(ctx context.Context, record models.SigningKeyRecord) error {
+	_, err := r.collection.InsertOne(ctx, record)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (r *mongoSigningKeyRepository) Delete(ctx context.Context, id string) error {
+	_, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"lem-be/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoRefreshTokenRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoRefreshTokenRepository(db *mongo.Database) RefreshTokenRepository {
+	return &mongoRefreshTokenRepository{collection: db.Collection("refresh_tokens")}
+}
+
+func (r *mongoRefreshTokenRepository) Create(ctx context.Context, record models.RefreshTokenRecord) error {
+	_, err := r.collection.InsertOne(ctx, record)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (r *mongoRefreshTokenRepository) FindByJTI(ctx context.Context, jti string) (models.RefreshTokenRecord, error) {
+	var record models.RefreshTokenRecord
+	err := r.collection.FindOne(ctx, bson.M{"jti": jti}).Decode(&record)
+	if err == mongo.ErrNoDocuments {
+		return models.RefreshTokenRecord{}, ErrNotFound
+	}
+	return record, err
+}
+
+func (r *mongoRefreshTokenRepository) MarkUsed(ctx context.Context, jti string, at time.Time) (models.RefreshTokenRecord, error) {
+	var record models.RefreshTokenRecord
+	err := r.collection.FindOneAndUpdate(ctx,
+		bson.M{"jti": jti, "used_at": nil, "revoked_at": nil},
+		bson.M{"$set": bson.M{"used_at": at}},
+	).Decode(&record)
+	if err == mongo.ErrNoDocuments {
+		return models.RefreshTokenRecord{}, ErrNotFound
+	}
+	return record, err
+}
+
+func (r *mongoRefreshTokenRepository) RevokeFamily(ctx context.Context, familyID string, at time.Time) error {
+	_, err := r.collection.UpdateMany(ctx,
+		bson.M{"family_id": familyID, "revoked_at": nil},
+		bson.M{"$set": bson.M{"revoked_at": at}},
+	)
+	return err
+}
+
+func (r *mongoRefreshTokenRepository) SetFamilyAuth(ctx context.Context, familyID string, authTime time.Time, amr []string) error {
+	result, err := r.collection.UpdateMany(ctx,
+		bson.M{"family_id": familyID, "revoked_at": nil},
+		bson.M{"$set": bson.M{"auth_time": authTime, "amr": amr}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoRefreshTokenRepository) RevokeUser(ctx context.Context, userID string, at time.Time) error {
+	_, err := r.collection.UpdateMany(ctx,
+		bson.M{"user_id": userID, "revoked_at": nil},
+		bson.M{"$set": bson.M{"revoked_at": at}},
+	)
+	return err
+}
+
+type mongoRevocationRepository struct {
+	tokens *mongo.Collection
+	users  *mongo.Collection
+}
+
+func NewMongoRevocationRepository(db *mongo.Database) RevocationRepository {
+	return &mongoRevocationRepository{
+		tokens: db.Collection("revoked_tokens"),
+		users:  db.Collection("user_revocations"),
+	}
+}
+
+func (r *mongoRevocationRepository) RevokeToken(ctx context.Context, token models.RevokedToken) error {
+	_, err := r.tokens.UpdateOne(ctx,
+		bson.M{"jti": token.JTI},
+		bson.M{"$setOnInsert": token},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// InsertToken relies on the unique jti index, which makes it safe against concurrent use
+func (r *mongoRevocationRepository) InsertToken(ctx context.Context, token models.RevokedToken) error {
+	_, err := r.tokens.InsertOne(ctx, token)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (r *mongoRevocationRepository) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	count, err := r.tokens.CountDocuments(ctx, bson.M{"jti": jti}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (r *mongoRevocationRepository) SetUserRevocation(ctx context.Context, revocation models.UserRevocation) error {
+	// The epoch always moves past the stored one, even if this instance's clock is behind
+	_, err := r.users.UpdateOne(ctx,
+		bson.M{"user_id": revocation.UserID},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{
+			"epoch":      bson.M{"$max": bson.A{bson.M{"$add": bson.A{"$epoch", 1}}, revocation.Epoch}},
+			"expires_at": revocation.ExpiresAt,
+		}}}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+func (r *mongoRevocationRepository) FindUserRevocation(ctx context.Context, userID string) (models.UserRevocation, error) {
+	var revocation models.UserRevocation
+	err := r.users.FindOne(ctx, bson.M{"user_id": userID}).Decode(&revocation)
+	if err == mongo.ErrNoDocuments {
+		return models.UserRevocation{}, ErrNotFound
+	}
+	return revocation, err
+}
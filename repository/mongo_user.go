@@ -0,0 +1,331 @@
+package repository
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"lem-be/models"
+	"lem-be/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoUserRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoUserRepository(db *mongo.Database) UserRepository {
+	return &mongoUserRepository{collection: db.Collection("users")}
+}
+
+func (r *mongoUserRepository) FindByID(ctx context.Context, id string) (models.User, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.User{}, ErrNotFound
+	}
+	return r.findOne(ctx, bson.M{"_id": objectID})
+}
+
+func (r *mongoUserRepository) FindByEmail(ctx context.Context, email string) (models.User, error) {
+	return r.findOne(ctx, bson.M{"email": utils.NormalizeEmail(email)})
+}
+
+func (r *mongoUserRepository) FindByIdentity(ctx context.Context, provider, providerID string) (models.User, error) {
+	return r.findOne(ctx, bson.M{"$or": bson.A{
+		bson.M{"identities": bson.M{"$elemMatch": bson.M{"provider": provider, "provider_id": providerID}}},
+		bson.M{"provider": provider, "provider_id": providerID},
+	}})
+}
+
+func (r *mongoUserRepository) List(ctx context.Context, query models.ListUsersQuery) ([]models.User, int64, error) {
+	filter := bson.M{}
+	if query.Role != "" {
+		filter["role"] = query.Role
+	}
+	if query.Provider != "" {
+		filter["provider"] = query.Provider
+	}
+	if query.EmailPrefix != "" {
+		// Anchored, case-sensitive prefix match so the email index can be used
+		filter["email"] = bson.M{"$regex": "^" + regexp.QuoteMeta(query.EmailPrefix)}
+	}
+
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	order := 1
+	if query.Order == "desc" {
+		order = -1
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: query.Sort, Value: order}, {Key: "_id", Value: order}}).
+		SetSkip(int64((query.Page - 1) * query.PageSize)).
+		SetLimit(int64(query.PageSize))
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	users := []models.User{}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+func (r *mongoUserRepository) Create(ctx context.Context, user *models.User) error {
+	user.Email = utils.NormalizeEmail(user.Email)
+	result, err := r.collection.InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+	user.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (r *mongoUserRepository) Update(ctx context.Context, id string, update UserUpdate) (models.User, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.User{}, ErrNotFound
+	}
+
+	set := bson.M{"updated_at": time.Now()}
+	if update.Email != nil {
+		set["email"] = utils.NormalizeEmail(*update.Email)
+	}
+	if update.Password != nil {
+		set["password"] = *update.Password
+	}
+	if update.Role != nil {
+		set["role"] = *update.Role
+	}
+	if update.EmailVerified != nil {
+		set["email_verified"] = *update.EmailVerified
+	}
+	if update.Disabled != nil {
+		set["disabled"] = *update.Disabled
+	}
+	if update.ProviderID != nil {
+		set["provider_id"] = *update.ProviderID
+	}
+	if update.DisplayName != nil {
+		set["profile.display_name"] = *update.DisplayName
+	}
+	if update.AvatarURL != nil {
+		set["profile.avatar_url"] = *update.AvatarURL
+	}
+	if update.Locale != nil {
+		set["profile.locale"] = *update.Locale
+	}
+	if update.Timezone != nil {
+		set["profile.timezone"] = *update.Timezone
+	}
+
+	var user models.User
+	err = r.collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": objectID},
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return models.User{}, ErrNotFound
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		return models.User{}, ErrDuplicate
+	}
+	return user, err
+}
+
+func (r *mongoUserRepository) Delete(ctx context.Context, id string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": objectID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoUserRepository) AddIdentity(ctx context.Context, id string, identity models.Identity) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": objectID, "identities.provider": bson.M{"$ne": identity.Provider}},
+		bson.M{
+			"$push": bson.M{"identities": identity},
+			"$set":  bson.M{"updated_at": time.Now()},
+		},
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+func (r *mongoUserRepository) RemoveIdentity(ctx context.Context, id, provider string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+	_, err = r.collection.UpdateOne(ctx,
+		bson.M{"_id": objectID},
+		bson.M{
+			"$pull": bson.M{"identities": bson.M{"provider": provider}},
+			"$set":  bson.M{"updated_at": time.Now()},
+		},
+	)
+	return err
+}
+
+func (r *mongoUserRepository) SetMFA(ctx context.Context, id string, mfa *models.MFA) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+	update := bson.M{"$set": bson.M{"mfa": mfa, "updated_at": time.Now()}}
+	if mfa == nil {
+		update = bson.M{"$unset": bson.M{"mfa": ""}, "$set": bson.M{"updated_at": time.Now()}}
+	}
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": objectID}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoUserRepository) UseTOTPStep(ctx context.Context, id string, step int64) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": objectID, "mfa.enabled": true, "mfa.last_totp_step": bson.M{"$not": bson.M{"$gte": step}}},
+		bson.M{"$set": bson.M{"mfa.last_totp_step": step}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+func (r *mongoUserRepository) UseRecoveryCode(ctx context.Context, id, codeHash string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": objectID, "mfa.enabled": true, "mfa.recovery_code_hashes": codeHash},
+		bson.M{"$pull": bson.M{"mfa.recovery_code_hashes": codeHash}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoUserRepository) FindByWebAuthnCredential(ctx context.Context, credentialID []byte) (models.User, error) {
+	return r.findOne(ctx, bson.M{"webauthn_credentials.id": credentialID})
+}
+
+func (r *mongoUserRepository) AddWebAuthnCredential(ctx context.Context, id string, credential models.WebAuthnCredential) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": objectID},
+		bson.M{
+			"$push": bson.M{"webauthn_credentials": credential},
+			"$set":  bson.M{"updated_at": time.Now()},
+		},
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoUserRepository) UpdateWebAuthnCredential(ctx context.Context, id string, credential models.WebAuthnCredential) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": objectID, "webauthn_credentials.id": credential.ID},
+		bson.M{"$set": bson.M{"webauthn_credentials.$": credential}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoUserRepository) RemoveWebAuthnCredential(ctx context.Context, id string, credentialID []byte) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": objectID, "webauthn_credentials.id": credentialID},
+		bson.M{
+			"$pull": bson.M{"webauthn_credentials": bson.M{"id": credentialID}},
+			"$set":  bson.M{"updated_at": time.Now()},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoUserRepository) findOne(ctx context.Context, filter bson.M) (models.User, error) {
+	var user models.User
+	err := r.collection.FindOne(ctx, filter).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return models.User{}, ErrNotFound
+	}
+	return user, err
+}
@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"lem-be/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type mongoWebAuthnSessionRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoWebAuthnSessionRepository(db *mongo.Database) WebAuthnSessionRepository {
+	return &mongoWebAuthnSessionRepository{collection: db.Collection("webauthn_sessions")}
+}
+
+func (r *mongoWebAuthnSessionRepository) Save(ctx context.Context, session models.WebAuthnSession) error {
+	_, err := r.collection.InsertOne(ctx, session)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+// Take filters on expires_at because the TTL monitor only removes expired sessions about once a minute
+func (r *mongoWebAuthnSessionRepository) Take(ctx context.Context, id string) (models.WebAuthnSession, error) {
+	var session models.WebAuthnSession
+	err := r.collection.FindOneAndDelete(ctx,
+		bson.M{"session_id": id, "expires_at": bson.M{"$gt": time.Now()}},
+	).Decode(&session)
+	if err == mongo.ErrNoDocuments {
+		return models.WebAuthnSession{}, ErrNotFound
+	}
+	return session, err
+}
@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"lem-be/constants"
+	"lem-be/models"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrNotFound  = errors.New("record not found")
+	ErrDuplicate = errors.New("record already exists")
+	ErrConflict  = errors.New("record was not in the expected state")
+)
+
+// UserUpdate lists the user fields to change; nil fields are left alone. updated_at is always set.
+type UserUpdate struct {
+	Email         *string
+	Password      *string
+	Role          *constants.Role
+	EmailVerified *bool
+	Disabled      *bool
+	ProviderID    *string
+	DisplayName   *string
+	AvatarURL     *string
+	Locale        *string
+	Timezone      *string
+}
+
+// UserRepository stores users and their linked identities
+type UserRepository interface {
+	FindByID(ctx context.Context, id string) (models.User, error)
+	FindByEmail(ctx context.Context, email string) (models.User, error)
+	// FindByIdentity matches linked identities as well as the provider/provider_id the account was created with
+	FindByIdentity(ctx context.Context, provider, providerID string) (models.User, error)
+	// List returns one page of users matching query, whose paging and sort fields must already be defaulted
+	List(ctx context.Context, query models.ListUsersQuery) ([]models.User, int64, error)
+	// Create inserts the user and sets its ID; ErrDuplicate if the email or an identity is taken
+	Create(ctx context.Context, user *models.User) error
+	// Update returns ErrDuplicate if the new email is taken
+	Update(ctx context.Context, id string, update UserUpdate) (models.User, error)
+	Delete(ctx context.Context, id string) error
+	// AddIdentity links identity unless the user already has one for that provider (ErrConflict)
+	AddIdentity(ctx context.Context, id string, identity models.Identity) error
+	RemoveIdentity(ctx context.Context, id, provider string) error
+	// SetMFA replaces the user's second factor; nil removes it
+	SetMFA(ctx context.Context, id string, mfa *models.MFA) error
+	// UseTOTPStep records step as used unless it is not newer than the last used one (ErrConflict)
+	UseTOTPStep(ctx context.Context, id string, step int64) error
+	// UseRecoveryCode removes the recovery code with codeHash so it works once (ErrNotFound otherwise)
+	UseRecoveryCode(ctx context.Context, id, codeHash string) error
+	FindByWebAuthnCredential(ctx context.Context, credentialID []byte) (models.User, error)
+	// AddWebAuthnCredential registers a credential; ErrDuplicate if its ID is registered to any user
+	AddWebAuthnCredential(ctx context.Context, id string, credential models.WebAuthnCredential) error
+	// UpdateWebAuthnCredential replaces the stored credential with the same ID (ErrNotFound if absent)
+	UpdateWebAuthnCredential(ctx context.Context, id string, credential models.WebAuthnCredential) error
+	RemoveWebAuthnCredential(ctx context.Context, id string, credentialID []byte) error
+}
+
+// WebAuthnSessionRepository stores the challenges of in-flight WebAuthn ceremonies
+type WebAuthnSessionRepository interface {
+	Save(ctx context.Context, session models.WebAuthnSession) error
+	// Take deletes and returns the session so its challenge is answered once (ErrNotFound if absent or expired)
+	Take(ctx context.Context, id string) (models.WebAuthnSession, error)
+}
+
+// OTPRepository stores at most one pending code per email and purpose
+type OTPRepository interface {
+	Find(ctx context.Context, email, purpose string) (models.OTPRecord, error)
+	// Save replaces any pending code for the record's email and purpose
+	Save(ctx context.Context, record models.OTPRecord) error
+	// IncrementAttempts counts a guess and returns the updated record, but only while the code is unexpired
+	// and has fewer than maxAttempts guesses; ErrNotFound means no guess is left
+	IncrementAttempts(ctx context.Context, email, purpose string, maxAttempts int) (models.OTPRecord, error)
+	Delete(ctx context.Context, email, purpose string) error
+	// Consume deletes the code only if it still has codeHash and at most maxAttempts guesses,
+	// so it can be redeemed once (ErrNotFound otherwise)
+	Consume(ctx context.Context, email, purpose, codeHash string, maxAttempts int) error
+}
+
+// RefreshTokenRepository stores issued refresh tokens for rotation and reuse detection
+type RefreshTokenRepository interface {
+	Create(ctx context.Context, record models.RefreshTokenRecord) error
+	FindByJTI(ctx context.Context, jti string) (models.RefreshTokenRecord, error)
+	// MarkUsed atomically marks an unused, unrevoked token as used (ErrNotFound otherwise)
+	MarkUsed(ctx context.Context, jti string, at time.Time) (models.RefreshTokenRecord, error)
+	RevokeFamily(ctx context.Context, familyID string, at time.Time) error
+	// SetFamilyAuth records a re-authentication on the unrevoked tokens of a session (ErrNotFound if there are none)
+	SetFamilyAuth(ctx context.Context, familyID string, authTime time.Time, amr []string) error
+	RevokeUser(ctx context.Context, userID string, at time.Time) error
+}
+
+// RevocationRepository stores revoked access tokens and user-wide revocation epochs
+type RevocationRepository interface {
+	// RevokeToken records the token; revoking it again is a no-op
+	RevokeToken(ctx context.Context, token models.RevokedToken) error
+	// InsertToken records the token, failing with ErrDuplicate if it is already recorded
+	InsertToken(ctx context.Context, token models.RevokedToken) error
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
+	// SetUserRevocation raises the user's epoch past the stored one and to at least revocation.Epoch
+	SetUserRevocation(ctx context.Context, revocation models.UserRevocation) error
+	FindUserRevocation(ctx context.Context, userID string) (models.UserRevocation, error)
+}
+
+// AttemptRepository stores failed attempt counters per throttling key
+type AttemptRepository interface {
+	Find(ctx context.Context, key string) (models.FailedAttempt, error)
+	// DeleteExpired removes the key's counter if it expired at or before now
+	DeleteExpired(ctx context.Context, key string, now time.Time) error
+	// IncrementFailure counts a failure, creating the counter if needed, and returns the updated counter
+	IncrementFailure(ctx context.Context, key string, at, expiresAt time.Time) (models.FailedAttempt, error)
+	// DecrementFailure takes back one failure counted by IncrementFailure
+	DecrementFailure(ctx context.Context, key string) error
+	SetBlock(ctx context.Context, key string, blockedUntil, expiresAt time.Time) error
+	Delete(ctx context.Context, key string) error
+}
+
+// SigningKeyRepository stores the JWT signing keys shared by every instance
+type SigningKeyRepository interface {
+	List(ctx context.Context) ([]models.SigningKeyRecord, error)
+	// Create returns ErrDuplicate if another key already replaces record.SuccessorOf
+	Create(ctx context.Context, record models.SigningKeyRecord) error
+	Delete(ctx context.Context, id string) error
+}
+
+// Repositories bundles every repository the services depend on
+type Repositories struct {
+	Users         UserRepository
+	OTPs          OTPRepository
+	RefreshTokens RefreshTokenRepository
+	Revocations   RevocationRepository
+	Attempts      AttemptRepository
+	WebAuthn      WebAuthnSessionRepository
+	SigningKeys   SigningKeyRepository
+}
+
+// NewMongoRepositories returns repositories backed by db
+func NewMongoRepositories(db *mongo.Database) *Repositories {
+	return &Repositories{
+		Users:         NewMongoUserRepository(db),
+		OTPs:          NewMongoOTPRepository(db),
+		RefreshTokens: NewMongoRefreshTokenRepository(db),
+		Revocations:   NewMongoRevocationRepository(db),
+		Attempts:      NewMongoAttemptRepository(db),
+		WebAuthn:      NewMongoWebAuthnSessionRepository(db),
+		SigningKeys:   NewMongoSigningKeyRepository(db),
+	}
+}
+
+// NewMemoryRepositories returns empty in-process repositories, e.g. for tests
+func NewMemoryRepositories() *Repositories {
+	return &Repositories{
+		Users:         NewMemoryUserRepository(),
+		OTPs:          NewMemoryOTPRepository(),
+		RefreshTokens: NewMemoryRefreshTokenRepository(),
+		Revocations:   NewMemoryRevocationRepository(),
+		Attempts:      NewMemoryAttemptRepository(),
+		WebAuthn:      NewMemoryWebAuthnSessionRepository(),
+		SigningKeys:   NewMemorySigningKeyRepository(),
+	}
+}
@@ -2,7 +2,14 @@ package router
 
 import (
 	"bytes"
+	"fmt"
 	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"lem-be/constants"
+	"lem-be/utils"
 
 	"github.com/gin-gonic/gin"
 	"go.opentelemetry.io/otel/attribute"
@@ -67,3 +74,90 @@ func TraceLogger() gin.HandlerFunc {
 		)
 	}
 }
+
+// RequireAuth validates the "Authorization: Bearer" access token and stores its claims in the context
+func RequireAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		log := utils.NewLogger("AuthMiddleware", "RequireAuth").WithContext(c.Request.Context())
+
+		token, ok := utils.ExtractBearerToken(c.GetHeader("Authorization"))
+		if !ok {
+			abortUnauthorized(c, "Missing bearer token")
+			return
+		}
+
+		claims, err := utils.ValidateToken(token)
+		if err != nil {
+			log.Warnf("Rejected access token: %v", err)
+			abortUnauthorized(c, "Invalid or expired access token")
+			return
+		}
+		if claims.TokenType != utils.TokenTypeAccess {
+			log.Warnf("Rejected %q token used as access token for user %s", claims.TokenType, claims.UserID)
+			abortUnauthorized(c, "Invalid or expired access token")
+			return
+		}
+
+		c.Set(constants.ClaimsContextKey, claims)
+		c.Next()
+	}
+}
+
+// RequireRole allows the request if the caller's role is at least one of the given roles
+// in the super_admin > admin > user hierarchy. It must run after RequireAuth.
+func RequireRole(roles ...constants.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, exists := c.Get(constants.ClaimsContextKey)
+		claims, ok := value.(*utils.JWTClaims)
+		if !exists || !ok {
+			abortUnauthorized(c, "Missing bearer token")
+			return
+		}
+
+		for _, role := range roles {
+			if claims.Role.AtLeast(role) {
+				c.Next()
+				return
+			}
+		}
+
+		utils.NewLogger("AuthMiddleware", "RequireRole").WithContext(c.Request.Context()).
+			Warnf("User %s with role %s denied access to %s", claims.UserID, claims.Role, c.FullPath())
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+	}
+}
+
+// RequireRecentAuth allows the request if the caller authenticated within maxAge and, when methods
+// are given, with at least one of them (amr values). Otherwise the client must call /me/reauth
+// and retry with the new access token. It must run after RequireAuth.
+func RequireRecentAuth(maxAge time.Duration, methods ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, exists := c.Get(constants.ClaimsContextKey)
+		claims, ok := value.(*utils.JWTClaims)
+		if !exists || !ok {
+			abortUnauthorized(c, "Missing bearer token")
+			return
+		}
+
+		recent := claims.AuthTime != nil && time.Since(claims.AuthTime.Time) <= maxAge
+		if recent && (len(methods) == 0 || slices.ContainsFunc(methods, func(m string) bool { return slices.Contains(claims.AMR, m) })) {
+			c.Next()
+			return
+		}
+
+		utils.NewLogger("AuthMiddleware", "RequireRecentAuth").WithContext(c.Request.Context()).
+			Warnf("User %s needs to re-authenticate for %s", claims.UserID, c.FullPath())
+		// RFC 9470 step-up challenge
+		c.Header("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_user_authentication", error_description="A more recent authentication is required", max_age=%d`, int(maxAge.Seconds())))
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error":           "Re-authentication required",
+			"reauth_required": true,
+			"max_age":         int(maxAge.Seconds()),
+		})
+	}
+}
+
+func abortUnauthorized(c *gin.Context, details string) {
+	c.Header("WWW-Authenticate", `Bearer realm="api"`)
+	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized", "details": details})
+}
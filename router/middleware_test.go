@@ -0,0 +1,76 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"lem-be/constants"
+	"lem-be/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// stepUpStatus runs a request with the given claims through RequireRecentAuth
+func stepUpStatus(t *testing.T, claims *utils.JWTClaims, maxAge time.Duration, methods ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.POST("/sensitive", func(c *gin.Context) {
+		c.Set(constants.ClaimsContextKey, claims)
+	}, RequireRecentAuth(maxAge, methods...), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/sensitive", nil))
+	return recorder
+}
+
+func TestRequireRecentAuth(t *testing.T) {
+	at := func(ago time.Duration) *jwt.NumericDate { return jwt.NewNumericDate(time.Now().Add(-ago)) }
+	tests := []struct {
+		name    string
+		claims  *utils.JWTClaims
+		methods []string
+		allowed bool
+	}{
+		{"recent", &utils.JWTClaims{AuthTime: at(time.Minute), AMR: []string{utils.AMRPassword}}, nil, true},
+		{"stale", &utils.JWTClaims{AuthTime: at(10 * time.Minute), AMR: []string{utils.AMRPassword}}, nil, false},
+		{"no auth_time", &utils.JWTClaims{AMR: []string{utils.AMRPassword}}, nil, false},
+		{"required method", &utils.JWTClaims{AuthTime: at(time.Minute), AMR: []string{utils.AMRPassword, utils.AMROTP}}, []string{utils.AMROTP, utils.AMRHardwareKey}, true},
+		{"other method", &utils.JWTClaims{AuthTime: at(time.Minute), AMR: []string{utils.AMRPassword}}, []string{utils.AMROTP}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := stepUpStatus(t, tt.claims, 5*time.Minute, tt.methods...)
+			if tt.allowed {
+				if recorder.Code != http.StatusNoContent {
+					t.Fatalf("status = %d, want %d", recorder.Code, http.StatusNoContent)
+				}
+				return
+			}
+			if recorder.Code != http.StatusUnauthorized {
+				t.Fatalf("status = %d, want %d", recorder.Code, http.StatusUnauthorized)
+			}
+			if challenge := recorder.Header().Get("WWW-Authenticate"); !strings.Contains(challenge, `error="insufficient_user_authentication"`) || !strings.Contains(challenge, "max_age=300") {
+				t.Errorf("WWW-Authenticate = %q, want an insufficient_user_authentication challenge with max_age=300", challenge)
+			}
+		})
+	}
+}
+
+func TestRequireRecentAuthWithoutClaims(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.POST("/sensitive", RequireRecentAuth(time.Minute), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/sensitive", nil))
+	if recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusUnauthorized)
+	}
+}
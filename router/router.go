@@ -3,17 +3,20 @@ package router
 import (
 	"net/http"
 	"os"
+	"time"
 
-	"lem-be/database"
+	"lem-be/constants"
 	"lem-be/handlers"
+	"lem-be/repository"
 	"lem-be/services"
+	"lem-be/utils"
 
 	"github.com/gin-gonic/gin"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
 // Setup initializes and returns the Gin router with all routes configured
-func Setup() *gin.Engine {
+func Setup(repos *repository.Repositories) *gin.Engine {
 	// Set Gin mode from environment
 	if os.Getenv("GIN_MODE") == "release" {
 		gin.SetMode(gin.ReleaseMode)
@@ -37,16 +40,61 @@ func Setup() *gin.Engine {
 		})
 	})
 
+	// Public signing keys for services that verify our tokens
+	jwksHandler := handlers.NewJWKSHandler()
+	router.GET("/.well-known/jwks.json", jwksHandler.HandleJWKS)
+
 	// Initialize services and handlers
-	loginService := services.NewLoginService(database.GetDB())
+	revocationService := services.NewRevocationService(repos.Revocations)
+	tokenService := services.NewTokenService(repos.RefreshTokens, repos.Users, revocationService)
+	tokenHandler := handlers.NewTokenHandler(tokenService)
+
+	loginAccountLimiter := services.NewAttemptLimiter(repos.Attempts, "login-account", services.LoginAccountPolicy())
+	loginIPLimiter := services.NewAttemptLimiter(repos.Attempts, "login-ip", services.LoginIPPolicy())
+	loginService := services.NewLoginService(repos.Users, tokenService, loginAccountLimiter, loginIPLimiter)
 	loginHandler := handlers.NewLoginHandler(loginService)
 
-	googleService := services.NewGoogleService(*database.GetDB())
-	googleHandler := handlers.NewGoogleHandler(googleService)
+	mfaLimiter := services.NewAttemptLimiter(repos.Attempts, "mfa-user", services.MFAPolicy())
+	mfaService := services.NewMFAService(repos.Users, tokenService, revocationService, mfaLimiter)
+	mfaHandler := handlers.NewMFAHandler(mfaService)
+
+	webAuthnService := services.NewWebAuthnService(repos.Users, repos.WebAuthn, tokenService, revocationService, utils.WebAuthnRelyingParty())
+	webAuthnHandler := handlers.NewWebAuthnHandler(webAuthnService)
+
+	oauthService := services.NewOAuthService(repos.Users, tokenService)
+	oauthHandler := handlers.NewOAuthHandler(oauthService)
 
-	passwordResetService := services.NewPasswordResetService(*database.GetDB())
+	otpIPLimiter := services.NewAttemptLimiter(repos.Attempts, "otp-ip", services.OTPIPPolicy())
+	passwordPolicy := services.PasswordStrengthPolicy()
+	passwordResetService := services.NewPasswordResetService(repos.Users, repos.OTPs, otpIPLimiter, tokenService, revocationService, passwordPolicy)
 	passwordResetHandler := handlers.NewPasswordResetHandler(passwordResetService)
 
+	passwordlessService := services.NewPasswordlessService(repos.Users, repos.OTPs, tokenService, otpIPLimiter, services.PasswordlessLoginPolicy())
+	passwordlessHandler := handlers.NewPasswordlessHandler(passwordlessService)
+
+	registrationService := services.NewRegistrationService(repos.Users, repos.OTPs, passwordPolicy)
+	registrationHandler := handlers.NewRegistrationHandler(registrationService)
+
+	profileService := services.NewProfileService(repos.Users)
+	profileHandler := handlers.NewProfileHandler(profileService)
+
+	accountService := services.NewAccountService(repos.Users, repos.OTPs, tokenService)
+	accountHandler := handlers.NewAccountHandler(accountService)
+
+	reauthService := services.NewReauthService(repos.Users, tokenService, mfaService, loginAccountLimiter)
+	reauthHandler := handlers.NewReauthHandler(reauthService)
+
+	changePasswordService := services.NewChangePasswordService(repos.Users, tokenService, loginAccountLimiter, passwordPolicy)
+	changePasswordHandler := handlers.NewChangePasswordHandler(changePasswordService)
+
+	adminUserService := services.NewAdminUserService(repos.Users, tokenService, loginAccountLimiter, passwordPolicy)
+	adminUserHandler := handlers.NewAdminUserHandler(adminUserService)
+
+	signingKeyHandler := handlers.NewSigningKeyHandler(services.NewSigningKeyService(repos.SigningKeys))
+
+	// Sensitive operations need a login or /me/reauth within REAUTH_MAX_AGE
+	stepUp := RequireRecentAuth(utils.GetEnvDuration("REAUTH_MAX_AGE", 5*time.Minute))
+
 	// API v1 routes
 	v1 := router.Group("/api/v1")
 	{
@@ -62,13 +110,71 @@ func Setup() *gin.Engine {
 		// OAuth2 routes
 		authGroup := v1.Group("/auth")
 		{
-			authGroup.GET("/google/login", googleHandler.HandleGoogleLogin)
-			authGroup.GET("/google/callback", googleHandler.HandleGoogleCallback)
+			authGroup.POST("/register", registrationHandler.HandleRegister)
+			authGroup.POST("/verify-email", registrationHandler.HandleVerifyEmail)
+			authGroup.POST("/resend-verification", registrationHandler.HandleResendVerification)
+
+			authGroup.POST("/refresh", tokenHandler.HandleRefresh)
+			authGroup.POST("/logout", RequireAuth(), tokenHandler.HandleLogout)
+			authGroup.POST("/logout-all", RequireAuth(), tokenHandler.HandleLogoutAll)
+
+			// Second step of a login for users with two-factor authentication
+			authGroup.POST("/mfa/verify", mfaHandler.HandleVerify)
+
+			// Passkey login, passwordless or as the second step of a two-factor login
+			authGroup.POST("/webauthn/login/begin", webAuthnHandler.HandleBeginLogin)
+			authGroup.POST("/webauthn/login/finish", webAuthnHandler.HandleFinishLogin)
+
+			// Login providers enabled by configuration; unknown names return 404
+			authGroup.GET("/providers", oauthHandler.HandleListProviders)
+			authGroup.GET("/:provider/login", oauthHandler.HandleLogin)
+			authGroup.GET("/:provider/callback", oauthHandler.HandleCallback)
 
 			// Password reset routes
 			authGroup.POST("/forgot-password", passwordResetHandler.HandleForgotPassword)
 			authGroup.POST("/verify-otp", passwordResetHandler.HandleVerifyOTP)
 			authGroup.POST("/reset-password", passwordResetHandler.HandleResetPassword)
+
+			// Passwordless email login, enabled with PASSWORDLESS_LOGIN
+			authGroup.POST("/passwordless/start", passwordlessHandler.HandleStart)
+			authGroup.POST("/passwordless/verify", passwordlessHandler.HandleVerify)
+		}
+
+		// Current user routes
+		meGroup := v1.Group("/me", RequireAuth())
+		{
+			meGroup.GET("", profileHandler.HandleGetMe)
+			meGroup.PATCH("", profileHandler.HandleUpdateMe)
+			meGroup.POST("/reauth", reauthHandler.HandleReauth)
+			meGroup.DELETE("", stepUp, accountHandler.HandleDeleteAccount)
+			meGroup.POST("/email", stepUp, accountHandler.HandleRequestEmailChange)
+			meGroup.POST("/email/confirm", stepUp, accountHandler.HandleConfirmEmailChange)
+			meGroup.POST("/password", stepUp, changePasswordHandler.HandleChangePassword)
+			meGroup.POST("/identities/:provider", stepUp, oauthHandler.HandleStartLink)
+			meGroup.DELETE("/identities/:provider", stepUp, oauthHandler.HandleUnlink)
+			meGroup.POST("/mfa/totp", stepUp, mfaHandler.HandleBeginTOTP)
+			meGroup.POST("/mfa/totp/confirm", mfaHandler.HandleConfirmTOTP)
+			meGroup.DELETE("/mfa/totp", stepUp, mfaHandler.HandleDisableTOTP)
+			meGroup.GET("/webauthn/credentials", webAuthnHandler.HandleListCredentials)
+			meGroup.POST("/webauthn/register/begin", stepUp, webAuthnHandler.HandleBeginRegistration)
+			meGroup.POST("/webauthn/register/finish", stepUp, webAuthnHandler.HandleFinishRegistration)
+			meGroup.DELETE("/webauthn/credentials/:id", stepUp, webAuthnHandler.HandleDeleteCredential)
+		}
+
+		// Admin routes
+		adminGroup := v1.Group("/admin", RequireAuth(), RequireRole(constants.RoleAdmin))
+		{
+			adminGroup.GET("/users", adminUserHandler.HandleListUsers)
+			adminGroup.POST("/users", adminUserHandler.HandleCreateUser)
+			adminGroup.GET("/users/:id", adminUserHandler.HandleGetUser)
+			adminGroup.PATCH("/users/:id/role", stepUp, adminUserHandler.HandleUpdateUserRole)
+			adminGroup.POST("/users/:id/disable", adminUserHandler.HandleDisableUser)
+			adminGroup.POST("/users/:id/enable", adminUserHandler.HandleEnableUser)
+			adminGroup.POST("/users/:id/unlock", adminUserHandler.HandleUnlockUser)
+			adminGroup.DELETE("/users/:id", stepUp, adminUserHandler.HandleDeleteUser)
+
+			adminGroup.GET("/keys", signingKeyHandler.HandleListKeys)
+			adminGroup.POST("/keys/rotate", signingKeyHandler.HandleRotateKey)
 		}
 	}
 
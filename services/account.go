@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"lem-be/constants"
+	"lem-be/models"
+	"lem-be/repository"
+	"lem-be/utils"
+
+	"go.opentelemetry.io/otel"
+)
+
+var (
+	ErrEmailUnchanged       = errors.New("new email is the current email")
+	ErrSuperAdminSelfDelete = errors.New("super admins cannot delete their own account")
+)
+
+// emailChangeTTL is how long the code sent to a new email address stays valid
+const emailChangeTTL = 30 * time.Minute
+
+// AccountService covers the account changes a user makes for themselves that need a recent authentication
+type AccountService interface {
+	RequestEmailChange(ctx context.Context, userID string, req models.ChangeEmailRequest) error
+	ConfirmEmailChange(ctx context.Context, userID string, req models.ConfirmEmailChangeRequest) (models.User, error)
+	DeleteAccount(ctx context.Context, userID string) error
+}
+
+type accountService struct {
+	users        repository.UserRepository
+	otps         repository.OTPRepository
+	tokenService TokenService
+}
+
+func NewAccountService(users repository.UserRepository, otps repository.OTPRepository, tokenService TokenService) AccountService {
+	return &accountService{users: users, otps: otps, tokenService: tokenService}
+}
+
+// RequestEmailChange sends a code to the new address. The code is bound to the user, so only they can redeem it.
+func (s *accountService) RequestEmailChange(ctx context.Context, userID string, req models.ChangeEmailRequest) error {
+	ctx, span := otel.Tracer("account-service").Start(ctx, "RequestEmailChange")
+	defer span.End()
+
+	log := utils.NewLogger("AccountService", "RequestEmailChange").WithContext(ctx)
+	req.Email = utils.NormalizeEmail(req.Email)
+	user, err := s.findUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if req.Email == user.Email {
+		return ErrEmailUnchanged
+	}
+	if _, err := s.users.FindByEmail(ctx, req.Email); err != repository.ErrNotFound {
+		if err == nil {
+			return ErrEmailAlreadyRegistered
+		}
+		return err
+	}
+
+	code, err := issueOTP(ctx, s.otps, req.Email, models.OTPPurposeEmailChange, userID, emailChangeTTL)
+	if err == ErrOTPCooldown {
+		log.Warnf("Email change code requested again within cooldown for %s, not resending", req.Email)
+		return nil
+	}
+	if err != nil {
+		log.Errorf("Failed to store email change code for %s: %v", req.Email, err)
+		return errors.New("Failed to store confirmation code")
+	}
+
+	if err := utils.SendEmailChangeEmail(req.Email, code, emailChangeTTL); err != nil {
+		log.Errorf("Failed to send email change code to %s: %v", req.Email, err)
+		// Don't fail the request; the user can ask for a new code
+	}
+	log.Infof("User %s asked to change email to %s", userID, req.Email)
+	return nil
+}
+
+// ConfirmEmailChange switches the account to the new address, which the code proves the user controls
+func (s *accountService) ConfirmEmailChange(ctx context.Context, userID string, req models.ConfirmEmailChangeRequest) (models.User, error) {
+	ctx, span := otel.Tracer("account-service").Start(ctx, "ConfirmEmailChange")
+	defer span.End()
+
+	log := utils.NewLogger("AccountService", "ConfirmEmailChange").WithContext(ctx)
+	req.Email = utils.NormalizeEmail(req.Email)
+	if err := consumeOTP(ctx, s.otps, req.Email, models.OTPPurposeEmailChange, userID, req.Code); err != nil {
+		log.Warnf("Invalid email change code from user %s for %s: %v", userID, req.Email, err)
+		if err == ErrOTPDeviceMismatch {
+			return models.User{}, ErrInvalidOTP
+		}
+		return models.User{}, err
+	}
+
+	verified := true
+	user, err := s.users.Update(ctx, userID, repository.UserUpdate{Email: &req.Email, EmailVerified: &verified})
+	if err != nil {
+		switch err {
+		case repository.ErrNotFound:
+			return models.User{}, ErrUserNotFound
+		case repository.ErrDuplicate:
+			return models.User{}, ErrEmailAlreadyRegistered
+		}
+		log.Errorf("Failed to change email of user %s: %v", userID, err)
+		return models.User{}, err
+	}
+
+	log.Infof("User %s changed email to %s", userID, req.Email)
+	return user, nil
+}
+
+// DeleteAccount removes the caller's account and ends all of its sessions
+func (s *accountService) DeleteAccount(ctx context.Context, userID string) error {
+	ctx, span := otel.Tracer("account-service").Start(ctx, "DeleteAccount")
+	defer span.End()
+
+	log := utils.NewLogger("AccountService", "DeleteAccount").WithContext(ctx)
+	user, err := s.findUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	// The super admin is recreated from SUPERUSER_* on the next start, so it must not vanish by accident
+	if user.Role == constants.RoleSuperAdmin {
+		return ErrSuperAdminSelfDelete
+	}
+
+	if err := s.users.Delete(ctx, userID); err != nil && err != repository.ErrNotFound {
+		log.Errorf("Failed to delete user %s: %v", userID, err)
+		return err
+	}
+	if err := s.tokenService.LogoutAll(ctx, userID); err != nil {
+		log.Errorf("Failed to revoke sessions of deleted user %s: %v", userID, err)
+		return err
+	}
+
+	log.Infof("User %s (%s) deleted their account", userID, user.Email)
+	return nil
+}
+
+func (s *accountService) findUser(ctx context.Context, userID string) (models.User, error) {
+	user, err := s.users.FindByID(ctx, userID)
+	if err == repository.ErrNotFound {
+		return models.User{}, ErrUserNotFound
+	}
+	return user, err
+}
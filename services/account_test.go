@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"lem-be/constants"
+	"lem-be/models"
+	"lem-be/repository"
+	"lem-be/utils"
+)
+
+func TestConfirmEmailChange(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.createUser(t, "alice@example.com")
+	service := NewAccountService(env.repos.Users, env.repos.OTPs, env.tokens)
+	ctx := context.Background()
+
+	if err := service.RequestEmailChange(ctx, user.ID.Hex(), models.ChangeEmailRequest{Email: "Alice@New.example"}); err != nil {
+		t.Fatalf("RequestEmailChange: %v", err)
+	}
+	// The emailed code is not visible here, so replace it with a known one bound to the same user
+	t.Setenv("OTP_RESEND_COOLDOWN", "0s")
+	code, err := issueOTP(ctx, env.repos.OTPs, "alice@new.example", models.OTPPurposeEmailChange, user.ID.Hex(), time.Minute)
+	if err != nil {
+		t.Fatalf("issueOTP: %v", err)
+	}
+
+	other := env.createUser(t, "mallory@example.com")
+	if _, err := service.ConfirmEmailChange(ctx, other.ID.Hex(), models.ConfirmEmailChangeRequest{Email: "alice@new.example", Code: code}); !errors.Is(err, ErrInvalidOTP) {
+		t.Fatalf("code redeemed by another user: err = %v, want ErrInvalidOTP", err)
+	}
+	updated, err := service.ConfirmEmailChange(ctx, user.ID.Hex(), models.ConfirmEmailChangeRequest{Email: "alice@new.example", Code: code})
+	if err != nil {
+		t.Fatalf("ConfirmEmailChange: %v", err)
+	}
+	if updated.Email != "alice@new.example" || !updated.EmailVerified {
+		t.Fatalf("user after email change = %s (verified %t), want alice@new.example (verified)", updated.Email, updated.EmailVerified)
+	}
+	if _, err := env.repos.Users.FindByEmail(ctx, "alice@example.com"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("old email still finds the user: err = %v", err)
+	}
+}
+
+func TestRequestEmailChangeRejectsTakenEmail(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.createUser(t, "alice@example.com")
+	env.createUser(t, "bob@example.com")
+	service := NewAccountService(env.repos.Users, env.repos.OTPs, env.tokens)
+
+	if err := service.RequestEmailChange(context.Background(), user.ID.Hex(), models.ChangeEmailRequest{Email: "BOB@example.com"}); !errors.Is(err, ErrEmailAlreadyRegistered) {
+		t.Fatalf("taken email: err = %v, want ErrEmailAlreadyRegistered", err)
+	}
+	if err := service.RequestEmailChange(context.Background(), user.ID.Hex(), models.ChangeEmailRequest{Email: "alice@example.com"}); !errors.Is(err, ErrEmailUnchanged) {
+		t.Fatalf("current email: err = %v, want ErrEmailUnchanged", err)
+	}
+}
+
+func TestDeleteAccount(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.createUser(t, "alice@example.com")
+	session := env.loginUser(t, "alice@example.com")
+	service := NewAccountService(env.repos.Users, env.repos.OTPs, env.tokens)
+
+	if err := service.DeleteAccount(context.Background(), user.ID.Hex()); err != nil {
+		t.Fatalf("DeleteAccount: %v", err)
+	}
+	if _, err := env.repos.Users.FindByID(context.Background(), user.ID.Hex()); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("deleted user still exists: err = %v", err)
+	}
+	if _, err := utils.ValidateToken(session.AccessToken); !errors.Is(err, utils.ErrTokenRevoked) {
+		t.Errorf("access token after deletion: err = %v, want ErrTokenRevoked", err)
+	}
+}
+
+func TestDeleteAccountRefusesSuperAdmin(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.createUser(t, "root@example.com")
+	role := constants.RoleSuperAdmin
+	if _, err := env.repos.Users.Update(context.Background(), user.ID.Hex(), repository.UserUpdate{Role: &role}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	service := NewAccountService(env.repos.Users, env.repos.OTPs, env.tokens)
+	if err := service.DeleteAccount(context.Background(), user.ID.Hex()); !errors.Is(err, ErrSuperAdminSelfDelete) {
+		t.Fatalf("super admin self-delete: err = %v, want ErrSuperAdminSelfDelete", err)
+	}
+}
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"lem-be/constants"
+	"lem-be/models"
+	"lem-be/repository"
+	"lem-be/utils"
+
+	"go.opentelemetry.io/otel"
+)
+
+var (
+	ErrInsufficientPrivileges = errors.New("insufficient privileges for this operation")
+	ErrCannotModifySelf       = errors.New("admins cannot change their own role, status or account")
+	ErrEmailAlreadyRegistered = errors.New("email already registered")
+)
+
+const defaultUsersPageSize = 20
+
+// AdminUserService manages users on behalf of an admin. Every mutating call takes the
+// acting admin's claims so privilege rules are enforced here rather than in handlers:
+// only a super admin may create, promote to, or act on admin-level accounts, and no
+// admin may change their own role, status or account.
+type AdminUserService interface {
+	ListUsers(ctx context.Context, query models.ListUsersQuery) (models.ListUsersResponse, error)
+	GetUser(ctx context.Context, userID string) (models.User, error)
+	CreateUser(ctx context.Context, actor *utils.JWTClaims, req models.CreateUserRequest) (models.User, error)
+	UpdateRole(ctx context.Context, actor *utils.JWTClaims, userID string, role constants.Role) (models.User, error)
+	SetDisabled(ctx context.Context, actor *utils.JWTClaims, userID string, disabled bool) (models.User, error)
+	DeleteUser(ctx context.Context, actor *utils.JWTClaims, userID string) error
+	UnlockUser(ctx context.Context, actor *utils.JWTClaims, userID string) error
+}
+
+type adminUserService struct {
+	users               repository.UserRepository
+	tokenService        TokenService
+	loginAccountLimiter AttemptLimiter
+	passwordPolicy      PasswordPolicy
+}
+
+func NewAdminUserService(users repository.UserRepository, tokenService TokenService, loginAccountLimiter AttemptLimiter, passwordPolicy PasswordPolicy) AdminUserService {
+	return &adminUserService{users: users, tokenService: tokenService, loginAccountLimiter: loginAccountLimiter, passwordPolicy: passwordPolicy}
+}
+
+// ListUsers returns one page of users matching the filters
+func (s *adminUserService) ListUsers(ctx context.Context, query models.ListUsersQuery) (models.ListUsersResponse, error) {
+	ctx, span := otel.Tracer("admin-user-service").Start(ctx, "ListUsers")
+	defer span.End()
+
+	log := utils.NewLogger("AdminUserService", "ListUsers").WithContext(ctx)
+	// Emails are stored lower case, so the prefix must be too
+	query.EmailPrefix = strings.ToLower(query.EmailPrefix)
+	if query.Page == 0 {
+		query.Page = 1
+	}
+	if query.PageSize == 0 {
+		query.PageSize = defaultUsersPageSize
+	}
+	if query.Sort == "" {
+		query.Sort = "created_at"
+	}
+
+	users, total, err := s.users.List(ctx, query)
+	if err != nil {
+		log.Errorf("Failed to list users: %v", err)
+		return models.ListUsersResponse{}, err
+	}
+
+	return models.ListUsersResponse{
+		Users:    users,
+		Page:     query.Page,
+		PageSize: query.PageSize,
+		Total:    total,
+	}, nil
+}
+
+// GetUser returns a single user by ID
+func (s *adminUserService) GetUser(ctx context.Context, userID string) (models.User, error) {
+	ctx, span := otel.Tracer("admin-user-service").Start(ctx, "GetUser")
+	defer span.End()
+
+	return s.findUser(ctx, userID)
+}
+
+// CreateUser provisions a verified local account
+func (s *adminUserService) CreateUser(ctx context.Context, actor *utils.JWTClaims, req models.CreateUserRequest) (models.User, error) {
+	ctx, span := otel.Tracer("admin-user-service").Start(ctx, "CreateUser")
+	defer span.End()
+
+	log := utils.NewLogger("AdminUserService", "CreateUser").WithContext(ctx)
+	req.Email = utils.NormalizeEmail(req.Email)
+	if req.Role.AtLeast(constants.RoleAdmin) && actor.Role != constants.RoleSuperAdmin {
+		log.Warnf("User %s (%s) attempted to create %s account %s", actor.UserID, actor.Role, req.Role, req.Email)
+		return models.User{}, ErrInsufficientPrivileges
+	}
+	if err := s.passwordPolicy.Check(ctx, req.Password, req.Email); err != nil {
+		return models.User{}, err
+	}
+
+	if _, err := s.users.FindByEmail(ctx, req.Email); err != repository.ErrNotFound {
+		if err == nil {
+			return models.User{}, ErrEmailAlreadyRegistered
+		}
+		return models.User{}, err
+	}
+
+	hashedPassword, err := utils.HashPassword(req.Password)
+	if err != nil {
+		return models.User{}, errors.New("Failed to hash password")
+	}
+
+	user := models.User{
+		Email:         req.Email,
+		Password:      hashedPassword,
+		Role:          req.Role,
+		Provider:      "local",
+		EmailVerified: true, // Provisioned by an admin
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	}
+	if err := s.users.Create(ctx, &user); err != nil {
+		if err == repository.ErrDuplicate {
+			return models.User{}, ErrEmailAlreadyRegistered
+		}
+		log.Errorf("Failed to create user %s: %v", req.Email, err)
+		return models.User{}, err
+	}
+
+	log.Infof("User %s created %s account %s", actor.UserID, req.Role, req.Email)
+	return user, nil
+}
+
+// UpdateRole changes a user's role and ends their sessions so the new role takes effect immediately
+func (s *adminUserService) UpdateRole(ctx context.Context, actor *utils.JWTClaims, userID string, role constants.Role) (models.User, error) {
+	ctx, span := otel.Tracer("admin-user-service").Start(ctx, "UpdateRole")
+	defer span.End()
+
+	log := utils.NewLogger("AdminUserService", "UpdateRole").WithContext(ctx)
+	target, err := s.authorizeAction(ctx, actor, userID)
+	if err != nil {
+		return models.User{}, err
+	}
+	// Granting admin-level roles is reserved to super admins as well
+	if role.AtLeast(constants.RoleAdmin) && actor.Role != constants.RoleSuperAdmin {
+		log.Warnf("User %s (%s) attempted to grant %s to %s", actor.UserID, actor.Role, role, userID)
+		return models.User{}, ErrInsufficientPrivileges
+	}
+
+	user, err := s.updateUser(ctx, target.ID.Hex(), repository.UserUpdate{Role: &role})
+	if err != nil {
+		return models.User{}, err
+	}
+	if err := s.tokenService.LogoutAll(ctx, userID); err != nil {
+		log.Errorf("Failed to revoke sessions of user %s after role change: %v", userID, err)
+		return models.User{}, err
+	}
+
+	log.Infof("User %s changed role of %s from %s to %s", actor.UserID, userID, target.Role, role)
+	return user, nil
+}
+
+// SetDisabled disables or re-enables a user. Disabling ends every session of the user.
+func (s *adminUserService) SetDisabled(ctx context.Context, actor *utils.JWTClaims, userID string, disabled bool) (models.User, error) {
+	ctx, span := otel.Tracer("admin-user-service").Start(ctx, "SetDisabled")
+	defer span.End()
+
+	log := utils.NewLogger("AdminUserService", "SetDisabled").WithContext(ctx)
+	target, err := s.authorizeAction(ctx, actor, userID)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	user, err := s.updateUser(ctx, target.ID.Hex(), repository.UserUpdate{Disabled: &disabled})
+	if err != nil {
+		return models.User{}, err
+	}
+	if disabled {
+		if err := s.tokenService.LogoutAll(ctx, userID); err != nil {
+			log.Errorf("Failed to revoke sessions of disabled user %s: %v", userID, err)
+			return models.User{}, err
+		}
+	}
+
+	log.Infof("User %s set disabled=%t on %s", actor.UserID, disabled, userID)
+	return user, nil
+}
+
+// DeleteUser removes a user and ends their sessions
+func (s *adminUserService) DeleteUser(ctx context.Context, actor *utils.JWTClaims, userID string) error {
+	ctx, span := otel.Tracer("admin-user-service").Start(ctx, "DeleteUser")
+	defer span.End()
+
+	log := utils.NewLogger("AdminUserService", "DeleteUser").WithContext(ctx)
+	target, err := s.authorizeAction(ctx, actor, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.users.Delete(ctx, target.ID.Hex()); err != nil && err != repository.ErrNotFound {
+		log.Errorf("Failed to delete user %s: %v", userID, err)
+		return err
+	}
+	if err := s.tokenService.LogoutAll(ctx, userID); err != nil {
+		log.Errorf("Failed to revoke sessions of deleted user %s: %v", userID, err)
+		return err
+	}
+
+	log.Infof("User %s deleted %s (%s)", actor.UserID, userID, target.Email)
+	return nil
+}
+
+// UnlockUser clears the user's failed login attempts and any lockout
+func (s *adminUserService) UnlockUser(ctx context.Context, actor *utils.JWTClaims, userID string) error {
+	ctx, span := otel.Tracer("admin-user-service").Start(ctx, "UnlockUser")
+	defer span.End()
+
+	log := utils.NewLogger("AdminUserService", "UnlockUser").WithContext(ctx)
+	target, err := s.authorizeAction(ctx, actor, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.loginAccountLimiter.Reset(ctx, utils.NormalizeEmail(target.Email)); err != nil {
+		log.Errorf("Failed to unlock user %s: %v", userID, err)
+		return err
+	}
+
+	log.Infof("User %s unlocked %s (%s)", actor.UserID, userID, target.Email)
+	return nil
+}
+
+// authorizeAction loads the target user and checks the actor may modify it
+func (s *adminUserService) authorizeAction(ctx context.Context, actor *utils.JWTClaims, userID string) (models.User, error) {
+	log := utils.NewLogger("AdminUserService", "authorizeAction").WithContext(ctx)
+	if actor.UserID == userID {
+		log.Warnf("User %s attempted to modify their own account", actor.UserID)
+		return models.User{}, ErrCannotModifySelf
+	}
+
+	target, err := s.findUser(ctx, userID)
+	if err != nil {
+		return models.User{}, err
+	}
+	if target.Role.AtLeast(constants.RoleAdmin) && actor.Role != constants.RoleSuperAdmin {
+		log.Warnf("User %s (%s) attempted to modify %s account %s", actor.UserID, actor.Role, target.Role, userID)
+		return models.User{}, ErrInsufficientPrivileges
+	}
+	return target, nil
+}
+
+func (s *adminUserService) findUser(ctx context.Context, userID string) (models.User, error) {
+	user, err := s.users.FindByID(ctx, userID)
+	if err == repository.ErrNotFound {
+		return models.User{}, ErrUserNotFound
+	}
+	return user, err
+}
+
+func (s *adminUserService) updateUser(ctx context.Context, userID string, update repository.UserUpdate) (models.User, error) {
+	user, err := s.users.Update(ctx, userID, update)
+	if err == repository.ErrNotFound {
+		return models.User{}, ErrUserNotFound
+	}
+	return user, err
+}
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"lem-be/models"
+	"lem-be/repository"
+	"lem-be/utils"
+)
+
+var ErrTooManyAttempts = errors.New("too many failed attempts")
+
+// TooManyAttemptsError is returned while a key is backing off or locked out
+type TooManyAttemptsError struct {
+	RetryAfter time.Duration
+}
+
+func (e *TooManyAttemptsError) Error() string {
+	return fmt.Sprintf("too many failed attempts, retry after %s", e.RetryAfter.Round(time.Second))
+}
+
+func (e *TooManyAttemptsError) Is(target error) bool {
+	return target == ErrTooManyAttempts
+}
+
+// AttemptPolicy configures how failures for one kind of key are throttled.
+// Each failure below Threshold blocks the key for BaseDelay doubled per failure (capped at MaxDelay);
+// reaching Threshold locks it for LockoutDuration. Counters are forgotten after Window without failures.
+type AttemptPolicy struct {
+	Threshold       int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	LockoutDuration time.Duration
+	Window          time.Duration
+}
+
+// AttemptLimiter tracks failed attempts per key
+type AttemptLimiter interface {
+	Check(ctx context.Context, key string) error
+	RecordFailure(ctx context.Context, key string) error
+	// Reserve counts an attempt as failed before it is made, so concurrent attempts cannot all pass Check
+	// before any failure is recorded. Call Release once the attempt turns out not to be a failure.
+	Reserve(ctx context.Context, key string) error
+	Release(ctx context.Context, key string) error
+	Reset(ctx context.Context, key string) error
+}
+
+type attemptLimiter struct {
+	attempts repository.AttemptRepository
+	scope    string
+	policy   AttemptPolicy
+}
+
+// NewAttemptLimiter creates a limiter whose keys are namespaced by scope
+func NewAttemptLimiter(attempts repository.AttemptRepository, scope string, policy AttemptPolicy) AttemptLimiter {
+	return &attemptLimiter{attempts: attempts, scope: scope, policy: policy}
+}
+
+// LoginAccountPolicy throttles failed logins per email address
+func LoginAccountPolicy() AttemptPolicy {
+	return AttemptPolicy{
+		Threshold:       utils.GetEnvInt("LOGIN_MAX_FAILED_ATTEMPTS", 5),
+		BaseDelay:       utils.GetEnvDuration("LOGIN_BACKOFF_BASE", time.Second),
+		MaxDelay:        utils.GetEnvDuration("LOGIN_BACKOFF_MAX", 30*time.Second),
+		LockoutDuration: utils.GetEnvDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		Window:          utils.GetEnvDuration("LOGIN_ATTEMPT_WINDOW", time.Hour),
+	}
+}
+
+// LoginIPPolicy throttles failed logins per client IP across all accounts
+func LoginIPPolicy() AttemptPolicy {
+	return AttemptPolicy{
+		Threshold:       utils.GetEnvInt("LOGIN_IP_MAX_FAILED_ATTEMPTS", 50),
+		LockoutDuration: utils.GetEnvDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		Window:          utils.GetEnvDuration("LOGIN_ATTEMPT_WINDOW", time.Hour),
+	}
+}
+
+// Check returns a *TooManyAttemptsError if the key is currently blocked
+func (l *attemptLimiter) Check(ctx context.Context, key string) error {
+	attempt, err := l.attempts.Find(ctx, l.scopedKey(key))
+	if err == repository.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if attempt.BlockedUntil != nil {
+		if remaining := time.Until(*attempt.BlockedUntil); remaining > 0 {
+			return &TooManyAttemptsError{RetryAfter: remaining}
+		}
+	}
+	return nil
+}
+
+// RecordFailure increments the key's failure count and applies backoff or lockout
+func (l *attemptLimiter) RecordFailure(ctx context.Context, key string) error {
+	_, err := l.recordFailure(ctx, key)
+	return err
+}
+
+// Reserve fails with a *TooManyAttemptsError once the reserved attempts exceed the threshold,
+// even if the earlier ones have not finished yet
+func (l *attemptLimiter) Reserve(ctx context.Context, key string) error {
+	if err := l.Check(ctx, key); err != nil {
+		return err
+	}
+	attempt, err := l.recordFailure(ctx, key)
+	if err != nil {
+		return err
+	}
+	if l.policy.Threshold > 0 && attempt.Failures > l.policy.Threshold {
+		return &TooManyAttemptsError{RetryAfter: l.policy.LockoutDuration}
+	}
+	return nil
+}
+
+// Release takes back an attempt counted by Reserve. A lockout the attempt triggered stays in place.
+func (l *attemptLimiter) Release(ctx context.Context, key string) error {
+	return l.attempts.DecrementFailure(ctx, l.scopedKey(key))
+}
+
+func (l *attemptLimiter) recordFailure(ctx context.Context, key string) (models.FailedAttempt, error) {
+	log := utils.NewLogger("AttemptLimiter", "RecordFailure").WithContext(ctx)
+	scopedKey := l.scopedKey(key)
+	now := time.Now()
+
+	// Start counting afresh once the previous window has lapsed
+	if err := l.attempts.DeleteExpired(ctx, scopedKey, now); err != nil {
+		return models.FailedAttempt{}, err
+	}
+
+	attempt, err := l.attempts.IncrementFailure(ctx, scopedKey, now, now.Add(l.policy.Window))
+	if err != nil {
+		return models.FailedAttempt{}, err
+	}
+
+	var block time.Duration
+	if l.policy.Threshold > 0 && attempt.Failures >= l.policy.Threshold {
+		block = l.policy.LockoutDuration
+		log.Warnf("Locking %s for %s after %d failed attempts", scopedKey, block, attempt.Failures)
+	} else if l.policy.BaseDelay > 0 {
+		block = l.policy.BaseDelay << (attempt.Failures - 1)
+		if block <= 0 || (l.policy.MaxDelay > 0 && block > l.policy.MaxDelay) {
+			block = l.policy.MaxDelay
+		}
+	}
+	if block <= 0 {
+		return attempt, nil
+	}
+
+	blockedUntil := now.Add(block)
+	expiresAt := attempt.ExpiresAt
+	if blockedUntil.After(expiresAt) {
+		expiresAt = blockedUntil
+	}
+	return attempt, l.attempts.SetBlock(ctx, scopedKey, blockedUntil, expiresAt)
+}
+
+// Reset clears the key's failures and any lockout
+func (l *attemptLimiter) Reset(ctx context.Context, key string) error {
+	return l.attempts.Delete(ctx, l.scopedKey(key))
+}
+
+func (l *attemptLimiter) scopedKey(key string) string {
+	return l.scope + ":" + key
+}
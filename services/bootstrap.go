@@ -2,49 +2,49 @@ package services
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"time"
 
 	"lem-be/constants"
 	"lem-be/models"
+	"lem-be/repository"
 	"lem-be/utils"
 
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
 	"go.opentelemetry.io/otel"
 )
 
-// InitSuperuser checks for an existing super_admin and creates one if it doesn't exist
-func InitSuperuser(db *mongo.Database) error {
+// InitSuperuser checks for an existing super_admin and creates one if it doesn't exist.
+// SUPERUSER_PASSWORD must satisfy the password policy like any other password.
+func InitSuperuser(users repository.UserRepository, passwordPolicy PasswordPolicy) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	usersCollection := db.Collection("users")
-
 	ctx, span := otel.Tracer("bootstrap-service").Start(ctx, "InitSuperuser")
 	defer span.End()
 
 	log := utils.NewLogger("BootstrapService", "InitSuperuser").WithContext(ctx)
 	// Check if any super_admin exists
-	var existingSuperAdmin models.User
-	err := usersCollection.FindOne(ctx, bson.M{"role": constants.RoleSuperAdmin}).Decode(&existingSuperAdmin)
-	if err == nil {
+	_, count, err := users.List(ctx, models.ListUsersQuery{Role: constants.RoleSuperAdmin, Page: 1, PageSize: 1, Sort: "created_at"})
+	if err != nil {
+		return err
+	}
+	if count > 0 {
 		log.Info("Superuser already exists")
 		return nil
 	}
 
-	if err != mongo.ErrNoDocuments {
-		return err
-	}
-
 	// No super_admin found, create one from environment variables
-	email := os.Getenv("SUPERUSER_EMAIL")
+	email := utils.NormalizeEmail(os.Getenv("SUPERUSER_EMAIL"))
 	password := os.Getenv("SUPERUSER_PASSWORD")
 
 	if email == "" || password == "" {
 		log.Warn("SUPERUSER_EMAIL or SUPERUSER_PASSWORD not set. Skipping superuser bootstrap.")
 		return nil
 	}
+	if err := passwordPolicy.Check(ctx, password, email); err != nil {
+		return fmt.Errorf("SUPERUSER_PASSWORD rejected: %w", err)
+	}
 
 	hashedPassword, err := utils.HashPassword(password)
 	if err != nil {
@@ -52,15 +52,16 @@ func InitSuperuser(db *mongo.Database) error {
 	}
 
 	superuser := models.User{
-		Email:     email,
-		Password:  hashedPassword,
-		Role:      constants.RoleSuperAdmin,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		Email:         email,
+		Password:      hashedPassword,
+		Role:          constants.RoleSuperAdmin,
+		Provider:      "local",
+		EmailVerified: true,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
 	}
 
-	_, err = usersCollection.InsertOne(ctx, superuser)
-	if err != nil {
+	if err := users.Create(ctx, &superuser); err != nil {
 		return err
 	}
 
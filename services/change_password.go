@@ -0,0 +1,99 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"lem-be/models"
+	"lem-be/repository"
+	"lem-be/utils"
+
+	"go.opentelemetry.io/otel"
+)
+
+var (
+	ErrNoPasswordSet     = errors.New("account has no password")
+	ErrPasswordUnchanged = errors.New("new password must differ from the current password")
+)
+
+type ChangePasswordService interface {
+	ChangePassword(ctx context.Context, userID string, req models.ChangePasswordRequest) (models.LoginResponse, error)
+}
+
+type changePasswordService struct {
+	users          repository.UserRepository
+	tokenService   TokenService
+	accountLimiter AttemptLimiter
+	passwordPolicy PasswordPolicy
+}
+
+// NewChangePasswordService shares accountLimiter with the login service so password guesses count in both places
+func NewChangePasswordService(users repository.UserRepository, tokenService TokenService, accountLimiter AttemptLimiter, passwordPolicy PasswordPolicy) ChangePasswordService {
+	return &changePasswordService{users: users, tokenService: tokenService, accountLimiter: accountLimiter, passwordPolicy: passwordPolicy}
+}
+
+// ChangePassword replaces the password of a logged-in user who knows the current one.
+// Every existing session is revoked and a fresh token pair is returned for the caller.
+func (s *changePasswordService) ChangePassword(ctx context.Context, userID string, req models.ChangePasswordRequest) (models.LoginResponse, error) {
+	ctx, span := otel.Tracer("change-password-service").Start(ctx, "ChangePassword")
+	defer span.End()
+
+	log := utils.NewLogger("ChangePasswordService", "ChangePassword").WithContext(ctx)
+	user, err := s.users.FindByID(ctx, userID)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			return models.LoginResponse{}, ErrUserNotFound
+		}
+		return models.LoginResponse{}, err
+	}
+
+	if user.Password == "" {
+		log.Warnf("Password change attempted for account without password %s", user.Email)
+		return models.LoginResponse{}, ErrNoPasswordSet
+	}
+	// The guess is counted before the password is compared, so parallel guesses cannot outrun the lockout
+	accountKey := utils.NormalizeEmail(user.Email)
+	if err := s.accountLimiter.Reserve(ctx, accountKey); err != nil {
+		log.Warnf("Password change throttled for %s: %v", user.Email, err)
+		return models.LoginResponse{}, err
+	}
+	if !utils.ComparePasswords(user.Password, req.CurrentPassword) {
+		log.Warnf("Invalid current password in password change for %s", user.Email)
+		return models.LoginResponse{}, ErrInvalidPassword
+	}
+	if err := s.accountLimiter.Reset(ctx, accountKey); err != nil {
+		log.Errorf("Failed to reset failed login attempts for %s: %v", user.Email, err)
+	}
+	if req.CurrentPassword == req.NewPassword {
+		return models.LoginResponse{}, ErrPasswordUnchanged
+	}
+	if err := s.passwordPolicy.Check(ctx, req.NewPassword, user.Email); err != nil {
+		return models.LoginResponse{}, err
+	}
+
+	hashedPassword, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		return models.LoginResponse{}, errors.New("Failed to hash password")
+	}
+
+	if _, err := s.users.Update(ctx, userID, repository.UserUpdate{Password: &hashedPassword}); err != nil {
+		log.Errorf("Failed to update password for %s: %v", user.Email, err)
+		return models.LoginResponse{}, errors.New("Failed to update password")
+	}
+	log.Infof("Password changed for %s", user.Email)
+
+	// Revoke every session, then start a new one for the caller
+	if err := s.tokenService.LogoutAll(ctx, userID); err != nil {
+		return models.LoginResponse{}, err
+	}
+	tokens, err := s.tokenService.IssueTokens(ctx, user, []string{utils.AMRPassword})
+	if err != nil {
+		return models.LoginResponse{}, err
+	}
+
+	if err := utils.SendPasswordChangedEmail(user.Email); err != nil {
+		log.Errorf("Failed to send password change notification to %s: %v", user.Email, err)
+	}
+
+	return tokens, nil
+}
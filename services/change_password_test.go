@@ -0,0 +1,42 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"lem-be/models"
+	"lem-be/utils"
+)
+
+func TestChangePasswordThrottlesWrongCurrentPassword(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.createUser(t, "alice@example.com")
+	service := NewChangePasswordService(env.repos.Users, env.tokens, env.accountLimiter, PasswordStrengthPolicy())
+
+	req := models.ChangePasswordRequest{CurrentPassword: "Wrong-Password-1", NewPassword: newTestPassword}
+	if _, err := service.ChangePassword(context.Background(), user.ID.Hex(), req); !errors.Is(err, ErrInvalidPassword) {
+		t.Fatalf("wrong current password: err = %v, want ErrInvalidPassword", err)
+	}
+	var throttled *TooManyAttemptsError
+	req.CurrentPassword = testPassword
+	if _, err := service.ChangePassword(context.Background(), user.ID.Hex(), req); !errors.As(err, &throttled) {
+		t.Fatalf("retry within the backoff: err = %v, want *TooManyAttemptsError", err)
+	}
+}
+
+func TestChangePasswordRevokesOtherSessions(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.createUser(t, "alice@example.com")
+	other := env.loginUser(t, "alice@example.com")
+	service := NewChangePasswordService(env.repos.Users, env.tokens, env.accountLimiter, PasswordStrengthPolicy())
+
+	tokens, err := service.ChangePassword(context.Background(), user.ID.Hex(), models.ChangePasswordRequest{CurrentPassword: testPassword, NewPassword: newTestPassword})
+	if err != nil {
+		t.Fatalf("ChangePassword: %v", err)
+	}
+	if _, err := utils.ValidateToken(other.AccessToken); !errors.Is(err, utils.ErrTokenRevoked) {
+		t.Errorf("other session after password change: err = %v, want ErrTokenRevoked", err)
+	}
+	mustValidate(t, tokens.AccessToken)
+}
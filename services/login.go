@@ -3,13 +3,11 @@ package services
 import (
 	"context"
 	"errors"
-	"time"
 
 	"lem-be/models"
+	"lem-be/repository"
 	"lem-be/utils"
 
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
 	"go.opentelemetry.io/otel"
 )
 
@@ -17,69 +15,109 @@ var (
 	ErrUserNotFound     = errors.New("user not found")
 	ErrInvalidPassword  = errors.New("invalid password")
 	ErrTokenGeneration  = errors.New("failed to generate tokens")
+	ErrEmailNotVerified = errors.New("email not verified")
+	ErrAccountDisabled  = errors.New("account disabled")
 )
 
+// dummyPasswordHash is compared against when the email is unknown so both cases take the same time
+var dummyPasswordHash, _ = utils.HashPassword("dummy-password-for-timing")
+
 type LoginService interface {
-	Login(ctx context.Context, req models.LoginRequest) (models.LoginResponse, error)
+	Login(ctx context.Context, req models.LoginRequest, clientIP string) (models.LoginResponse, error)
 }
 
 type LoginServiceImpl struct {
-	db *mongo.Database
+	users          repository.UserRepository
+	tokenService   TokenService
+	accountLimiter AttemptLimiter
+	ipLimiter      AttemptLimiter
 }
 
-func NewLoginService(db *mongo.Database) LoginService {
-	return &LoginServiceImpl{db: db}
+func NewLoginService(users repository.UserRepository, tokenService TokenService, accountLimiter, ipLimiter AttemptLimiter) LoginService {
+	return &LoginServiceImpl{users: users, tokenService: tokenService, accountLimiter: accountLimiter, ipLimiter: ipLimiter}
 }
 
-func (s *LoginServiceImpl) Login(ctx context.Context, req models.LoginRequest) (models.LoginResponse, error) {
+func (s *LoginServiceImpl) Login(ctx context.Context, req models.LoginRequest, clientIP string) (models.LoginResponse, error) {
 	ctx, span := otel.Tracer("login-service").Start(ctx, "Login")
 	defer span.End()
 
-	// Get users collection
-	usersCollection := s.db.Collection("users")
-
 	log := utils.NewLogger("LoginService", "Login").WithContext(ctx)
+	req.Email = utils.NormalizeEmail(req.Email)
+
+	// Each guess is reserved against the IP and the account before the password is compared, so parallel
+	// guesses cannot all pass the lockout check before the first failure is recorded.
+	// Unknown emails are tracked too, so the response never reveals whether an account exists.
+	accountKey := req.Email
+	if err := s.ipLimiter.Reserve(ctx, clientIP); err != nil {
+		log.Warnf("Login throttled for IP %s: %v", clientIP, err)
+		return models.LoginResponse{}, err
+	}
+	if err := s.accountLimiter.Reserve(ctx, accountKey); err != nil {
+		log.Warnf("Login throttled for email %s: %v", req.Email, err)
+		s.releaseIP(ctx, clientIP)
+		return models.LoginResponse{}, err
+	}
+
 	// Find user by email
-	var user models.User
-	err := usersCollection.FindOne(ctx, bson.M{"email": req.Email}).Decode(&user)
+	user, err := s.users.FindByEmail(ctx, req.Email)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
+		if err == repository.ErrNotFound {
 			log.Warnf("User not found for email %s", req.Email)
+			utils.ComparePasswords(dummyPasswordHash, req.Password)
 			return models.LoginResponse{}, ErrUserNotFound
 		}
 		log.Errorf("Database error during user lookup for email %s: %v", req.Email, err)
+		s.releaseIP(ctx, clientIP)
+		if err := s.accountLimiter.Release(ctx, accountKey); err != nil {
+			log.Errorf("Failed to release login attempt for email %s: %v", req.Email, err)
+		}
 		return models.LoginResponse{}, err
 	}
 
-	// Verify password
+	// Verify password; a wrong one keeps both reservations as failures
 	if !utils.ComparePasswords(user.Password, req.Password) {
 		log.Warnf("Invalid password attempt for email %s", req.Email)
 		return models.LoginResponse{}, ErrInvalidPassword
 	}
 
-	// Generate access token
-	accessToken, err := utils.GenerateAccessToken(user.ID.Hex(), user.Email, user.Role)
-	if err != nil {
-		log.Errorf("Failed to generate access token for email %s: %v", req.Email, err)
-		return models.LoginResponse{}, ErrTokenGeneration
+	s.releaseIP(ctx, clientIP)
+	if err := s.accountLimiter.Reset(ctx, accountKey); err != nil {
+		log.Errorf("Failed to reset failed login attempts for email %s: %v", req.Email, err)
 	}
 
-	// Generate refresh token
-	refreshToken, err := utils.GenerateRefreshToken(user.ID.Hex())
+	if user.Disabled {
+		log.Warnf("Login refused for disabled account %s", req.Email)
+		return models.LoginResponse{}, ErrAccountDisabled
+	}
+
+	// Self-registered accounts must confirm their email first
+	if user.Provider == "local" && !user.EmailVerified {
+		log.Warnf("Login refused for unverified email %s", req.Email)
+		return models.LoginResponse{}, ErrEmailNotVerified
+	}
+
+	// Users with a second factor get a challenge to complete at /auth/mfa/verify instead of tokens
+	if mfaEnabled(user) {
+		log.Infof("Password accepted for %s, second factor required", req.Email)
+		return issueMFAChallenge(user, []string{utils.AMRPassword})
+	}
+
+	// Generate access and refresh tokens for a new session
+	resp, err := s.tokenService.IssueTokens(ctx, user, []string{utils.AMRPassword})
 	if err != nil {
-		log.Errorf("Failed to generate refresh token for email %s: %v", req.Email, err)
+		log.Errorf("Failed to generate tokens for email %s: %v", req.Email, err)
 		return models.LoginResponse{}, ErrTokenGeneration
 	}
 
 	// Update user's last login time (optional)
-	_, _ = usersCollection.UpdateOne(
-		ctx,
-		bson.M{"_id": user.ID},
-		bson.M{"$set": bson.M{"updated_at": time.Now()}},
-	)
-
-	return models.LoginResponse{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-	}, nil
-}
\ No newline at end of file
+	_, _ = s.users.Update(ctx, user.ID.Hex(), repository.UserUpdate{})
+
+	return resp, nil
+}
+
+// releaseIP takes back the IP's reservation for an attempt that was not a wrong guess
+func (s *LoginServiceImpl) releaseIP(ctx context.Context, clientIP string) {
+	if err := s.ipLimiter.Release(ctx, clientIP); err != nil {
+		utils.NewLogger("LoginService", "releaseIP").WithContext(ctx).Errorf("Failed to release login attempt for IP %s: %v", clientIP, err)
+	}
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"lem-be/models"
+)
+
+func TestLoginNormalizesEmail(t *testing.T) {
+	env := newTestEnv(t)
+	env.createUser(t, "Alice@Example.com ")
+
+	tokens := env.loginUser(t, "  ALICE@example.COM")
+	if claims := mustValidate(t, tokens.AccessToken); claims.Email != "alice@example.com" {
+		t.Errorf("email claim = %q, want alice@example.com", claims.Email)
+	}
+}
+
+// Parallel wrong passwords for one account must not get more tries than the lockout threshold
+func TestLoginCountsConcurrentGuessesPerAccount(t *testing.T) {
+	// Without backoff only the lockout holds guesses back, so none are turned away merely for being late
+	t.Setenv("LOGIN_BACKOFF_BASE", "0")
+	t.Setenv("LOGIN_MAX_FAILED_ATTEMPTS", "5")
+	env := newTestEnv(t)
+	env.createUser(t, "alice@example.com")
+
+	errs := guessConcurrently(30, func(i int) error {
+		req := models.LoginRequest{Email: "alice@example.com", Password: "Wrong-Password-1"}
+		_, err := env.login.Login(context.Background(), req, fmt.Sprintf("192.0.2.%d", 10+i))
+		return err
+	})
+	if checked := countWrongGuesses(t, errs, ErrInvalidPassword); checked > 5 {
+		t.Fatalf("%d passwords were compared, want at most 5", checked)
+	}
+
+	req := models.LoginRequest{Email: "alice@example.com", Password: testPassword}
+	if _, err := env.login.Login(context.Background(), req, "192.0.2.1"); !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("right password after the lockout: err = %v, want ErrTooManyAttempts", err)
+	}
+}
+
+// Parallel guesses from one IP across many accounts must not get past the IP threshold
+func TestLoginCountsConcurrentGuessesPerIP(t *testing.T) {
+	t.Setenv("LOGIN_IP_MAX_FAILED_ATTEMPTS", "5")
+	env := newTestEnv(t)
+
+	errs := guessConcurrently(30, func(i int) error {
+		req := models.LoginRequest{Email: fmt.Sprintf("user%d@example.com", i), Password: "Wrong-Password-1"}
+		_, err := env.login.Login(context.Background(), req, "192.0.2.1")
+		return err
+	})
+	if checked := countWrongGuesses(t, errs, ErrUserNotFound); checked > 5 {
+		t.Fatalf("%d logins were checked, want at most 5", checked)
+	}
+}
+
+// A successful login gives its IP reservation back
+func TestLoginReleasesIPOnSuccess(t *testing.T) {
+	t.Setenv("LOGIN_IP_MAX_FAILED_ATTEMPTS", "3")
+	env := newTestEnv(t)
+	env.createUser(t, "alice@example.com")
+
+	for i := 0; i < 5; i++ {
+		env.loginUser(t, "alice@example.com")
+	}
+}
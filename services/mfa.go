@@ -0,0 +1,335 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"lem-be/models"
+	"lem-be/repository"
+	"lem-be/utils"
+
+	"go.opentelemetry.io/otel"
+)
+
+var (
+	ErrMFAAlreadyEnabled   = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnabled       = errors.New("two-factor authentication is not enabled")
+	ErrMFAEnrollmentAbsent = errors.New("no two-factor enrollment is pending")
+	ErrInvalidMFACode      = errors.New("invalid two-factor code")
+	ErrInvalidMFAChallenge = errors.New("invalid or expired MFA challenge")
+)
+
+// recoveryCodeCount is how many recovery codes are issued when MFA is enabled
+const recoveryCodeCount = 10
+
+// mfaRecoveryPurpose scopes recovery code hashes (see utils.HashOTP)
+const mfaRecoveryPurpose = "mfa_recovery"
+
+// MFAService enrolls TOTP second factors and completes two-step logins
+type MFAService interface {
+	BeginTOTPEnrollment(ctx context.Context, userID string) (models.TOTPEnrollmentResponse, error)
+	ConfirmTOTPEnrollment(ctx context.Context, userID string, req models.ConfirmTOTPRequest) (models.RecoveryCodesResponse, error)
+	DisableTOTP(ctx context.Context, userID string, req models.DisableTOTPRequest) error
+	Verify(ctx context.Context, req models.MFAVerifyRequest) (models.LoginResponse, error)
+	// CheckCode accepts a TOTP or recovery code of a user with MFA enabled, e.g. for re-authentication
+	CheckCode(ctx context.Context, userID, code, recoveryCode string) error
+}
+
+type mfaService struct {
+	users             repository.UserRepository
+	tokenService      TokenService
+	revocationService RevocationService
+	limiter           AttemptLimiter
+}
+
+func NewMFAService(users repository.UserRepository, tokenService TokenService, revocationService RevocationService, limiter AttemptLimiter) MFAService {
+	return &mfaService{users: users, tokenService: tokenService, revocationService: revocationService, limiter: limiter}
+}
+
+// MFAPolicy throttles wrong second-factor codes per user
+func MFAPolicy() AttemptPolicy {
+	return AttemptPolicy{
+		Threshold:       utils.GetEnvInt("MFA_MAX_FAILED_ATTEMPTS", 5),
+		BaseDelay:       utils.GetEnvDuration("LOGIN_BACKOFF_BASE", time.Second),
+		MaxDelay:        utils.GetEnvDuration("LOGIN_BACKOFF_MAX", 30*time.Second),
+		LockoutDuration: utils.GetEnvDuration("MFA_LOCKOUT_DURATION", 15*time.Minute),
+		Window:          utils.GetEnvDuration("LOGIN_ATTEMPT_WINDOW", time.Hour),
+	}
+}
+
+// mfaEnabled reports whether logging in as user requires a second factor
+func mfaEnabled(user models.User) bool {
+	return user.MFA != nil && user.MFA.Enabled
+}
+
+// issueMFAChallenge answers the first login step, passed with the amr methods, of a user with a second factor
+func issueMFAChallenge(user models.User, amr []string) (models.LoginResponse, error) {
+	token, _, err := utils.GenerateMFAChallengeToken(user.ID.Hex(), user.Email, amr)
+	if err != nil {
+		return models.LoginResponse{}, ErrTokenGeneration
+	}
+	return models.LoginResponse{MFARequired: true, MFAToken: token}, nil
+}
+
+// withSecondFactor adds the second factor method to the amr of the first login step
+func withSecondFactor(first []string, method string) []string {
+	return append(append([]string(nil), first...), method, utils.AMRMultiFactor)
+}
+
+// BeginTOTPEnrollment generates a new secret. It stays pending until confirmed with a code,
+// so a half-finished enrollment never locks the user out.
+func (s *mfaService) BeginTOTPEnrollment(ctx context.Context, userID string) (models.TOTPEnrollmentResponse, error) {
+	ctx, span := otel.Tracer("mfa-service").Start(ctx, "BeginTOTPEnrollment")
+	defer span.End()
+
+	log := utils.NewLogger("MFAService", "BeginTOTPEnrollment").WithContext(ctx)
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return models.TOTPEnrollmentResponse{}, err
+	}
+	if mfaEnabled(user) {
+		return models.TOTPEnrollmentResponse{}, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return models.TOTPEnrollmentResponse{}, err
+	}
+	encrypted, err := utils.EncryptTOTPSecret(secret)
+	if err != nil {
+		log.Errorf("Failed to encrypt TOTP secret for %s: %v", user.Email, err)
+		return models.TOTPEnrollmentResponse{}, err
+	}
+	if err := s.users.SetMFA(ctx, userID, &models.MFA{TOTPSecret: encrypted}); err != nil {
+		log.Errorf("Failed to store pending TOTP enrollment for %s: %v", user.Email, err)
+		return models.TOTPEnrollmentResponse{}, err
+	}
+
+	log.Infof("TOTP enrollment started for %s", user.Email)
+	return models.TOTPEnrollmentResponse{
+		Secret:     secret,
+		OTPAuthURI: utils.TOTPURI(utils.TOTPIssuer(), user.Email, secret),
+	}, nil
+}
+
+// ConfirmTOTPEnrollment enables MFA once the user proves their app generates valid codes
+func (s *mfaService) ConfirmTOTPEnrollment(ctx context.Context, userID string, req models.ConfirmTOTPRequest) (models.RecoveryCodesResponse, error) {
+	ctx, span := otel.Tracer("mfa-service").Start(ctx, "ConfirmTOTPEnrollment")
+	defer span.End()
+
+	log := utils.NewLogger("MFAService", "ConfirmTOTPEnrollment").WithContext(ctx)
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return models.RecoveryCodesResponse{}, err
+	}
+	if mfaEnabled(user) {
+		return models.RecoveryCodesResponse{}, ErrMFAAlreadyEnabled
+	}
+	if user.MFA == nil || user.MFA.TOTPSecret == "" {
+		return models.RecoveryCodesResponse{}, ErrMFAEnrollmentAbsent
+	}
+
+	if err := s.limiter.Reserve(ctx, userID); err != nil {
+		return models.RecoveryCodesResponse{}, err
+	}
+	secret, err := utils.DecryptTOTPSecret(user.MFA.TOTPSecret)
+	if err != nil {
+		log.Errorf("Failed to decrypt TOTP secret for %s: %v", user.Email, err)
+		s.release(ctx, userID)
+		return models.RecoveryCodesResponse{}, err
+	}
+	step, ok := utils.ValidateTOTP(secret, req.Code, time.Now())
+	if !ok {
+		log.Warnf("Invalid TOTP code confirming enrollment for %s", user.Email)
+		return models.RecoveryCodesResponse{}, ErrInvalidMFACode
+	}
+
+	codes, hashes, err := newRecoveryCodes(userID)
+	if err != nil {
+		s.release(ctx, userID)
+		return models.RecoveryCodesResponse{}, err
+	}
+	now := time.Now()
+	if err := s.users.SetMFA(ctx, userID, &models.MFA{
+		Enabled:            true,
+		TOTPSecret:         user.MFA.TOTPSecret,
+		LastTOTPStep:       step,
+		RecoveryCodeHashes: hashes,
+		EnabledAt:          &now,
+	}); err != nil {
+		log.Errorf("Failed to enable MFA for %s: %v", user.Email, err)
+		s.release(ctx, userID)
+		return models.RecoveryCodesResponse{}, err
+	}
+	s.limiter.Reset(ctx, userID)
+
+	log.Infof("MFA enabled for %s", user.Email)
+	return models.RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+// DisableTOTP removes the second factor after checking a current TOTP or recovery code
+func (s *mfaService) DisableTOTP(ctx context.Context, userID string, req models.DisableTOTPRequest) error {
+	ctx, span := otel.Tracer("mfa-service").Start(ctx, "DisableTOTP")
+	defer span.End()
+
+	log := utils.NewLogger("MFAService", "DisableTOTP").WithContext(ctx)
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !mfaEnabled(user) {
+		return ErrMFANotEnabled
+	}
+	if err := s.checkSecondFactor(ctx, user, req.Code, req.Code); err != nil {
+		return err
+	}
+
+	if err := s.users.SetMFA(ctx, userID, nil); err != nil {
+		log.Errorf("Failed to disable MFA for %s: %v", user.Email, err)
+		return err
+	}
+	log.Infof("MFA disabled for %s", user.Email)
+	return nil
+}
+
+// Verify completes a login whose password step returned an MFA challenge
+func (s *mfaService) Verify(ctx context.Context, req models.MFAVerifyRequest) (models.LoginResponse, error) {
+	ctx, span := otel.Tracer("mfa-service").Start(ctx, "Verify")
+	defer span.End()
+
+	log := utils.NewLogger("MFAService", "Verify").WithContext(ctx)
+	claims, err := utils.ValidateMFAChallengeToken(req.MFAToken)
+	if err != nil {
+		log.Warnf("Invalid MFA challenge token: %v", err)
+		return models.LoginResponse{}, ErrInvalidMFAChallenge
+	}
+
+	user, err := s.getUser(ctx, claims.UserID)
+	if err != nil || user.Email != claims.Email || !mfaEnabled(user) {
+		return models.LoginResponse{}, ErrInvalidMFAChallenge
+	}
+	if user.Disabled {
+		return models.LoginResponse{}, ErrAccountDisabled
+	}
+
+	// One challenge yields one attempt. It is burned before any code is compared, so a replayed
+	// or concurrently reused challenge cannot spend the user's recovery codes
+	if err := s.revocationService.BurnToken(ctx, claims.ID, claims.UserID, claims.ExpiresAt.Time); err != nil {
+		if err == ErrTokenAlreadyUsed {
+			return models.LoginResponse{}, ErrInvalidMFAChallenge
+		}
+		return models.LoginResponse{}, err
+	}
+
+	if err := s.checkSecondFactor(ctx, user, req.Code, req.RecoveryCode); err != nil {
+		return models.LoginResponse{}, err
+	}
+
+	log.Infof("MFA login completed for %s", user.Email)
+	return s.tokenService.IssueTokens(ctx, user, withSecondFactor(claims.AMR, utils.AMROTP))
+}
+
+func (s *mfaService) CheckCode(ctx context.Context, userID, code, recoveryCode string) error {
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !mfaEnabled(user) {
+		return ErrMFANotEnabled
+	}
+	return s.checkSecondFactor(ctx, user, code, recoveryCode)
+}
+
+// checkSecondFactor accepts an unused TOTP code or, failing that, an unused recovery code.
+// The guess is reserved against the per-user limiter before any code is compared, so parallel
+// guesses cannot all get in before the first failure is recorded; only wrong codes keep it.
+func (s *mfaService) checkSecondFactor(ctx context.Context, user models.User, code, recoveryCode string) error {
+	log := utils.NewLogger("MFAService", "checkSecondFactor").WithContext(ctx)
+	userID := user.ID.Hex()
+	if err := s.limiter.Reserve(ctx, userID); err != nil {
+		log.Warnf("MFA verification throttled for %s: %v", user.Email, err)
+		return err
+	}
+
+	err := s.matchSecondFactor(ctx, user, code, recoveryCode)
+	switch {
+	case err == nil:
+		s.limiter.Reset(ctx, userID)
+	case err != ErrInvalidMFACode:
+		s.release(ctx, userID)
+	}
+	return err
+}
+
+// matchSecondFactor uses up the TOTP step or recovery code if one of them is right
+func (s *mfaService) matchSecondFactor(ctx context.Context, user models.User, code, recoveryCode string) error {
+	log := utils.NewLogger("MFAService", "matchSecondFactor").WithContext(ctx)
+	userID := user.ID.Hex()
+	if code != "" {
+		secret, err := utils.DecryptTOTPSecret(user.MFA.TOTPSecret)
+		if err != nil {
+			log.Errorf("Failed to decrypt TOTP secret for %s: %v", user.Email, err)
+			return err
+		}
+		if step, ok := utils.ValidateTOTP(secret, code, time.Now()); ok {
+			err := s.users.UseTOTPStep(ctx, userID, step)
+			if err == nil {
+				return nil
+			}
+			if err != repository.ErrConflict {
+				return err
+			}
+			log.Warnf("Replayed TOTP code for %s", user.Email)
+		}
+	}
+
+	if recoveryCode != "" {
+		hash, err := utils.HashOTP(userID, mfaRecoveryPurpose, utils.NormalizeRecoveryCode(recoveryCode))
+		if err != nil {
+			return err
+		}
+		err = s.users.UseRecoveryCode(ctx, userID, hash)
+		if err == nil {
+			log.Infof("Recovery code used by %s", user.Email)
+			return nil
+		}
+		if err != repository.ErrNotFound {
+			return err
+		}
+	}
+
+	log.Warnf("Invalid second factor for %s", user.Email)
+	return ErrInvalidMFACode
+}
+
+// release takes back a reserved attempt that did not turn out to be a wrong code
+func (s *mfaService) release(ctx context.Context, userID string) {
+	if err := s.limiter.Release(ctx, userID); err != nil {
+		utils.NewLogger("MFAService", "release").WithContext(ctx).Errorf("Failed to release MFA attempt for %s: %v", userID, err)
+	}
+}
+
+func (s *mfaService) getUser(ctx context.Context, userID string) (models.User, error) {
+	user, err := s.users.FindByID(ctx, userID)
+	if err == repository.ErrNotFound {
+		return models.User{}, ErrUserNotFound
+	}
+	return user, err
+}
+
+// newRecoveryCodes returns fresh recovery codes and the hashes to store for them
+func newRecoveryCodes(userID string) ([]string, []string, error) {
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i], err = utils.HashOTP(userID, mfaRecoveryPurpose, utils.NormalizeRecoveryCode(code))
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return codes, hashes, nil
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"lem-be/models"
+	"lem-be/repository"
+	"lem-be/utils"
+)
+
+// enableTestTOTP turns on TOTP for the user and returns the plain secret
+func enableTestTOTP(t *testing.T, env *testEnv, user models.User) string {
+	t.Helper()
+	t.Setenv("MFA_ENCRYPTION_KEY", "test-mfa-key")
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret: %v", err)
+	}
+	encrypted, err := utils.EncryptTOTPSecret(secret)
+	if err != nil {
+		t.Fatalf("EncryptTOTPSecret: %v", err)
+	}
+	if err := env.repos.Users.SetMFA(context.Background(), user.ID.Hex(), &models.MFA{Enabled: true, TOTPSecret: encrypted}); err != nil {
+		t.Fatalf("SetMFA: %v", err)
+	}
+	return secret
+}
+
+// wrongTOTPCode returns a code the secret does not accept right now
+func wrongTOTPCode(secret string) string {
+	for n := 0; ; n++ {
+		code := fmt.Sprintf("%06d", n)
+		if _, ok := utils.ValidateTOTP(secret, code, time.Now()); !ok {
+			return code
+		}
+	}
+}
+
+// slowAttemptRepository takes a database round trip's time to read a counter, so concurrent
+// guesses interleave the way they do against MongoDB
+type slowAttemptRepository struct {
+	repository.AttemptRepository
+}
+
+func (r slowAttemptRepository) Find(ctx context.Context, key string) (models.FailedAttempt, error) {
+	attempt, err := r.AttemptRepository.Find(ctx, key)
+	time.Sleep(5 * time.Millisecond)
+	return attempt, err
+}
+
+// Parallel wrong TOTP and recovery codes must not get more tries than the lockout threshold
+func TestCheckCodeCountsConcurrentGuesses(t *testing.T) {
+	// Without backoff only the lockout holds guesses back, so none are turned away merely for being late
+	t.Setenv("LOGIN_BACKOFF_BASE", "0")
+	t.Setenv("MFA_MAX_FAILED_ATTEMPTS", "5")
+	env := newTestEnv(t)
+	user := env.createUser(t, "alice@example.com")
+	secret := enableTestTOTP(t, env, user)
+	limiter := NewAttemptLimiter(slowAttemptRepository{env.repos.Attempts}, "mfa-user", MFAPolicy())
+	mfa := NewMFAService(env.repos.Users, env.tokens, env.revocations, limiter)
+
+	code := wrongTOTPCode(secret)
+	errs := guessConcurrently(30, func(i int) error {
+		if i%2 == 0 {
+			return mfa.CheckCode(context.Background(), user.ID.Hex(), code, "")
+		}
+		return mfa.CheckCode(context.Background(), user.ID.Hex(), "", fmt.Sprintf("wrong-%04d", i))
+	})
+	if checked := countWrongGuesses(t, errs, ErrInvalidMFACode); checked > 5 {
+		t.Fatalf("%d codes were compared, want at most 5", checked)
+	}
+
+	if err := mfa.CheckCode(context.Background(), user.ID.Hex(), code, ""); !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("code after the lockout: err = %v, want ErrTooManyAttempts", err)
+	}
+}
+
+// A used or concurrently reused challenge must be turned away before it can spend a recovery code
+func TestVerifyReplayedChallengeKeepsRecoveryCodes(t *testing.T) {
+	t.Setenv("LOGIN_BACKOFF_BASE", "0")
+	env := newTestEnv(t)
+	user := env.createUser(t, "alice@example.com")
+	enableTestTOTP(t, env, user)
+	codes, hashes, err := newRecoveryCodes(user.ID.Hex())
+	if err != nil {
+		t.Fatalf("newRecoveryCodes: %v", err)
+	}
+	user, err = env.repos.Users.FindByID(context.Background(), user.ID.Hex())
+	if err != nil {
+		t.Fatalf("FindByID: %v", err)
+	}
+	user.MFA.RecoveryCodeHashes = hashes
+	if err := env.repos.Users.SetMFA(context.Background(), user.ID.Hex(), user.MFA); err != nil {
+		t.Fatalf("SetMFA: %v", err)
+	}
+	// The slow limiter holds concurrent uses of one challenge together long enough to race
+	limiter := NewAttemptLimiter(slowAttemptRepository{env.repos.Attempts}, "mfa-user", MFAPolicy())
+	mfa := NewMFAService(env.repos.Users, env.tokens, env.revocations, limiter)
+	challenge := func() string {
+		t.Helper()
+		resp, err := issueMFAChallenge(user, []string{utils.AMRPassword})
+		if err != nil {
+			t.Fatalf("issueMFAChallenge: %v", err)
+		}
+		return resp.MFAToken
+	}
+
+	used := challenge()
+	if _, err := mfa.Verify(context.Background(), models.MFAVerifyRequest{MFAToken: used, RecoveryCode: codes[0]}); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if _, err := mfa.Verify(context.Background(), models.MFAVerifyRequest{MFAToken: used, RecoveryCode: codes[1]}); !errors.Is(err, ErrInvalidMFAChallenge) {
+		t.Fatalf("replayed challenge: err = %v, want ErrInvalidMFAChallenge", err)
+	}
+
+	shared := challenge()
+	errs := guessConcurrently(5, func(i int) error {
+		_, err := mfa.Verify(context.Background(), models.MFAVerifyRequest{MFAToken: shared, RecoveryCode: codes[2+i]})
+		return err
+	})
+	winner := -1
+	for i, err := range errs {
+		switch {
+		case err == nil && winner < 0:
+			winner = i
+		case !errors.Is(err, ErrInvalidMFAChallenge):
+			t.Errorf("concurrent use %d: err = %v", i, err)
+		}
+	}
+	if winner < 0 {
+		t.Fatal("no use of the shared challenge succeeded")
+	}
+
+	for i, code := range codes[1:7] {
+		if i+1 == 2+winner {
+			continue
+		}
+		if err := mfa.CheckCode(context.Background(), user.ID.Hex(), "", code); err != nil {
+			t.Errorf("recovery code %d was spent by a rejected challenge: %v", i+1, err)
+		}
+	}
+}
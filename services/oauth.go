@@ -0,0 +1,293 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"lem-be/constants"
+	"lem-be/models"
+	"lem-be/repository"
+	"lem-be/utils"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	ErrOAuthExchange           = errors.New("failed to exchange authorization code")
+	ErrProviderEmailUnverified = errors.New("provider did not verify the email address")
+	ErrAccountLinkRequired     = errors.New("an account with this email already exists; sign in and link the provider from your account")
+	ErrIdentityLinkedElsewhere = errors.New("this provider account is linked to another user")
+	ErrProviderAlreadyLinked   = errors.New("another account of this provider is already linked")
+	ErrIdentityNotLinked       = errors.New("provider is not linked to this account")
+	ErrLastSignInMethod        = errors.New("cannot unlink the only way to sign in")
+)
+
+type OAuthService interface {
+	// HandleCallback returns an MFA challenge instead of tokens when the user has a second factor
+	HandleCallback(ctx context.Context, provider *utils.OAuthProvider, code, codeVerifier, nonce string) (models.User, models.LoginResponse, error)
+	LinkIdentity(ctx context.Context, userID string, provider *utils.OAuthProvider, code, codeVerifier, nonce string) (models.User, error)
+	UnlinkIdentity(ctx context.Context, userID, providerName string) error
+}
+
+type oauthService struct {
+	users        repository.UserRepository
+	tokenService TokenService
+}
+
+func NewOAuthService(users repository.UserRepository, tokenService TokenService) OAuthService {
+	return &oauthService{users: users, tokenService: tokenService}
+}
+
+// HandleCallback redeems the authorization code and signs in the user the provider account is
+// linked to. Unknown accounts are linked automatically to the user with the same email only when
+// both the provider and our own verification vouch for that email; otherwise a new user is created.
+func (service *oauthService) HandleCallback(ctx context.Context, provider *utils.OAuthProvider, code, codeVerifier, nonce string) (models.User, models.LoginResponse, error) {
+	ctx, span := otel.Tracer("oauth-service").Start(ctx, "HandleCallback")
+	defer span.End()
+	span.SetAttributes(attribute.String("oauth.provider", provider.Name))
+
+	log := utils.NewLogger("OAuthService", "HandleCallback").WithContext(ctx)
+	identity, err := service.resolveIdentity(ctx, provider, code, codeVerifier, nonce)
+	if err != nil {
+		return models.User{}, models.LoginResponse{}, err
+	}
+
+	user, err := service.findByIdentity(ctx, identity)
+	switch {
+	case err == nil:
+		log.Infof("%s identity %s belongs to %s", provider.Name, identity.Subject, user.Email)
+		if !hasIdentity(user, identity.Provider) {
+			// Accounts created before identities were tracked only carry provider/provider_id
+			if err := service.addIdentity(ctx, user.ID.Hex(), identity); err != nil && !errors.Is(err, ErrProviderAlreadyLinked) {
+				return models.User{}, models.LoginResponse{}, err
+			}
+		}
+	case errors.Is(err, repository.ErrNotFound):
+		user, err = service.linkOrCreate(ctx, identity)
+		if err != nil {
+			return models.User{}, models.LoginResponse{}, err
+		}
+	default:
+		log.Errorf("Failed to look up %s identity %s: %v", provider.Name, identity.Subject, err)
+		return models.User{}, models.LoginResponse{}, err
+	}
+
+	if user.Disabled {
+		log.Warnf("%s login refused for disabled account %s", provider.Name, user.Email)
+		return models.User{}, models.LoginResponse{}, ErrAccountDisabled
+	}
+
+	// A provider login replaces the password, not the second factor
+	if mfaEnabled(user) {
+		log.Infof("%s login for %s requires a second factor", provider.Name, user.Email)
+		challenge, err := issueMFAChallenge(user, []string{utils.AMRFederated})
+		return user, challenge, err
+	}
+
+	// Generate JWT tokens
+	tokens, err := service.tokenService.IssueTokens(ctx, user, []string{utils.AMRFederated})
+	if err != nil {
+		return models.User{}, models.LoginResponse{}, err
+	}
+
+	return user, tokens, nil
+}
+
+// LinkIdentity attaches the provider account that completed the flow to userID.
+// The caller must have re-authenticated before the flow was started.
+func (service *oauthService) LinkIdentity(ctx context.Context, userID string, provider *utils.OAuthProvider, code, codeVerifier, nonce string) (models.User, error) {
+	ctx, span := otel.Tracer("oauth-service").Start(ctx, "LinkIdentity")
+	defer span.End()
+	span.SetAttributes(attribute.String("oauth.provider", provider.Name))
+
+	log := utils.NewLogger("OAuthService", "LinkIdentity").WithContext(ctx)
+	user, err := service.getUser(ctx, userID)
+	if err != nil {
+		return models.User{}, err
+	}
+	if user.Disabled {
+		return models.User{}, ErrAccountDisabled
+	}
+
+	identity, err := service.resolveIdentity(ctx, provider, code, codeVerifier, nonce)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	owner, err := service.findByIdentity(ctx, identity)
+	if err == nil {
+		if owner.ID != user.ID {
+			log.Warnf("%s identity %s is already linked to another user", provider.Name, identity.Subject)
+			return models.User{}, ErrIdentityLinkedElsewhere
+		}
+		if hasIdentity(owner, identity.Provider) {
+			return owner, nil
+		}
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return models.User{}, err
+	}
+
+	if err := service.addIdentity(ctx, userID, identity); err != nil {
+		return models.User{}, err
+	}
+	log.Infof("Linked %s identity %s to %s", provider.Name, identity.Subject, user.Email)
+	return service.getUser(ctx, userID)
+}
+
+// UnlinkIdentity removes the linked account of providerName. The route requires a recent authentication.
+func (service *oauthService) UnlinkIdentity(ctx context.Context, userID, providerName string) error {
+	ctx, span := otel.Tracer("oauth-service").Start(ctx, "UnlinkIdentity")
+	defer span.End()
+
+	log := utils.NewLogger("OAuthService", "UnlinkIdentity").WithContext(ctx)
+	user, err := service.getUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	legacy := user.Provider == providerName && user.ProviderID != ""
+	if !hasIdentity(user, providerName) && !legacy {
+		return ErrIdentityNotLinked
+	}
+	// Keep at least one way to sign in
+	remaining := 0
+	for _, identity := range user.Identities {
+		if identity.Provider != providerName {
+			remaining++
+		}
+	}
+	if user.Password == "" && remaining == 0 {
+		return ErrLastSignInMethod
+	}
+
+	if err := service.users.RemoveIdentity(ctx, userID, providerName); err != nil {
+		log.Errorf("Failed to unlink %s from %s: %v", providerName, user.Email, err)
+		return err
+	}
+	if legacy {
+		cleared := ""
+		if _, err := service.users.Update(ctx, userID, repository.UserUpdate{ProviderID: &cleared}); err != nil {
+			log.Errorf("Failed to clear legacy %s identity of %s: %v", providerName, user.Email, err)
+			return err
+		}
+	}
+	log.Infof("Unlinked %s from %s", providerName, user.Email)
+	return nil
+}
+
+// resolveIdentity exchanges the authorization code and returns the provider account behind it
+func (service *oauthService) resolveIdentity(ctx context.Context, provider *utils.OAuthProvider, code, codeVerifier, nonce string) (*utils.OAuthIdentity, error) {
+	log := utils.NewLogger("OAuthService", "resolveIdentity").WithContext(ctx)
+	token, err := provider.Exchange(ctx, code, codeVerifier)
+	if err != nil {
+		log.Errorf("Failed to exchange %s token: %v", provider.Name, err)
+		return nil, fmt.Errorf("%w: %v", ErrOAuthExchange, err)
+	}
+
+	identity, err := provider.Identity(ctx, token, nonce)
+	if err != nil {
+		log.Warnf("Failed to resolve %s identity: %v", provider.Name, err)
+		return nil, err
+	}
+	identity.Email = utils.NormalizeEmail(identity.Email)
+	log.Infof("Resolved %s identity %s", provider.Name, identity.Subject)
+	return identity, nil
+}
+
+// linkOrCreate handles the first login with a provider account
+func (service *oauthService) linkOrCreate(ctx context.Context, identity *utils.OAuthIdentity) (models.User, error) {
+	log := utils.NewLogger("OAuthService", "linkOrCreate").WithContext(ctx)
+	if !identity.EmailVerified || identity.Email == "" {
+		log.Warnf("%s account %s has no verified email", identity.Provider, identity.Subject)
+		return models.User{}, ErrProviderEmailUnverified
+	}
+
+	existing, err := service.users.FindByEmail(ctx, identity.Email)
+	if err == nil {
+		// An unverified account may have been registered by someone who does not own the email
+		if !existing.EmailVerified {
+			log.Warnf("Not auto-linking %s to unverified account %s", identity.Provider, existing.Email)
+			return models.User{}, ErrAccountLinkRequired
+		}
+		if err := service.addIdentity(ctx, existing.ID.Hex(), identity); err != nil {
+			if errors.Is(err, ErrProviderAlreadyLinked) {
+				return models.User{}, ErrAccountLinkRequired
+			}
+			return models.User{}, err
+		}
+		log.Infof("Auto-linked %s identity %s to %s by verified email", identity.Provider, identity.Subject, existing.Email)
+		return service.getUser(ctx, existing.ID.Hex())
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return models.User{}, err
+	}
+
+	now := time.Now()
+	user := models.User{
+		Email:         identity.Email,
+		Role:          constants.RoleUser,
+		Provider:      identity.Provider,
+		ProviderID:    identity.Subject,
+		Identities:    []models.Identity{newIdentity(identity, now)},
+		EmailVerified: true,
+		Profile:       models.Profile{DisplayName: identity.Name, AvatarURL: identity.AvatarURL},
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if err := service.users.Create(ctx, &user); err != nil {
+		if errors.Is(err, repository.ErrDuplicate) {
+			// A concurrent callback created the account first
+			return service.findByIdentity(ctx, identity)
+		}
+		log.Errorf("Failed to create user for email %s: %v", identity.Email, err)
+		return models.User{}, err
+	}
+	log.Infof("Created user %s from %s identity", user.Email, identity.Provider)
+	return user, nil
+}
+
+// findByIdentity finds the user a provider account is linked to
+func (service *oauthService) findByIdentity(ctx context.Context, identity *utils.OAuthIdentity) (models.User, error) {
+	return service.users.FindByIdentity(ctx, identity.Provider, identity.Subject)
+}
+
+// addIdentity links identity to the user unless another account of the same provider is linked
+func (service *oauthService) addIdentity(ctx context.Context, userID string, identity *utils.OAuthIdentity) error {
+	err := service.users.AddIdentity(ctx, userID, newIdentity(identity, time.Now()))
+	switch {
+	case errors.Is(err, repository.ErrConflict):
+		return ErrProviderAlreadyLinked
+	case errors.Is(err, repository.ErrDuplicate):
+		return ErrIdentityLinkedElsewhere
+	}
+	return err
+}
+
+func (service *oauthService) getUser(ctx context.Context, userID string) (models.User, error) {
+	user, err := service.users.FindByID(ctx, userID)
+	if err == repository.ErrNotFound {
+		return models.User{}, ErrUserNotFound
+	}
+	return user, err
+}
+
+func newIdentity(identity *utils.OAuthIdentity, linkedAt time.Time) models.Identity {
+	return models.Identity{
+		Provider:   identity.Provider,
+		ProviderID: identity.Subject,
+		Email:      identity.Email,
+		LinkedAt:   linkedAt,
+	}
+}
+
+func hasIdentity(user models.User, provider string) bool {
+	for _, identity := range user.Identities {
+		if identity.Provider == provider {
+			return true
+		}
+	}
+	return false
+}
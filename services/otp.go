@@ -0,0 +1,163 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"lem-be/models"
+	"lem-be/repository"
+	"lem-be/utils"
+)
+
+var (
+	ErrInvalidOTP        = errors.New("Invalid or expired OTP")
+	ErrOTPCooldown       = errors.New("an OTP was sent recently")
+	ErrOTPDeviceMismatch = errors.New("the code must be used on the device that requested it")
+)
+
+// issueOTP stores a fresh code for the email and purpose, replacing any pending one.
+// A non-empty device binds the code to the secret held by the requesting device.
+// It returns ErrOTPCooldown if a code was sent less than OTP_RESEND_COOLDOWN ago.
+func issueOTP(ctx context.Context, otps repository.OTPRepository, email, purpose, device string, ttl time.Duration) (string, error) {
+	return issueOTPWith(ctx, otps, email, purpose, device, ttl, generateOTP)
+}
+
+// issueOTPWith is issueOTP storing a secret made by generate instead of a numeric code
+func issueOTPWith(ctx context.Context, otps repository.OTPRepository, email, purpose, device string, ttl time.Duration, generate func() (string, error)) (string, error) {
+	now := time.Now()
+
+	existing, err := otps.Find(ctx, email, purpose)
+	if err == nil && now.Sub(existing.LastSentAt) < utils.GetEnvDuration("OTP_RESEND_COOLDOWN", time.Minute) {
+		return "", ErrOTPCooldown
+	}
+	if err != nil && err != repository.ErrNotFound {
+		return "", err
+	}
+
+	code, err := generate()
+	if err != nil {
+		return "", err
+	}
+	codeHash, err := utils.HashOTP(email, purpose, code)
+	if err != nil {
+		return "", err
+	}
+	var deviceHash string
+	if device != "" {
+		if deviceHash, err = utils.HashOTP(email, otpDevicePurpose(purpose), device); err != nil {
+			return "", err
+		}
+	}
+
+	otpRecord := models.OTPRecord{
+		Email:      email,
+		Purpose:    purpose,
+		CodeHash:   codeHash,
+		DeviceHash: deviceHash,
+		Attempts:   0,
+		LastSentAt: now,
+		ExpiresAt:  now.Add(ttl),
+	}
+	if err := otps.Save(ctx, otpRecord); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// consumeOTP checks the code and deletes it on success. Every guess is counted before the code is
+// compared, so concurrent guesses cannot exceed OTP_MAX_ATTEMPTS, and the code is invalidated at the limit.
+// Codes bound to a device are refused with ErrOTPDeviceMismatch before the code is looked at.
+func consumeOTP(ctx context.Context, otps repository.OTPRepository, email, purpose, device, code string) error {
+	log := utils.NewLogger("OTP", "consumeOTP").WithContext(ctx)
+
+	otpRecord, err := otps.Find(ctx, email, purpose)
+	if err == repository.ErrNotFound || (err == nil && !otpRecord.ExpiresAt.After(time.Now())) {
+		return ErrInvalidOTP
+	}
+	if err != nil {
+		return err
+	}
+
+	if otpRecord.CodeHash == "" {
+		// Legacy plaintext record: never compare against it, just expire it
+		otps.Delete(ctx, email, purpose)
+		return ErrInvalidOTP
+	}
+
+	if otpRecord.DeviceHash != "" && !utils.VerifyOTPHash(otpRecord.DeviceHash, email, otpDevicePurpose(purpose), device) {
+		log.Warnf("%s OTP for %s presented from another device", purpose, email)
+		return ErrOTPDeviceMismatch
+	}
+
+	maxAttempts := utils.GetEnvInt("OTP_MAX_ATTEMPTS", 5)
+	updated, err := otps.IncrementAttempts(ctx, email, purpose, maxAttempts)
+	if err == repository.ErrNotFound {
+		log.Warnf("No guesses left for %s OTP for %s", purpose, email)
+		otps.Delete(ctx, email, purpose)
+		return ErrInvalidOTP
+	}
+	if err != nil {
+		return err
+	}
+	// A new code may have been issued since the record was read; the guess was against that one
+	if updated.CodeHash != otpRecord.CodeHash || !utils.VerifyOTPHash(updated.CodeHash, email, purpose, code) {
+		if updated.Attempts >= maxAttempts {
+			log.Warnf("Invalidating %s OTP for %s after %d wrong attempts", purpose, email, updated.Attempts)
+			otps.Delete(ctx, email, purpose)
+		}
+		return ErrInvalidOTP
+	}
+
+	// Delete the OTP so it can't be reused; if another request already consumed it, this one fails
+	if err := otps.Consume(ctx, email, purpose, updated.CodeHash, maxAttempts); err != nil {
+		if err == repository.ErrNotFound {
+			return ErrInvalidOTP
+		}
+		return err
+	}
+	return nil
+}
+
+// consumeOTPFromIP is consumeOTP throttled per client IP across all emails. The guess is reserved
+// against the IP before the code is checked and released unless it turned out wrong.
+func consumeOTPFromIP(ctx context.Context, otps repository.OTPRepository, ipLimiter AttemptLimiter, clientIP, email, purpose, device, code string) error {
+	log := utils.NewLogger("OTP", "consumeOTPFromIP").WithContext(ctx)
+	if err := ipLimiter.Reserve(ctx, clientIP); err != nil {
+		log.Warnf("%s OTP verification throttled for IP %s: %v", purpose, clientIP, err)
+		return err
+	}
+
+	err := consumeOTP(ctx, otps, email, purpose, device, code)
+	if err != ErrInvalidOTP {
+		if err := ipLimiter.Release(ctx, clientIP); err != nil {
+			log.Errorf("Failed to release OTP attempt for IP %s: %v", clientIP, err)
+		}
+	}
+	return err
+}
+
+// otpDevicePurpose keeps device secret hashes apart from code hashes of the same purpose
+func otpDevicePurpose(purpose string) string {
+	return purpose + "_device"
+}
+
+func generateOTP() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(900000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()+100000), nil
+}
+
+// OTPIPPolicy throttles wrong OTP guesses per client IP across all emails
+func OTPIPPolicy() AttemptPolicy {
+	return AttemptPolicy{
+		Threshold:       utils.GetEnvInt("OTP_IP_MAX_FAILED_ATTEMPTS", 20),
+		LockoutDuration: utils.GetEnvDuration("OTP_IP_LOCKOUT_DURATION", 15*time.Minute),
+		Window:          time.Hour,
+	}
+}
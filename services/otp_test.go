@@ -0,0 +1,183 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"lem-be/models"
+)
+
+// wrongCode differs from code in every digit
+func wrongCode(code string) string {
+	wrong := []byte(code)
+	for i := range wrong {
+		wrong[i] = '0' + (wrong[i]-'0'+1)%10
+	}
+	return string(wrong)
+}
+
+func TestConsumeOTP(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	code, err := issueOTP(ctx, env.repos.OTPs, "alice@example.com", models.OTPPurposePasswordReset, "", time.Minute)
+	if err != nil {
+		t.Fatalf("issueOTP: %v", err)
+	}
+
+	if err := consumeOTP(ctx, env.repos.OTPs, "alice@example.com", models.OTPPurposeEmailVerification, "", code); !errors.Is(err, ErrInvalidOTP) {
+		t.Errorf("code used for another purpose: err = %v, want ErrInvalidOTP", err)
+	}
+	if err := consumeOTP(ctx, env.repos.OTPs, "alice@example.com", models.OTPPurposePasswordReset, "", code); err != nil {
+		t.Fatalf("consumeOTP: %v", err)
+	}
+	if err := consumeOTP(ctx, env.repos.OTPs, "alice@example.com", models.OTPPurposePasswordReset, "", code); !errors.Is(err, ErrInvalidOTP) {
+		t.Errorf("second use of the code: err = %v, want ErrInvalidOTP", err)
+	}
+}
+
+func TestIssueOTPCooldown(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	if _, err := issueOTP(ctx, env.repos.OTPs, "alice@example.com", models.OTPPurposeLogin, "", time.Minute); err != nil {
+		t.Fatalf("issueOTP: %v", err)
+	}
+	if _, err := issueOTP(ctx, env.repos.OTPs, "alice@example.com", models.OTPPurposeLogin, "", time.Minute); !errors.Is(err, ErrOTPCooldown) {
+		t.Fatalf("second code within the cooldown: err = %v, want ErrOTPCooldown", err)
+	}
+}
+
+func TestConsumeOTPInvalidatesCodeAtAttemptLimit(t *testing.T) {
+	env := newTestEnv(t)
+	t.Setenv("OTP_MAX_ATTEMPTS", "3")
+	ctx := context.Background()
+	code, err := issueOTP(ctx, env.repos.OTPs, "alice@example.com", models.OTPPurposePasswordReset, "", time.Minute)
+	if err != nil {
+		t.Fatalf("issueOTP: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := consumeOTP(ctx, env.repos.OTPs, "alice@example.com", models.OTPPurposePasswordReset, "", wrongCode(code)); !errors.Is(err, ErrInvalidOTP) {
+			t.Fatalf("wrong guess %d: err = %v, want ErrInvalidOTP", i+1, err)
+		}
+	}
+	if err := consumeOTP(ctx, env.repos.OTPs, "alice@example.com", models.OTPPurposePasswordReset, "", code); !errors.Is(err, ErrInvalidOTP) {
+		t.Fatalf("right code after the attempt limit: err = %v, want ErrInvalidOTP", err)
+	}
+}
+
+func TestConsumeOTPCountsConcurrentGuesses(t *testing.T) {
+	env := newTestEnv(t)
+	t.Setenv("OTP_MAX_ATTEMPTS", "5")
+	ctx := context.Background()
+	code, err := issueOTP(ctx, env.repos.OTPs, "alice@example.com", models.OTPPurposePasswordReset, "", time.Minute)
+	if err != nil {
+		t.Fatalf("issueOTP: %v", err)
+	}
+
+	// Only five guesses may be compared, however many arrive at once; the right code is among them
+	guesses := make([]string, 50)
+	for i := range guesses {
+		guesses[i] = wrongCode(code)
+	}
+	guesses[len(guesses)-1] = code
+
+	var wg sync.WaitGroup
+	results := make(chan error, len(guesses))
+	for _, guess := range guesses {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results <- consumeOTP(ctx, env.repos.OTPs, "alice@example.com", models.OTPPurposePasswordReset, "", guess)
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	accepted := 0
+	for err := range results {
+		switch {
+		case err == nil:
+			accepted++
+		case !errors.Is(err, ErrInvalidOTP):
+			t.Errorf("consumeOTP: unexpected error %v", err)
+		}
+	}
+	if accepted > 1 {
+		t.Fatalf("code accepted %d times", accepted)
+	}
+	if record, err := env.repos.OTPs.Find(ctx, "alice@example.com", models.OTPPurposePasswordReset); err == nil && record.Attempts > 5 {
+		t.Fatalf("%d guesses were compared, want at most 5", record.Attempts)
+	}
+	if err := consumeOTP(ctx, env.repos.OTPs, "alice@example.com", models.OTPPurposePasswordReset, "", code); !errors.Is(err, ErrInvalidOTP) {
+		t.Fatalf("code after the concurrent guesses: err = %v, want ErrInvalidOTP", err)
+	}
+}
+
+func TestConsumeOTPDeviceBinding(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	code, err := issueOTP(ctx, env.repos.OTPs, "alice@example.com", models.OTPPurposeLogin, "device-secret", time.Minute)
+	if err != nil {
+		t.Fatalf("issueOTP: %v", err)
+	}
+
+	if err := consumeOTP(ctx, env.repos.OTPs, "alice@example.com", models.OTPPurposeLogin, "other-device", code); !errors.Is(err, ErrOTPDeviceMismatch) {
+		t.Fatalf("code from another device: err = %v, want ErrOTPDeviceMismatch", err)
+	}
+	if err := consumeOTP(ctx, env.repos.OTPs, "alice@example.com", models.OTPPurposeLogin, "device-secret", code); err != nil {
+		t.Fatalf("code from the requesting device: %v", err)
+	}
+}
+
+func TestConsumeOTPFromIPThrottlesGuessesAcrossEmails(t *testing.T) {
+	t.Setenv("OTP_IP_MAX_FAILED_ATTEMPTS", "3")
+	env := newTestEnv(t)
+	ctx := context.Background()
+
+	emails := []string{"a@example.com", "b@example.com", "c@example.com", "d@example.com"}
+	codes := map[string]string{}
+	for _, email := range emails {
+		code, err := issueOTP(ctx, env.repos.OTPs, email, models.OTPPurposePasswordReset, "", time.Minute)
+		if err != nil {
+			t.Fatalf("issueOTP: %v", err)
+		}
+		codes[email] = code
+	}
+
+	for _, email := range emails[:3] {
+		if err := consumeOTPFromIP(ctx, env.repos.OTPs, env.otpIPLimiter, "192.0.2.1", email, models.OTPPurposePasswordReset, "", wrongCode(codes[email])); !errors.Is(err, ErrInvalidOTP) {
+			t.Fatalf("wrong guess for %s: err = %v, want ErrInvalidOTP", email, err)
+		}
+	}
+
+	var throttled *TooManyAttemptsError
+	err := consumeOTPFromIP(ctx, env.repos.OTPs, env.otpIPLimiter, "192.0.2.1", "d@example.com", models.OTPPurposePasswordReset, "", codes["d@example.com"])
+	if !errors.As(err, &throttled) {
+		t.Fatalf("guess after the IP limit: err = %v, want *TooManyAttemptsError", err)
+	}
+	// Another IP is not affected, and the throttled guess did not burn the code
+	if err := consumeOTPFromIP(ctx, env.repos.OTPs, env.otpIPLimiter, "192.0.2.2", "d@example.com", models.OTPPurposePasswordReset, "", codes["d@example.com"]); err != nil {
+		t.Fatalf("right code from another IP: %v", err)
+	}
+}
+
+func TestConsumeOTPFromIPReleasesRightGuesses(t *testing.T) {
+	t.Setenv("OTP_IP_MAX_FAILED_ATTEMPTS", "2")
+	t.Setenv("OTP_RESEND_COOLDOWN", "0s")
+	env := newTestEnv(t)
+	ctx := context.Background()
+
+	// Right codes do not count towards the IP limit
+	for i := 0; i < 5; i++ {
+		code, err := issueOTP(ctx, env.repos.OTPs, "alice@example.com", models.OTPPurposePasswordReset, "", time.Minute)
+		if err != nil {
+			t.Fatalf("issueOTP: %v", err)
+		}
+		if err := consumeOTPFromIP(ctx, env.repos.OTPs, env.otpIPLimiter, "192.0.2.1", "alice@example.com", models.OTPPurposePasswordReset, "", code); err != nil {
+			t.Fatalf("right code %d: %v", i+1, err)
+		}
+	}
+}
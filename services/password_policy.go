@@ -0,0 +1,213 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"lem-be/utils"
+)
+
+// bcryptMaxLength is the longest password bcrypt accepts, in bytes
+const bcryptMaxLength = 72
+
+// commonPasswords are rejected even without a deny list file. Passwords are compared in lower case
+// and with trailing digits and symbols removed, so "Password123!" matches "password".
+var commonPasswords = []string{
+	"password", "passw0rd", "p@ssword", "p@ssw0rd", "qwerty", "qwertyuiop", "asdfgh", "asdfghjkl", "zxcvbnm",
+	"123456", "12345678", "123456789", "1234567890", "abc", "abcdef", "abcdefgh", "iloveyou", "letmein",
+	"welcome", "admin", "administrator", "root", "login", "changeme", "default", "secret", "monkey",
+	"dragon", "football", "baseball", "sunshine", "princess", "master", "superman", "batman", "trustno",
+	"shadow", "starwars", "whatever", "freedom", "qazwsx", "azerty", "hello", "test", "guest", "user",
+}
+
+// PasswordViolation is one rule a password failed
+type PasswordViolation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicyError lists every rule a password failed, so clients can show them all at once
+type PasswordPolicyError struct {
+	Violations []PasswordViolation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, violation := range e.Violations {
+		messages[i] = violation.Message
+	}
+	return "password does not meet the requirements: " + strings.Join(messages, "; ")
+}
+
+// PasswordPolicy is checked whenever a password is set: registration, reset, change, admin-created
+// accounts and the bootstrapped superuser
+type PasswordPolicy struct {
+	MinLength int
+	// MinCharClasses is how many of lower case, upper case, digits and symbols must appear
+	MinCharClasses int
+	DenyList       map[string]bool
+	// BreachedPasswordsDir holds SHA-1 range files named <first 5 hex chars>.txt with "SUFFIX:COUNT" lines,
+	// as produced by the Pwned Passwords downloader. Empty disables the breach check.
+	BreachedPasswordsDir string
+}
+
+// PasswordStrengthPolicy reads PASSWORD_MIN_LENGTH, PASSWORD_MIN_CHAR_CLASSES, PASSWORD_DENY_LIST_FILE
+// (one password per line, added to the built-in list) and BREACHED_PASSWORDS_DIR
+func PasswordStrengthPolicy() PasswordPolicy {
+	log := utils.NewLogger("PasswordPolicy", "PasswordStrengthPolicy")
+	denyList := make(map[string]bool, len(commonPasswords))
+	for _, password := range commonPasswords {
+		denyList[password] = true
+	}
+	if path := os.Getenv("PASSWORD_DENY_LIST_FILE"); path != "" {
+		if err := loadDenyList(path, denyList); err != nil {
+			log.Errorf("Failed to load password deny list %s, using the built-in list: %v", path, err)
+		}
+	}
+
+	return PasswordPolicy{
+		MinLength:            utils.GetEnvInt("PASSWORD_MIN_LENGTH", 8),
+		MinCharClasses:       utils.GetEnvInt("PASSWORD_MIN_CHAR_CLASSES", 3),
+		DenyList:             denyList,
+		BreachedPasswordsDir: os.Getenv("BREACHED_PASSWORDS_DIR"),
+	}
+}
+
+// Check returns a *PasswordPolicyError listing every violated rule, or nil if the password is acceptable
+func (p PasswordPolicy) Check(ctx context.Context, password, email string) error {
+	var violations []PasswordViolation
+	add := func(code, message string) {
+		violations = append(violations, PasswordViolation{Code: code, Message: message})
+	}
+
+	if len([]rune(password)) < p.MinLength {
+		add("too_short", fmt.Sprintf("Password must be at least %d characters long", p.MinLength))
+	}
+	if len(password) > bcryptMaxLength {
+		add("too_long", fmt.Sprintf("Password must be at most %d bytes long", bcryptMaxLength))
+	}
+	if p.MinCharClasses > 0 && charClasses(password) < p.MinCharClasses {
+		add("character_classes", fmt.Sprintf("Password must contain at least %d of: lower case letters, upper case letters, digits, symbols", p.MinCharClasses))
+	}
+	if p.denied(password) {
+		add("common", "Password is too common")
+	}
+	if similarToEmail(password, email) {
+		add("similar_to_email", "Password must not contain or resemble your email address")
+	}
+	if p.BreachedPasswordsDir != "" {
+		breached, err := p.breached(password)
+		if err != nil {
+			// A broken dataset must not lock everyone out of setting a password
+			utils.NewLogger("PasswordPolicy", "Check").WithContext(ctx).Errorf("Breached password lookup failed: %v", err)
+		} else if breached {
+			add("breached", "Password has appeared in a data breach")
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+func (p PasswordPolicy) denied(password string) bool {
+	normalized := strings.ToLower(password)
+	if p.DenyList[normalized] {
+		return true
+	}
+	base := strings.TrimRightFunc(normalized, func(r rune) bool { return !unicode.IsLetter(r) })
+	return base != "" && p.DenyList[base]
+}
+
+// breached looks the password up by the first five hex characters of its SHA-1 (k-anonymity range files)
+func (p PasswordPolicy) breached(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	file, err := os.Open(filepath.Join(p.BreachedPasswordsDir, prefix+".txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		entry, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if strings.EqualFold(entry, suffix) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+func charClasses(password string) int {
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	classes := 0
+	for _, present := range []bool{lower, upper, digit, symbol} {
+		if present {
+			classes++
+		}
+	}
+	return classes
+}
+
+// similarToEmail reports whether the password contains the email's local part or is contained in it,
+// ignoring case and punctuation
+func similarToEmail(password, email string) bool {
+	localPart, _, _ := strings.Cut(email, "@")
+	user, pass := alphanumeric(localPart), alphanumeric(password)
+	if len(user) < 3 || pass == "" {
+		return false
+	}
+	return strings.Contains(pass, user) || strings.Contains(user, pass)
+}
+
+func alphanumeric(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, s)
+}
+
+func loadDenyList(path string, denyList map[string]bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if password := strings.TrimSpace(scanner.Text()); password != "" {
+			denyList[strings.ToLower(password)] = true
+		}
+	}
+	return scanner.Err()
+}
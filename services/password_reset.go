@@ -1,20 +1,14 @@
 package services
 
 import (
-	"context"
-	"crypto/rand"
 	"errors"
-	"fmt"
-	"math/big"
 	"time"
 
 	"lem-be/models"
+	"lem-be/repository"
 	"lem-be/utils"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.opentelemetry.io/otel"
 )
 
@@ -25,11 +19,16 @@ type PasswordResetService interface {
 }
 
 type passwordResetService struct {
-	db mongo.Database
+	users             repository.UserRepository
+	otps              repository.OTPRepository
+	otpIPLimiter      AttemptLimiter
+	tokenService      TokenService
+	revocationService RevocationService
+	passwordPolicy    PasswordPolicy
 }
 
-func NewPasswordResetService(db mongo.Database) PasswordResetService {
-	return &passwordResetService{db: db}
+func NewPasswordResetService(users repository.UserRepository, otps repository.OTPRepository, otpIPLimiter AttemptLimiter, tokenService TokenService, revocationService RevocationService, passwordPolicy PasswordPolicy) PasswordResetService {
+	return &passwordResetService{users: users, otps: otps, otpIPLimiter: otpIPLimiter, tokenService: tokenService, revocationService: revocationService, passwordPolicy: passwordPolicy}
 }
 
 // HandleForgotPassword generates an OTP and sends it via email
@@ -38,10 +37,9 @@ func (h *passwordResetService) ForgotPassword(c *gin.Context, req models.ForgotP
 	defer span.End()
 
 	log := utils.NewLogger("PasswordResetService", "ForgotPassword").WithContext(ctx)
+	req.Email = utils.NormalizeEmail(req.Email)
 	// 1. Verify user exists and is a local user
-	usersCollection := h.db.Collection("users")
-	var user models.User
-	err := usersCollection.FindOne(context.Background(), bson.M{"email": req.Email}).Decode(&user)
+	user, err := h.users.FindByEmail(ctx, req.Email)
 	if err != nil {
 		log.Warnf("User not found for password reset (email: %s)", req.Email)
 		// Security: Don't reveal if email exists or not, just return 200
@@ -53,31 +51,20 @@ func (h *passwordResetService) ForgotPassword(c *gin.Context, req models.ForgotP
 		return errors.New("This account uses social login. Please use the social provider to sign in.")
 	}
 
-	// 2. Generate 6-digit OTP
-	otp, _ := generateOTP()
-
-	// 3. Save OTP to database
-	otpCollection := h.db.Collection("otps")
-	otpRecord := models.OTPRecord{
-		Email:     req.Email,
-		Code:      otp,
-		ExpiresAt: time.Now().Add(5 * time.Minute),
+	// 2. Generate 6-digit OTP and save it to database, unless one was sent moments ago
+	otp, err := issueOTP(ctx, h.otps, req.Email, models.OTPPurposePasswordReset, "", 5*time.Minute)
+	if err == ErrOTPCooldown {
+		// Same response as a successful send so the cooldown does not reveal the account
+		log.Warnf("OTP requested again within cooldown for email %s, not resending", req.Email)
+		return nil
 	}
-
-	_, err = otpCollection.UpdateOne(
-		context.Background(),
-		bson.M{"email": req.Email},
-		bson.M{"$set": otpRecord},
-		options.Update().SetUpsert(true),
-	)
-
 	if err != nil {
 		log.Errorf("Failed to store OTP in database for email %s: %v", req.Email, err)
 		return errors.New("Failed to store OTP")
 	}
 	log.Infof("Successfully stored OTP for email %s", req.Email)
 
-	// 4. Send Email
+	// 3. Send Email
 	if err := utils.SendOTPEmail(req.Email, otp); err != nil {
 		log.Errorf("Failed to send OTP email to %s: %v", req.Email, err)
 		// Don't fail the request, just log it. In dev, we can see the code in logs.
@@ -93,26 +80,22 @@ func (h *passwordResetService) VerifyOTP(c *gin.Context, req models.VerifyOTPReq
 	ctx, span := otel.Tracer("password-reset-service").Start(c.Request.Context(), "VerifyOTP")
 	defer span.End()
 
-	var otpRecord models.OTPRecord
 	log := utils.NewLogger("PasswordResetService", "VerifyOTP").WithContext(ctx)
-	err := h.db.Collection("otps").FindOne(context.Background(), bson.M{
-		"email": req.Email,
-		"code":  req.Code,
-		"expires_at": bson.M{"$gt": time.Now()},
-	}).Decode(&otpRecord)
+	req.Email = utils.NormalizeEmail(req.Email)
 
-	if err != nil {
+	if err := consumeOTPFromIP(ctx, h.otps, h.otpIPLimiter, c.ClientIP(), req.Email, models.OTPPurposePasswordReset, "", req.Code); err != nil {
 		log.Warnf("Invalid or expired OTP attempt for email %s", req.Email)
-		return "", errors.New("Invalid or expired OTP")
+		return "", err
 	}
 
-	// Success! Delete the OTP so it can't be reused
-	h.db.Collection("otps").DeleteOne(context.Background(), bson.M{"email": req.Email})
+	user, err := h.users.FindByEmail(ctx, req.Email)
+	if err != nil {
+		log.Errorf("User %s vanished after OTP verification: %v", req.Email, err)
+		return "", ErrInvalidOTP
+	}
 
-	// Issue a temporary Reset Token (using the same JWT utility but with short expiry)
-	// We'll reuse GenerateAccessToken but maybe add a specific "reset" claim in a real app
-	// For now, let's just generate a standard token that identifies the user
-	token, err := utils.GenerateAccessToken("RESET:"+req.Email, req.Email, "reset_only")
+	// Issue a short-lived, single-use token that is only accepted by ResetPassword
+	token, _, err := utils.GenerateResetToken(user.ID.Hex(), user.Email)
 	if err != nil {
 		log.Errorf("Failed to generate reset token for email %s: %v", req.Email, err)
 		return "", errors.New("Failed to generate reset token")
@@ -128,11 +111,23 @@ func (h *passwordResetService) ResetPassword(c *gin.Context, req models.ResetPas
 
 	// 1. Verify Reset Token
 	log := utils.NewLogger("PasswordResetService", "ResetPassword").WithContext(ctx)
-	claims, err := utils.ValidateToken(req.ResetToken)
-	if err != nil || claims.Role != "reset_only" {
-		log.Warnf("Invalid or expired reset token: %s", req.ResetToken)
+	claims, err := utils.ValidateResetToken(req.ResetToken)
+	if err != nil {
+		log.Warnf("Invalid or expired reset token: %v", err)
 		return errors.New("Invalid or expired reset token")
 	}
+	// A rejected password leaves the token usable for another try
+	if err := h.passwordPolicy.Check(ctx, req.NewPassword, claims.Email); err != nil {
+		return err
+	}
+	// Burn the token before using it so it cannot be replayed, even concurrently
+	if err := h.revocationService.BurnToken(ctx, claims.ID, claims.UserID, claims.ExpiresAt.Time); err != nil {
+		if err == ErrTokenAlreadyUsed {
+			return errors.New("Invalid or expired reset token")
+		}
+		log.Errorf("Failed to burn reset token %s: %v", claims.ID, err)
+		return errors.New("Failed to reset password")
+	}
 
 	// 2. Hash new password
 	hashedPassword, err := utils.HashPassword(req.NewPassword)
@@ -140,26 +135,26 @@ func (h *passwordResetService) ResetPassword(c *gin.Context, req models.ResetPas
 		return errors.New("Failed to hash password")
 	}
 
-	// 3. Update user in MongoDB
-	_, err = h.db.Collection("users").UpdateOne(
-		context.Background(),
-		bson.M{"email": claims.Email},
-		bson.M{"$set": bson.M{"password": hashedPassword, "updated_at": time.Now()}},
-	)
-
+	// 3. Update the user, unless the email changed since the token was issued
+	user, err := h.users.FindByID(ctx, claims.UserID)
+	if err != nil || user.Email != claims.Email {
+		log.Warnf("Reset token for %s no longer matches an account", claims.Email)
+		return errors.New("Invalid or expired reset token")
+	}
+	// Completing the OTP flow proves ownership of the email address
+	verified := true
+	_, err = h.users.Update(ctx, claims.UserID, repository.UserUpdate{Password: &hashedPassword, EmailVerified: &verified})
 	if err != nil {
 		log.Errorf("Failed to update password in database for email %s: %v", claims.Email, err)
 		return errors.New("Failed to update password")
 	}
 	log.Infof("Password updated successfully in database for email %s", claims.Email)
 
-	return nil
-}
-
-func generateOTP() (string, error) {
-	n, err := rand.Int(rand.Reader, big.NewInt(900000))
-	if err != nil {
-		return "", err
+	// 4. Sign out every session; whoever held the old password may hold one of them
+	if err := h.tokenService.LogoutAll(ctx, claims.UserID); err != nil {
+		log.Errorf("Failed to revoke sessions after password reset for email %s: %v", claims.Email, err)
+		return errors.New("Failed to revoke existing sessions")
 	}
-	return fmt.Sprintf("%06d", n.Int64()+100000), nil
+
+	return nil
 }
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"lem-be/models"
+	"lem-be/utils"
+)
+
+const newTestPassword = "Battery-Staple-7"
+
+func newTestPasswordResetService(env *testEnv) PasswordResetService {
+	return NewPasswordResetService(env.repos.Users, env.repos.OTPs, env.otpIPLimiter, env.tokens, env.revocations, PasswordStrengthPolicy())
+}
+
+// resetToken runs the OTP step of a password reset and returns the reset token
+func resetToken(t *testing.T, env *testEnv, service PasswordResetService, email string) string {
+	t.Helper()
+	code, err := issueOTP(context.Background(), env.repos.OTPs, email, models.OTPPurposePasswordReset, "", time.Minute)
+	if err != nil {
+		t.Fatalf("issueOTP: %v", err)
+	}
+	token, err := service.VerifyOTP(newGinContext("192.0.2.1"), models.VerifyOTPRequest{Email: email, Code: code})
+	if err != nil {
+		t.Fatalf("VerifyOTP: %v", err)
+	}
+	return token
+}
+
+func TestResetPasswordTokenIsSingleUse(t *testing.T) {
+	env := newTestEnv(t)
+	env.createUser(t, "alice@example.com")
+	service := newTestPasswordResetService(env)
+	token := resetToken(t, env, service, "alice@example.com")
+
+	req := models.ResetPasswordRequest{ResetToken: token, NewPassword: newTestPassword}
+	if err := service.ResetPassword(newGinContext("192.0.2.1"), req); err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+	req.NewPassword = "Another-Secret-5"
+	if err := service.ResetPassword(newGinContext("192.0.2.1"), req); err == nil {
+		t.Fatal("reset token was accepted twice")
+	}
+
+	if _, err := env.login.Login(context.Background(), models.LoginRequest{Email: "alice@example.com", Password: newTestPassword}, "192.0.2.1"); err != nil {
+		t.Fatalf("login with the new password: %v", err)
+	}
+}
+
+func TestResetPasswordRejectedPasswordKeepsToken(t *testing.T) {
+	env := newTestEnv(t)
+	env.createUser(t, "alice@example.com")
+	service := newTestPasswordResetService(env)
+	token := resetToken(t, env, service, "alice@example.com")
+
+	var policyErr *PasswordPolicyError
+	err := service.ResetPassword(newGinContext("192.0.2.1"), models.ResetPasswordRequest{ResetToken: token, NewPassword: "password1"})
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("weak password: err = %v, want *PasswordPolicyError", err)
+	}
+	if err := service.ResetPassword(newGinContext("192.0.2.1"), models.ResetPasswordRequest{ResetToken: token, NewPassword: newTestPassword}); err != nil {
+		t.Fatalf("retry with a strong password: %v", err)
+	}
+}
+
+func TestResetPasswordRevokesSessions(t *testing.T) {
+	env := newTestEnv(t)
+	env.createUser(t, "alice@example.com")
+	session := env.loginUser(t, "alice@example.com")
+	service := newTestPasswordResetService(env)
+	token := resetToken(t, env, service, "alice@example.com")
+
+	if err := service.ResetPassword(newGinContext("192.0.2.1"), models.ResetPasswordRequest{ResetToken: token, NewPassword: newTestPassword}); err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+
+	if _, err := utils.ValidateToken(session.AccessToken); !errors.Is(err, utils.ErrTokenRevoked) {
+		t.Errorf("access token after reset: err = %v, want ErrTokenRevoked", err)
+	}
+	if _, err := env.tokens.Refresh(context.Background(), session.RefreshToken); err == nil {
+		t.Error("refresh token was accepted after reset")
+	}
+}
+
+func TestVerifyOTPRequiresTheIssuedCode(t *testing.T) {
+	env := newTestEnv(t)
+	env.createUser(t, "alice@example.com")
+	service := newTestPasswordResetService(env)
+	code, err := issueOTP(context.Background(), env.repos.OTPs, "alice@example.com", models.OTPPurposePasswordReset, "", time.Minute)
+	if err != nil {
+		t.Fatalf("issueOTP: %v", err)
+	}
+
+	if _, err := service.VerifyOTP(newGinContext("192.0.2.1"), models.VerifyOTPRequest{Email: "alice@example.com", Code: wrongCode(code)}); err == nil {
+		t.Fatal("wrong code was accepted")
+	}
+	// Emails are matched case-insensitively
+	if _, err := service.VerifyOTP(newGinContext("192.0.2.1"), models.VerifyOTPRequest{Email: "Alice@Example.com", Code: code}); err != nil {
+		t.Fatalf("VerifyOTP: %v", err)
+	}
+}
@@ -0,0 +1,220 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"lem-be/models"
+	"lem-be/repository"
+	"lem-be/utils"
+
+	"go.opentelemetry.io/otel"
+)
+
+var ErrPasswordlessDisabled = errors.New("passwordless login is not enabled")
+
+// Passwordless login modes selected with PASSWORDLESS_LOGIN
+const (
+	PasswordlessOff  = "off"
+	PasswordlessCode = "code"
+	PasswordlessLink = "link"
+	PasswordlessBoth = "both"
+)
+
+// PasswordlessPolicy configures email sign-in for a deployment
+type PasswordlessPolicy struct {
+	Mode string
+	TTL  time.Duration
+	// DeviceBinding only accepts a code or link from the browser that asked for it
+	DeviceBinding bool
+	// LinkURL is the frontend page emailed links open. The email and link token travel in the URL fragment,
+	// which browsers never send to a server, and the page redeems them with POST /auth/passwordless/verify.
+	// Opening the link therefore never signs in by itself, so link scanners cannot burn the token.
+	LinkURL string
+}
+
+// PasswordlessLoginPolicy reads PASSWORDLESS_LOGIN (off, code, link or both), PASSWORDLESS_CODE_TTL,
+// PASSWORDLESS_DEVICE_BINDING and PASSWORDLESS_LINK_URL. Passwordless login is off unless enabled.
+func PasswordlessLoginPolicy() PasswordlessPolicy {
+	mode := strings.ToLower(strings.TrimSpace(os.Getenv("PASSWORDLESS_LOGIN")))
+	switch mode {
+	case PasswordlessCode, PasswordlessLink, PasswordlessBoth:
+	default:
+		mode = PasswordlessOff
+	}
+	linkURL := os.Getenv("PASSWORDLESS_LINK_URL")
+	if linkURL == "" {
+		linkURL = "http://localhost:3000/auth/passwordless"
+	}
+	return PasswordlessPolicy{
+		Mode:          mode,
+		TTL:           utils.GetEnvDuration("PASSWORDLESS_CODE_TTL", 10*time.Minute),
+		DeviceBinding: os.Getenv("PASSWORDLESS_DEVICE_BINDING") != "false",
+		LinkURL:       linkURL,
+	}
+}
+
+// allows reports whether typed codes (or emailed link tokens when viaLink) are issued and accepted
+func (p PasswordlessPolicy) allows(viaLink bool) bool {
+	if viaLink {
+		return p.Mode == PasswordlessLink || p.Mode == PasswordlessBoth
+	}
+	return p.Mode == PasswordlessCode || p.Mode == PasswordlessBoth
+}
+
+// PasswordlessService signs users in with a single-use code or link sent to their email
+type PasswordlessService interface {
+	// Start emails a sign-in code, link or both. device is the secret the requesting browser already holds, if any;
+	// the returned secret must be stored on that browser when device binding is enabled.
+	Start(ctx context.Context, req models.PasswordlessStartRequest, device string) (string, error)
+	Verify(ctx context.Context, req models.PasswordlessVerifyRequest, device, clientIP string) (models.LoginResponse, error)
+}
+
+type passwordlessService struct {
+	users        repository.UserRepository
+	otps         repository.OTPRepository
+	tokenService TokenService
+	otpIPLimiter AttemptLimiter
+	policy       PasswordlessPolicy
+}
+
+func NewPasswordlessService(users repository.UserRepository, otps repository.OTPRepository, tokenService TokenService, otpIPLimiter AttemptLimiter, policy PasswordlessPolicy) PasswordlessService {
+	return &passwordlessService{users: users, otps: otps, tokenService: tokenService, otpIPLimiter: otpIPLimiter, policy: policy}
+}
+
+// Start sends the code without revealing whether the email belongs to an account
+func (s *passwordlessService) Start(ctx context.Context, req models.PasswordlessStartRequest, device string) (string, error) {
+	ctx, span := otel.Tracer("passwordless-service").Start(ctx, "Start")
+	defer span.End()
+
+	log := utils.NewLogger("PasswordlessService", "Start").WithContext(ctx)
+	req.Email = utils.NormalizeEmail(req.Email)
+	if s.policy.Mode == PasswordlessOff {
+		return "", ErrPasswordlessDisabled
+	}
+
+	if !s.policy.DeviceBinding {
+		device = ""
+	} else if device == "" {
+		var err error
+		if device, err = utils.GenerateRandomString(32); err != nil {
+			return "", err
+		}
+	}
+
+	user, err := s.users.FindByEmail(ctx, req.Email)
+	if err == repository.ErrNotFound || (err == nil && user.Disabled) {
+		log.Warnf("Passwordless login requested for unknown or disabled account %s", req.Email)
+		return device, nil
+	}
+	if err != nil {
+		log.Errorf("Database error during user lookup for email %s: %v", req.Email, err)
+		return "", err
+	}
+
+	// The link carries its own long random token, so link mode never accepts a guessable 6-digit code
+	var emailedCode, link string
+	if s.policy.allows(false) {
+		emailedCode, err = issueOTP(ctx, s.otps, req.Email, models.OTPPurposeLogin, device, s.policy.TTL)
+	}
+	if err == nil && s.policy.allows(true) {
+		var token string
+		token, err = issueOTPWith(ctx, s.otps, req.Email, models.OTPPurposeLoginLink, device, s.policy.TTL, generateLinkToken)
+		link = s.policy.link(req.Email, token)
+	}
+	if err == ErrOTPCooldown {
+		log.Warnf("Sign-in email requested again within cooldown for email %s, not resending", req.Email)
+		return device, nil
+	}
+	if err != nil {
+		log.Errorf("Failed to store sign-in code for email %s: %v", req.Email, err)
+		return "", errors.New("Failed to store sign-in code")
+	}
+	if err := utils.SendLoginEmail(req.Email, emailedCode, link, s.policy.TTL); err != nil {
+		log.Errorf("Failed to send sign-in email to %s: %v", req.Email, err)
+		// Don't fail the request; the user can ask for a new code
+	}
+	return device, nil
+}
+
+// Verify redeems a code or link token for a token pair, or an MFA challenge when the account has a second factor
+func (s *passwordlessService) Verify(ctx context.Context, req models.PasswordlessVerifyRequest, device, clientIP string) (models.LoginResponse, error) {
+	ctx, span := otel.Tracer("passwordless-service").Start(ctx, "Verify")
+	defer span.End()
+
+	log := utils.NewLogger("PasswordlessService", "Verify").WithContext(ctx)
+	req.Email = utils.NormalizeEmail(req.Email)
+	viaLink := req.Token != ""
+	if !s.policy.allows(viaLink) {
+		return models.LoginResponse{}, ErrPasswordlessDisabled
+	}
+
+	purpose, secret := models.OTPPurposeLogin, req.Code
+	if viaLink {
+		purpose, secret = models.OTPPurposeLoginLink, req.Token
+	}
+	if err := consumeOTPFromIP(ctx, s.otps, s.otpIPLimiter, clientIP, req.Email, purpose, device, secret); err != nil {
+		log.Warnf("Invalid sign-in code for email %s: %v", req.Email, err)
+		return models.LoginResponse{}, err
+	}
+	// In "both" mode the email held a code and a link; whichever was not used goes too
+	otherPurpose := models.OTPPurposeLoginLink
+	if viaLink {
+		otherPurpose = models.OTPPurposeLogin
+	}
+	if err := s.otps.Delete(ctx, req.Email, otherPurpose); err != nil {
+		log.Errorf("Failed to drop unused sign-in secret for email %s: %v", req.Email, err)
+	}
+
+	user, err := s.users.FindByEmail(ctx, req.Email)
+	if err != nil {
+		log.Errorf("User %s vanished after sign-in code verification: %v", req.Email, err)
+		return models.LoginResponse{}, ErrInvalidOTP
+	}
+	if user.Disabled {
+		return models.LoginResponse{}, ErrAccountDisabled
+	}
+
+	// Redeeming the code proves ownership of the email address. A pending registration's password
+	// was chosen by whoever registered the email, so it goes with the registration's codes;
+	// the owner can set one through a password reset.
+	if !user.EmailVerified {
+		verified := true
+		update := repository.UserUpdate{EmailVerified: &verified}
+		if user.Provider == "local" {
+			noPassword := ""
+			update.Password = &noPassword
+			if err := s.otps.Delete(ctx, req.Email, models.OTPPurposeEmailVerification); err != nil {
+				log.Errorf("Failed to drop verification codes for %s: %v", req.Email, err)
+				return models.LoginResponse{}, err
+			}
+		}
+		if user, err = s.users.Update(ctx, user.ID.Hex(), update); err != nil {
+			log.Errorf("Failed to mark email verified for %s: %v", req.Email, err)
+			return models.LoginResponse{}, err
+		}
+	}
+
+	if mfaEnabled(user) {
+		log.Infof("Passwordless login for %s requires a second factor", user.Email)
+		return issueMFAChallenge(user, []string{utils.AMREmail})
+	}
+
+	log.Infof("Passwordless login completed for %s", user.Email)
+	return s.tokenService.IssueTokens(ctx, user, []string{utils.AMREmail})
+}
+
+// link builds the emailed link to the frontend page, carrying the email and link token in the fragment
+func (p PasswordlessPolicy) link(email, token string) string {
+	fragment := url.Values{"email": {email}, "token": {token}}
+	return p.LinkURL + "#" + fragment.Encode()
+}
+
+// generateLinkToken returns a 256-bit sign-in link token
+func generateLinkToken() (string, error) {
+	return utils.GenerateRandomString(32)
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"lem-be/models"
+	"lem-be/repository"
+)
+
+func newTestPasswordlessService(env *testEnv, mode string) PasswordlessService {
+	policy := PasswordlessLoginPolicy()
+	policy.Mode = mode
+	policy.DeviceBinding = false
+	return NewPasswordlessService(env.repos.Users, env.repos.OTPs, env.tokens, env.otpIPLimiter, policy)
+}
+
+// Link mode emails only a link token and never accepts a typed code
+func TestPasswordlessLinkModeAcceptsOnlyLinkTokens(t *testing.T) {
+	env := newTestEnv(t)
+	env.createUser(t, "alice@example.com")
+	service := newTestPasswordlessService(env, PasswordlessLink)
+	ctx := context.Background()
+
+	if _, err := service.Start(ctx, models.PasswordlessStartRequest{Email: "alice@example.com"}, ""); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if _, err := env.repos.OTPs.Find(ctx, "alice@example.com", models.OTPPurposeLogin); err != repository.ErrNotFound {
+		t.Fatalf("link mode stored a sign-in code: err = %v", err)
+	}
+	if _, err := env.repos.OTPs.Find(ctx, "alice@example.com", models.OTPPurposeLoginLink); err != nil {
+		t.Fatalf("link mode stored no link token: %v", err)
+	}
+
+	req := models.PasswordlessVerifyRequest{Email: "alice@example.com", Code: "123456"}
+	if _, err := service.Verify(ctx, req, "", "192.0.2.1"); !errors.Is(err, ErrPasswordlessDisabled) {
+		t.Fatalf("typed code in link mode: err = %v, want ErrPasswordlessDisabled", err)
+	}
+}
+
+func TestPasswordlessVerifyLinkToken(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.createUser(t, "alice@example.com")
+	service := newTestPasswordlessService(env, PasswordlessBoth)
+	ctx := context.Background()
+
+	code, err := issueOTP(ctx, env.repos.OTPs, "alice@example.com", models.OTPPurposeLogin, "", PasswordlessLoginPolicy().TTL)
+	if err != nil {
+		t.Fatalf("issueOTP: %v", err)
+	}
+	token, err := issueOTPWith(ctx, env.repos.OTPs, "alice@example.com", models.OTPPurposeLoginLink, "", PasswordlessLoginPolicy().TTL, generateLinkToken)
+	if err != nil {
+		t.Fatalf("issueOTPWith: %v", err)
+	}
+
+	// The typed code is no link token
+	if _, err := service.Verify(ctx, models.PasswordlessVerifyRequest{Email: "alice@example.com", Token: code}, "", "192.0.2.1"); !errors.Is(err, ErrInvalidOTP) {
+		t.Fatalf("code sent as link token: err = %v, want ErrInvalidOTP", err)
+	}
+
+	tokens, err := service.Verify(ctx, models.PasswordlessVerifyRequest{Email: "alice@example.com", Token: token}, "", "192.0.2.1")
+	if err != nil {
+		t.Fatalf("Verify link token: %v", err)
+	}
+	if claims := mustValidate(t, tokens.AccessToken); claims.UserID != user.ID.Hex() {
+		t.Errorf("signed in as %s, want %s", claims.UserID, user.ID.Hex())
+	}
+
+	// The email's code went with the link
+	if _, err := service.Verify(ctx, models.PasswordlessVerifyRequest{Email: "alice@example.com", Code: code}, "", "192.0.2.1"); !errors.Is(err, ErrInvalidOTP) {
+		t.Fatalf("code after the link was used: err = %v, want ErrInvalidOTP", err)
+	}
+}
+
+// Signing in by email to a pending registration must not keep the password its registrant chose
+func TestPasswordlessVerifyPendingAccountDropsRegistrationPassword(t *testing.T) {
+	env := newTestEnv(t)
+	registration := NewRegistrationService(env.repos.Users, env.repos.OTPs, PasswordStrengthPolicy())
+	service := newTestPasswordlessService(env, PasswordlessCode)
+	ctx := context.Background()
+
+	if err := registration.Register(ctx, models.RegisterRequest{Email: "alice@example.com", Password: "Attacker-Chosen-7"}); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	code, err := issueOTP(ctx, env.repos.OTPs, "alice@example.com", models.OTPPurposeLogin, "", PasswordlessLoginPolicy().TTL)
+	if err != nil {
+		t.Fatalf("issueOTP: %v", err)
+	}
+	if _, err := service.Verify(ctx, models.PasswordlessVerifyRequest{Email: "alice@example.com", Code: code}, "", "192.0.2.1"); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	if _, err := env.login.Login(ctx, models.LoginRequest{Email: "alice@example.com", Password: "Attacker-Chosen-7"}, "192.0.2.1"); !errors.Is(err, ErrInvalidPassword) {
+		t.Fatalf("registrant's password after passwordless sign-in: err = %v, want ErrInvalidPassword", err)
+	}
+	if _, err := env.repos.OTPs.Find(ctx, "alice@example.com", models.OTPPurposeEmailVerification); err != repository.ErrNotFound {
+		t.Errorf("registration's verification code is still outstanding: err = %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"regexp"
+	"time"
+	_ "time/tzdata" // Timezone validation must not depend on the host's zoneinfo
+
+	"lem-be/models"
+	"lem-be/repository"
+	"lem-be/utils"
+
+	"go.opentelemetry.io/otel"
+)
+
+var (
+	ErrInvalidAvatarURL = errors.New("avatar_url must be an absolute http(s) URL")
+	ErrInvalidLocale    = errors.New("locale must be a BCP 47 language tag such as en-US")
+	ErrInvalidTimezone  = errors.New("timezone must be an IANA time zone name such as Europe/Berlin")
+)
+
+// localePattern accepts BCP 47 tags: a 2-3 letter language followed by subtags
+var localePattern = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+type ProfileService interface {
+	GetProfile(ctx context.Context, userID string) (models.User, error)
+	UpdateProfile(ctx context.Context, userID string, req models.UpdateProfileRequest) (models.User, error)
+}
+
+type profileService struct {
+	users repository.UserRepository
+}
+
+func NewProfileService(users repository.UserRepository) ProfileService {
+	return &profileService{users: users}
+}
+
+// GetProfile returns the user identified by the access token
+func (s *profileService) GetProfile(ctx context.Context, userID string) (models.User, error) {
+	ctx, span := otel.Tracer("profile-service").Start(ctx, "GetProfile")
+	defer span.End()
+
+	log := utils.NewLogger("ProfileService", "GetProfile").WithContext(ctx)
+	user, err := s.users.FindByID(ctx, userID)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			log.Warnf("User %s not found", userID)
+			return models.User{}, ErrUserNotFound
+		}
+		log.Errorf("Database error during user lookup for %s: %v", userID, err)
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+// UpdateProfile applies the provided profile fields. Only profile.* paths are ever written.
+func (s *profileService) UpdateProfile(ctx context.Context, userID string, req models.UpdateProfileRequest) (models.User, error) {
+	ctx, span := otel.Tracer("profile-service").Start(ctx, "UpdateProfile")
+	defer span.End()
+
+	log := utils.NewLogger("ProfileService", "UpdateProfile").WithContext(ctx)
+	if err := validateProfileUpdate(req); err != nil {
+		return models.User{}, err
+	}
+
+	user, err := s.users.Update(ctx, userID, repository.UserUpdate{
+		DisplayName: req.DisplayName,
+		AvatarURL:   req.AvatarURL,
+		Locale:      req.Locale,
+		Timezone:    req.Timezone,
+	})
+	if err != nil {
+		if err == repository.ErrNotFound {
+			return models.User{}, ErrUserNotFound
+		}
+		log.Errorf("Failed to update profile for user %s: %v", userID, err)
+		return models.User{}, err
+	}
+
+	log.Infof("Profile updated for user %s", userID)
+	return user, nil
+}
+
+// validateProfileUpdate checks the formats binding tags cannot express. Empty strings clear a field.
+func validateProfileUpdate(req models.UpdateProfileRequest) error {
+	if req.AvatarURL != nil && *req.AvatarURL != "" {
+		u, err := url.Parse(*req.AvatarURL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return ErrInvalidAvatarURL
+		}
+	}
+	if req.Locale != nil && *req.Locale != "" && !localePattern.MatchString(*req.Locale) {
+		return ErrInvalidLocale
+	}
+	if req.Timezone != nil && *req.Timezone != "" {
+		if _, err := time.LoadLocation(*req.Timezone); err != nil || *req.Timezone == "Local" {
+			return ErrInvalidTimezone
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"lem-be/models"
+	"lem-be/repository"
+	"lem-be/utils"
+
+	"go.opentelemetry.io/otel"
+)
+
+var ErrSecondFactorRequired = errors.New("accounts with two-factor authentication must re-authenticate with a two-factor code")
+
+// ReauthService upgrades the caller's session after a fresh password or second-factor check,
+// which routes behind RequireRecentAuth ask for
+type ReauthService interface {
+	Reauthenticate(ctx context.Context, claims *utils.JWTClaims, req models.ReauthRequest) (models.LoginResponse, error)
+}
+
+type reauthService struct {
+	users          repository.UserRepository
+	tokenService   TokenService
+	mfaService     MFAService
+	accountLimiter AttemptLimiter
+}
+
+// NewReauthService shares accountLimiter with the login service so password guesses count in both places
+func NewReauthService(users repository.UserRepository, tokenService TokenService, mfaService MFAService, accountLimiter AttemptLimiter) ReauthService {
+	return &reauthService{users: users, tokenService: tokenService, mfaService: mfaService, accountLimiter: accountLimiter}
+}
+
+// Reauthenticate checks every credential in req. Users with MFA must include a code, so a stolen
+// session plus a leaked password is not enough to reach sensitive operations.
+func (s *reauthService) Reauthenticate(ctx context.Context, claims *utils.JWTClaims, req models.ReauthRequest) (models.LoginResponse, error) {
+	ctx, span := otel.Tracer("reauth-service").Start(ctx, "Reauthenticate")
+	defer span.End()
+
+	log := utils.NewLogger("ReauthService", "Reauthenticate").WithContext(ctx)
+	user, err := s.users.FindByID(ctx, claims.UserID)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			return models.LoginResponse{}, ErrUserNotFound
+		}
+		return models.LoginResponse{}, err
+	}
+	if user.Disabled {
+		return models.LoginResponse{}, ErrAccountDisabled
+	}
+	hasCode := req.Code != "" || req.RecoveryCode != ""
+	if mfaEnabled(user) && !hasCode {
+		return models.LoginResponse{}, ErrSecondFactorRequired
+	}
+
+	var amr []string
+	if req.Password != "" {
+		if user.Password == "" {
+			return models.LoginResponse{}, ErrNoPasswordSet
+		}
+		// The guess is counted before the password is compared, so parallel guesses cannot outrun the lockout
+		accountKey := utils.NormalizeEmail(user.Email)
+		if err := s.accountLimiter.Reserve(ctx, accountKey); err != nil {
+			log.Warnf("Re-authentication throttled for %s: %v", user.Email, err)
+			return models.LoginResponse{}, err
+		}
+		if !utils.ComparePasswords(user.Password, req.Password) {
+			log.Warnf("Invalid password in re-authentication for %s", user.Email)
+			return models.LoginResponse{}, ErrInvalidPassword
+		}
+		if err := s.accountLimiter.Reset(ctx, accountKey); err != nil {
+			log.Errorf("Failed to reset failed login attempts for %s: %v", user.Email, err)
+		}
+		amr = append(amr, utils.AMRPassword)
+	}
+	if hasCode {
+		if err := s.mfaService.CheckCode(ctx, claims.UserID, req.Code, req.RecoveryCode); err != nil {
+			return models.LoginResponse{}, err
+		}
+		amr = append(amr, utils.AMROTP)
+	}
+	if len(amr) > 1 {
+		amr = append(amr, utils.AMRMultiFactor)
+	}
+
+	log.Infof("User %s re-authenticated with %v", user.Email, amr)
+	return s.tokenService.Reauthenticate(ctx, claims, user, amr)
+}
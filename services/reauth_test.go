@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"lem-be/models"
+)
+
+func newTestReauthService(env *testEnv) ReauthService {
+	mfa := NewMFAService(env.repos.Users, env.tokens, env.revocations, NewAttemptLimiter(env.repos.Attempts, "mfa-user", MFAPolicy()))
+	return NewReauthService(env.repos.Users, env.tokens, mfa, env.accountLimiter)
+}
+
+func TestReauthenticateRefreshesAuthTime(t *testing.T) {
+	env := newTestEnv(t)
+	env.createUser(t, "alice@example.com")
+	session := env.loginUser(t, "alice@example.com")
+	claims := mustValidate(t, session.AccessToken)
+
+	// auth_time has whole-second precision
+	time.Sleep(time.Until(claims.AuthTime.Time.Add(time.Second)))
+	upgraded, err := newTestReauthService(env).Reauthenticate(context.Background(), claims, models.ReauthRequest{Password: testPassword})
+	if err != nil {
+		t.Fatalf("Reauthenticate: %v", err)
+	}
+	upgradedClaims := mustValidate(t, upgraded.AccessToken)
+	if !upgradedClaims.AuthTime.Time.After(claims.AuthTime.Time) {
+		t.Errorf("auth_time = %v, want later than %v", upgradedClaims.AuthTime, claims.AuthTime)
+	}
+	if upgradedClaims.SessionID != claims.SessionID {
+		t.Errorf("session changed on re-authentication: %s -> %s", claims.SessionID, upgradedClaims.SessionID)
+	}
+
+	// Tokens refreshed later in the session keep the new auth_time
+	refreshed, err := env.tokens.Refresh(context.Background(), session.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if refreshedClaims := mustValidate(t, refreshed.AccessToken); !refreshedClaims.AuthTime.Time.Equal(upgradedClaims.AuthTime.Time) {
+		t.Errorf("refreshed auth_time = %v, want %v", refreshedClaims.AuthTime, upgradedClaims.AuthTime)
+	}
+}
+
+func TestReauthenticateWrongPasswordIsThrottled(t *testing.T) {
+	env := newTestEnv(t)
+	env.createUser(t, "alice@example.com")
+	claims := mustValidate(t, env.loginUser(t, "alice@example.com").AccessToken)
+	service := newTestReauthService(env)
+
+	if _, err := service.Reauthenticate(context.Background(), claims, models.ReauthRequest{Password: "Wrong-Password-1"}); !errors.Is(err, ErrInvalidPassword) {
+		t.Fatalf("wrong password: err = %v, want ErrInvalidPassword", err)
+	}
+	// The failure counts against the account like a failed login, so the next guess must wait
+	var throttled *TooManyAttemptsError
+	if _, err := service.Reauthenticate(context.Background(), claims, models.ReauthRequest{Password: testPassword}); !errors.As(err, &throttled) {
+		t.Fatalf("retry within the backoff: err = %v, want *TooManyAttemptsError", err)
+	}
+	if _, err := env.login.Login(context.Background(), models.LoginRequest{Email: "alice@example.com", Password: testPassword}, "192.0.2.1"); !errors.As(err, &throttled) {
+		t.Fatalf("login within the backoff: err = %v, want *TooManyAttemptsError", err)
+	}
+}
+
+func TestReauthenticateEndedSession(t *testing.T) {
+	env := newTestEnv(t)
+	env.createUser(t, "alice@example.com")
+	claims := mustValidate(t, env.loginUser(t, "alice@example.com").AccessToken)
+	if err := env.tokens.Logout(context.Background(), claims); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+
+	if _, err := newTestReauthService(env).Reauthenticate(context.Background(), claims, models.ReauthRequest{Password: testPassword}); !errors.Is(err, ErrSessionEnded) {
+		t.Fatalf("re-authentication of an ended session: err = %v, want ErrSessionEnded", err)
+	}
+}
+
+// Parallel wrong passwords must not get more tries than the login lockout allows
+func TestReauthenticateCountsConcurrentGuesses(t *testing.T) {
+	t.Setenv("LOGIN_BACKOFF_BASE", "0")
+	t.Setenv("LOGIN_MAX_FAILED_ATTEMPTS", "5")
+	env := newTestEnv(t)
+	env.createUser(t, "alice@example.com")
+	claims := mustValidate(t, env.loginUser(t, "alice@example.com").AccessToken)
+	service := newTestReauthService(env)
+
+	errs := guessConcurrently(30, func(int) error {
+		_, err := service.Reauthenticate(context.Background(), claims, models.ReauthRequest{Password: "Wrong-Password-1"})
+		return err
+	})
+	if checked := countWrongGuesses(t, errs, ErrInvalidPassword); checked > 5 {
+		t.Fatalf("%d passwords were compared, want at most 5", checked)
+	}
+}
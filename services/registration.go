@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"time"
+
+	"lem-be/constants"
+	"lem-be/models"
+	"lem-be/repository"
+	"lem-be/utils"
+
+	"go.opentelemetry.io/otel"
+)
+
+var (
+	ErrInvalidVerificationCode = errors.New("invalid or expired verification code")
+)
+
+// emailVerificationTTL is how long a verification code stays valid
+const emailVerificationTTL = 24 * time.Hour
+
+type RegistrationService interface {
+	Register(ctx context.Context, req models.RegisterRequest) error
+	VerifyEmail(ctx context.Context, req models.VerifyEmailRequest) error
+	ResendVerification(ctx context.Context, req models.ResendVerificationRequest) error
+}
+
+type registrationService struct {
+	users          repository.UserRepository
+	otps           repository.OTPRepository
+	passwordPolicy PasswordPolicy
+}
+
+func NewRegistrationService(users repository.UserRepository, otps repository.OTPRepository, passwordPolicy PasswordPolicy) RegistrationService {
+	return &registrationService{users: users, otps: otps, passwordPolicy: passwordPolicy}
+}
+
+// Register creates an unverified local user and emails a verification code.
+// Registering an existing email does not create a second account and does not reveal that the email is taken.
+func (s *registrationService) Register(ctx context.Context, req models.RegisterRequest) error {
+	ctx, span := otel.Tracer("registration-service").Start(ctx, "Register")
+	defer span.End()
+
+	log := utils.NewLogger("RegistrationService", "Register").WithContext(ctx)
+	req.Email = utils.NormalizeEmail(req.Email)
+	// Checked before the lookup so the response does not depend on whether the email is taken
+	if err := s.passwordPolicy.Check(ctx, req.Password, req.Email); err != nil {
+		return err
+	}
+
+	existing, err := s.users.FindByEmail(ctx, req.Email)
+	if err != nil && err != repository.ErrNotFound {
+		log.Errorf("Database error during user lookup for email %s: %v", req.Email, err)
+		return err
+	}
+	pending := err == nil
+	if pending && (existing.Provider != "local" || existing.EmailVerified) {
+		log.Warnf("Registration attempted for existing email %s", req.Email)
+		return nil
+	}
+
+	hashedPassword, err := utils.HashPassword(req.Password)
+	if err != nil {
+		return errors.New("Failed to hash password")
+	}
+
+	// Nobody has proven they own a pending account's email yet, so the latest registration sets its password.
+	// Otherwise whoever registered the email first would choose the password its owner ends up verifying.
+	if pending {
+		if _, err := s.users.Update(ctx, existing.ID.Hex(), repository.UserUpdate{Password: &hashedPassword}); err != nil {
+			log.Errorf("Failed to replace password of pending account %s: %v", req.Email, err)
+			return err
+		}
+		if err := s.otps.Delete(ctx, req.Email, models.OTPPurposeEmailVerification); err != nil {
+			log.Errorf("Failed to drop verification codes for %s: %v", req.Email, err)
+			return err
+		}
+		log.Infof("Registration for pending account %s, replaced its password and resending verification", req.Email)
+		return s.sendVerification(ctx, req.Email)
+	}
+
+	user := models.User{
+		Email:         req.Email,
+		Password:      hashedPassword,
+		Role:          constants.RoleUser,
+		Provider:      "local",
+		EmailVerified: false,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	}
+	if err := s.users.Create(ctx, &user); err != nil {
+		log.Errorf("Failed to create user %s: %v", req.Email, err)
+		return err
+	}
+	log.Infof("Registered unverified user %s", req.Email)
+
+	return s.sendVerification(ctx, req.Email)
+}
+
+// VerifyEmail marks the local account as verified when the code matches
+func (s *registrationService) VerifyEmail(ctx context.Context, req models.VerifyEmailRequest) error {
+	ctx, span := otel.Tracer("registration-service").Start(ctx, "VerifyEmail")
+	defer span.End()
+
+	log := utils.NewLogger("RegistrationService", "VerifyEmail").WithContext(ctx)
+	req.Email = utils.NormalizeEmail(req.Email)
+	if err := consumeOTP(ctx, s.otps, req.Email, models.OTPPurposeEmailVerification, "", req.Code); err != nil {
+		log.Warnf("Invalid or expired verification code for email %s", req.Email)
+		if err == ErrInvalidOTP {
+			return ErrInvalidVerificationCode
+		}
+		return err
+	}
+
+	user, err := s.users.FindByEmail(ctx, req.Email)
+	if err == repository.ErrNotFound || (err == nil && user.Provider != "local") {
+		return ErrInvalidVerificationCode
+	}
+	if err != nil {
+		log.Errorf("Database error during user lookup for email %s: %v", req.Email, err)
+		return err
+	}
+
+	verified := true
+	if _, err := s.users.Update(ctx, user.ID.Hex(), repository.UserUpdate{EmailVerified: &verified}); err != nil {
+		log.Errorf("Failed to mark email %s as verified: %v", req.Email, err)
+		return err
+	}
+
+	log.Infof("Email %s verified", req.Email)
+	return nil
+}
+
+// ResendVerification issues a new code for a pending local account
+func (s *registrationService) ResendVerification(ctx context.Context, req models.ResendVerificationRequest) error {
+	ctx, span := otel.Tracer("registration-service").Start(ctx, "ResendVerification")
+	defer span.End()
+
+	log := utils.NewLogger("RegistrationService", "ResendVerification").WithContext(ctx)
+	req.Email = utils.NormalizeEmail(req.Email)
+	user, err := s.users.FindByEmail(ctx, req.Email)
+	if err != nil || user.Provider != "local" || user.EmailVerified {
+		// Don't reveal whether the account exists or is already verified
+		log.Warnf("No pending verification for email %s", req.Email)
+		return nil
+	}
+
+	return s.sendVerification(ctx, req.Email)
+}
+
+// sendVerification stores a fresh verification code and emails it
+func (s *registrationService) sendVerification(ctx context.Context, email string) error {
+	log := utils.NewLogger("RegistrationService", "sendVerification").WithContext(ctx)
+
+	code, err := issueOTP(ctx, s.otps, email, models.OTPPurposeEmailVerification, "", emailVerificationTTL)
+	if err == ErrOTPCooldown {
+		log.Warnf("Verification code requested again within cooldown for email %s, not resending", email)
+		return nil
+	}
+	if err != nil {
+		log.Errorf("Failed to store verification code for email %s: %v", email, err)
+		return errors.New("Failed to store verification code")
+	}
+
+	if err := utils.SendVerificationEmail(email, code, verificationLink(email, code)); err != nil {
+		log.Errorf("Failed to send verification email to %s: %v", email, err)
+		// Don't fail the request; the user can ask for a new code
+	}
+	return nil
+}
+
+// verificationLink builds the emailed link to the frontend page, carrying the email and code in the fragment.
+// Browsers never send the fragment to a server, and the page confirms with POST /auth/verify-email,
+// so neither mail scanners following the link nor access logs ever see the code.
+func verificationLink(email, code string) string {
+	fragment := url.Values{"email": {email}, "code": {code}}
+	return emailVerificationURL() + "#" + fragment.Encode()
+}
+
+// emailVerificationURL is the frontend page emailed verification links open
+func emailVerificationURL() string {
+	if pageURL := os.Getenv("EMAIL_VERIFICATION_URL"); pageURL != "" {
+		return pageURL
+	}
+	return "http://localhost:3000/auth/verify-email"
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"lem-be/models"
+	"lem-be/utils"
+)
+
+// Registering a pending email again must not leave the first registrant's password on the account
+func TestRegisterPendingAccountReplacesPassword(t *testing.T) {
+	env := newTestEnv(t)
+	service := NewRegistrationService(env.repos.Users, env.repos.OTPs, PasswordStrengthPolicy())
+	ctx := context.Background()
+
+	if err := service.Register(ctx, models.RegisterRequest{Email: "alice@example.com", Password: "Attacker-Chosen-7"}); err != nil {
+		t.Fatalf("first Register: %v", err)
+	}
+	first, err := env.repos.OTPs.Find(ctx, "alice@example.com", models.OTPPurposeEmailVerification)
+	if err != nil {
+		t.Fatalf("Find first code: %v", err)
+	}
+
+	if err := service.Register(ctx, models.RegisterRequest{Email: "Alice@example.com", Password: testPassword}); err != nil {
+		t.Fatalf("second Register: %v", err)
+	}
+	user, err := env.repos.Users.FindByEmail(ctx, "alice@example.com")
+	if err != nil {
+		t.Fatalf("FindByEmail: %v", err)
+	}
+	if !utils.ComparePasswords(user.Password, testPassword) {
+		t.Error("pending account kept the first registration's password")
+	}
+	second, err := env.repos.OTPs.Find(ctx, "alice@example.com", models.OTPPurposeEmailVerification)
+	if err != nil {
+		t.Fatalf("Find second code: %v", err)
+	}
+	if second.CodeHash == first.CodeHash {
+		t.Error("first registration's verification code is still outstanding")
+	}
+}
+
+// A verified account is left alone, whatever password the new registration carries
+func TestRegisterVerifiedAccountKeepsPassword(t *testing.T) {
+	env := newTestEnv(t)
+	service := NewRegistrationService(env.repos.Users, env.repos.OTPs, PasswordStrengthPolicy())
+	env.createUser(t, "alice@example.com")
+
+	if err := service.Register(context.Background(), models.RegisterRequest{Email: "alice@example.com", Password: "Attacker-Chosen-7"}); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	user, err := env.repos.Users.FindByEmail(context.Background(), "alice@example.com")
+	if err != nil {
+		t.Fatalf("FindByEmail: %v", err)
+	}
+	if !utils.ComparePasswords(user.Password, testPassword) {
+		t.Error("registration changed the password of a verified account")
+	}
+}
+
+// The code travels in the fragment, which browsers never send to a server
+func TestVerificationLinkKeepsCodeOutOfRequests(t *testing.T) {
+	t.Setenv("EMAIL_VERIFICATION_URL", "https://app.example.com/verify")
+	link, err := url.Parse(verificationLink("alice@example.com", "123456"))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if link.RawQuery != "" || link.Host != "app.example.com" || link.Path != "/verify" {
+		t.Errorf("link = %s, want the frontend page with only a fragment", link)
+	}
+	if fragment, _ := url.ParseQuery(link.Fragment); fragment.Get("code") != "123456" || fragment.Get("email") != "alice@example.com" {
+		t.Errorf("fragment = %q, want email and code", link.Fragment)
+	}
+}
@@ -0,0 +1,145 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"lem-be/models"
+	"lem-be/repository"
+	"lem-be/utils"
+
+	"go.opentelemetry.io/otel"
+)
+
+var ErrTokenAlreadyUsed = errors.New("token has already been used")
+
+// RevocationService is the server-side store of revoked tokens consulted by utils.ValidateToken
+type RevocationService interface {
+	RevokeToken(ctx context.Context, jti, userID string, expiresAt time.Time) error
+	BurnToken(ctx context.Context, jti, userID string, expiresAt time.Time) error
+	RevokeUserTokens(ctx context.Context, userID string) error
+	UserEpoch(ctx context.Context, userID string) (int64, error)
+	IsRevoked(ctx context.Context, claims *utils.JWTClaims) (bool, error)
+}
+
+type revocationService struct {
+	revocations repository.RevocationRepository
+}
+
+func NewRevocationService(revocations repository.RevocationRepository) RevocationService {
+	return &revocationService{revocations: revocations}
+}
+
+// InitRevocationStore registers the revocation store with utils.ValidateToken and the token generators.
+// With the Mongo repository, entries are removed by MongoDB's TTL monitor once the
+// tokens they cover would have expired (see database.Indexes).
+func InitRevocationStore(revocations repository.RevocationRepository) error {
+	store := NewRevocationService(revocations)
+	utils.SetTokenRevocationChecker(func(claims *utils.JWTClaims) (bool, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return store.IsRevoked(ctx, claims)
+	})
+	utils.SetTokenEpochSource(func(userID string) (int64, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return store.UserEpoch(ctx, userID)
+	})
+	return nil
+}
+
+// RevokeToken revokes a single token by its jti
+func (s *revocationService) RevokeToken(ctx context.Context, jti, userID string, expiresAt time.Time) error {
+	ctx, span := otel.Tracer("revocation-service").Start(ctx, "RevokeToken")
+	defer span.End()
+
+	log := utils.NewLogger("RevocationService", "RevokeToken").WithContext(ctx)
+	err := s.revocations.RevokeToken(ctx, models.RevokedToken{
+		JTI:       jti,
+		UserID:    userID,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		log.Errorf("Failed to revoke token %s for user %s: %v", jti, userID, err)
+		return err
+	}
+	log.Infof("Revoked token %s for user %s", jti, userID)
+	return nil
+}
+
+// BurnToken revokes a single-use token, failing with ErrTokenAlreadyUsed if it was already burned.
+// The repository's duplicate check makes this safe against concurrent use.
+func (s *revocationService) BurnToken(ctx context.Context, jti, userID string, expiresAt time.Time) error {
+	ctx, span := otel.Tracer("revocation-service").Start(ctx, "BurnToken")
+	defer span.End()
+
+	err := s.revocations.InsertToken(ctx, models.RevokedToken{
+		JTI:       jti,
+		UserID:    userID,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	})
+	if err == repository.ErrDuplicate {
+		utils.NewLogger("RevocationService", "BurnToken").WithContext(ctx).Warnf("Single-use token %s for user %s was already used", jti, userID)
+		return ErrTokenAlreadyUsed
+	}
+	return err
+}
+
+// RevokeUserTokens revokes every token issued to the user up to now by raising the user's epoch.
+// Tokens issued afterwards carry the new epoch, so no clock comparison is involved.
+func (s *revocationService) RevokeUserTokens(ctx context.Context, userID string) error {
+	ctx, span := otel.Tracer("revocation-service").Start(ctx, "RevokeUserTokens")
+	defer span.End()
+
+	log := utils.NewLogger("RevocationService", "RevokeUserTokens").WithContext(ctx)
+	now := time.Now()
+	err := s.revocations.SetUserRevocation(ctx, models.UserRevocation{
+		UserID:    userID,
+		Epoch:     now.UnixNano(),
+		ExpiresAt: now.Add(utils.RefreshTokenTTL),
+	})
+	if err != nil {
+		log.Errorf("Failed to revoke tokens for user %s: %v", userID, err)
+		return err
+	}
+	log.Infof("Revoked all tokens for user %s", userID)
+	return nil
+}
+
+// UserEpoch returns the epoch stamped into new tokens for the user, 0 if they were never revoked
+func (s *revocationService) UserEpoch(ctx context.Context, userID string) (int64, error) {
+	revocation, err := s.revocations.FindUserRevocation(ctx, userID)
+	if err == repository.ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return revocation.Epoch, nil
+}
+
+// IsRevoked reports whether the token was revoked individually or by a user-wide revocation
+func (s *revocationService) IsRevoked(ctx context.Context, claims *utils.JWTClaims) (bool, error) {
+	if claims.ID != "" {
+		revoked, err := s.revocations.IsTokenRevoked(ctx, claims.ID)
+		if err != nil {
+			return false, err
+		}
+		if revoked {
+			return true, nil
+		}
+	}
+
+	if claims.UserID == "" {
+		return false, nil
+	}
+
+	epoch, err := s.UserEpoch(ctx, claims.UserID)
+	if err != nil {
+		return false, err
+	}
+	return claims.Epoch < epoch, nil
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"lem-be/constants"
+	"lem-be/models"
+	"lem-be/repository"
+	"lem-be/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+const testPassword = "Correct-Horse-9"
+
+// testEnv wires the services against in-memory repositories, the way router.Setup does against MongoDB
+type testEnv struct {
+	repos          *repository.Repositories
+	revocations    RevocationService
+	tokens         TokenService
+	accountLimiter AttemptLimiter
+	otpIPLimiter   AttemptLimiter
+	login          LoginService
+}
+
+// newTestEnv resets the process-wide signing keys and revocation checker, so tests using it must not run in parallel
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	t.Setenv("JWT_PRIVATE_KEY_FILE", "")
+	t.Setenv("JWT_PREVIOUS_KEY_FILES", "")
+	t.Setenv("JWT_KEY_ENCRYPTION_KEY", "test-key-encryption-key")
+	t.Setenv("OTP_HMAC_SECRET", "test-otp-secret")
+	t.Setenv("SMTP_HOST", "")
+
+	repos := repository.NewMemoryRepositories()
+	if err := InitSigningKeys(repos.SigningKeys); err != nil {
+		t.Fatalf("InitSigningKeys: %v", err)
+	}
+	if err := InitRevocationStore(repos.Revocations); err != nil {
+		t.Fatalf("InitRevocationStore: %v", err)
+	}
+
+	revocations := NewRevocationService(repos.Revocations)
+	tokens := NewTokenService(repos.RefreshTokens, repos.Users, revocations)
+	accountLimiter := NewAttemptLimiter(repos.Attempts, "login-account", LoginAccountPolicy())
+	return &testEnv{
+		repos:          repos,
+		revocations:    revocations,
+		tokens:         tokens,
+		accountLimiter: accountLimiter,
+		otpIPLimiter:   NewAttemptLimiter(repos.Attempts, "otp-ip", OTPIPPolicy()),
+		login:          NewLoginService(repos.Users, tokens, accountLimiter, NewAttemptLimiter(repos.Attempts, "login-ip", LoginIPPolicy())),
+	}
+}
+
+// createUser stores a verified local user with testPassword
+func (e *testEnv) createUser(t *testing.T, email string) models.User {
+	t.Helper()
+	hash, err := utils.HashPassword(testPassword)
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	user := models.User{Email: email, Password: hash, Role: constants.RoleUser, Provider: "local", EmailVerified: true}
+	if err := e.repos.Users.Create(context.Background(), &user); err != nil {
+		t.Fatalf("Create user: %v", err)
+	}
+	return user
+}
+
+// loginUser signs the user in with testPassword and returns the token pair
+func (e *testEnv) loginUser(t *testing.T, email string) models.LoginResponse {
+	t.Helper()
+	tokens, err := e.login.Login(context.Background(), models.LoginRequest{Email: email, Password: testPassword}, "192.0.2.1")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if tokens.AccessToken == "" || tokens.RefreshToken == "" {
+		t.Fatalf("Login returned no token pair: %+v", tokens)
+	}
+	return tokens
+}
+
+// mustValidate returns the claims of a token that must still be accepted
+func mustValidate(t *testing.T, token string) *utils.JWTClaims {
+	t.Helper()
+	claims, err := utils.ValidateToken(token)
+	if err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+	return claims
+}
+
+// newGinContext is a request context for the services that take one
+func newGinContext(clientIP string) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+	c.Request.RemoteAddr = clientIP + ":1234"
+	return c
+}
+
+// guessConcurrently runs n guesses at once and returns their errors
+func guessConcurrently(n int, guess func(i int) error) []error {
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = guess(i)
+		}()
+	}
+	wg.Wait()
+	return errs
+}
+
+// countWrongGuesses counts the guesses that got as far as being checked, failing on unexpected errors
+func countWrongGuesses(t *testing.T, errs []error, wrong error) int {
+	t.Helper()
+	checked := 0
+	for _, err := range errs {
+		switch {
+		case errors.Is(err, wrong):
+			checked++
+		case !errors.Is(err, ErrTooManyAttempts):
+			t.Errorf("unexpected error %v", err)
+		}
+	}
+	return checked
+}
@@ -0,0 +1,225 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"lem-be/models"
+	"lem-be/repository"
+	"lem-be/utils"
+
+	"go.opentelemetry.io/otel"
+)
+
+var (
+	ErrKeyRotationPending = errors.New("a new signing key is already waiting to be activated")
+	ErrStaticSigningKey   = errors.New("the signing key is pinned by JWT_PRIVATE_KEY_FILE; rotate it by replacing the file")
+)
+
+// keySyncInterval is how often every instance reloads the shared key ring. It must stay well
+// below utils.KeyActivationDelay so that all instances know a new key before it signs.
+const keySyncInterval = time.Minute
+
+// SigningKeyService keeps the in-memory key ring of utils in step with the keys stored for every instance
+type SigningKeyService interface {
+	Sync(ctx context.Context) error
+	// Rotate adds a key that becomes the signing key after utils.KeyActivationDelay
+	Rotate(ctx context.Context) (utils.KeyInfo, error)
+	List() []utils.KeyInfo
+}
+
+type signingKeyService struct {
+	keys repository.SigningKeyRepository
+}
+
+func NewSigningKeyService(keys repository.SigningKeyRepository) SigningKeyService {
+	return &signingKeyService{keys: keys}
+}
+
+// InitSigningKeys loads the key ring. Unless JWT_PRIVATE_KEY_FILE pins the key, keys are stored
+// encrypted so they survive restarts and are shared by every instance; the first instance creates one.
+func InitSigningKeys(keys repository.SigningKeyRepository) error {
+	if err := utils.InitSigningKeys(); err != nil {
+		return err
+	}
+	if utils.StaticSigningKeys() {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	log := utils.NewLogger("SigningKeyService", "InitSigningKeys").WithContext(ctx)
+	records, err := keys.List(ctx)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		// The first key signs right away: no verifier can hold tokens from this issuer yet
+		key, err := createSigningKey(ctx, keys, "", time.Now())
+		if err == repository.ErrDuplicate {
+			log.Info("Another instance created the first signing key")
+		} else if err != nil {
+			return fmt.Errorf("failed to create signing key: %w", err)
+		} else {
+			log.Infof("Created first %s signing key %s", key.Algorithm, key.ID)
+		}
+	}
+	return NewSigningKeyService(keys).Sync(ctx)
+}
+
+// StartKeyRotation reloads the key ring every minute, adds a new key once the current one is older
+// than interval and deletes retired keys, until ctx is cancelled. A zero interval never rotates.
+func StartKeyRotation(ctx context.Context, keys repository.SigningKeyRepository, interval time.Duration) {
+	if utils.StaticSigningKeys() {
+		return
+	}
+	service := NewSigningKeyService(keys)
+	log := utils.NewLogger("SigningKeyService", "StartKeyRotation")
+
+	go func() {
+		ticker := time.NewTicker(keySyncInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := service.Sync(ctx); err != nil {
+					log.Errorf("Failed to reload signing keys: %v", err)
+					continue
+				}
+				if interval > 0 && rotationDue(service.List(), interval) {
+					if _, err := service.Rotate(ctx); err != nil && err != ErrKeyRotationPending {
+						log.Errorf("Scheduled key rotation failed: %v", err)
+					}
+				}
+			}
+		}
+	}()
+}
+
+// Sync replaces the key ring with the stored keys and deletes the ones that have retired
+func (s *signingKeyService) Sync(ctx context.Context) error {
+	ctx, span := otel.Tracer("signing-key-service").Start(ctx, "Sync")
+	defer span.End()
+
+	log := utils.NewLogger("SigningKeyService", "Sync").WithContext(ctx)
+	records, err := s.keys.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]*utils.SigningKey, 0, len(records))
+	for _, record := range records {
+		key, err := utils.DecryptSigningKey(record.Algorithm, record.PrivateKey)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt signing key %s: %w", record.ID, err)
+		}
+		key.ID = record.ID
+		key.CreatedAt = record.CreatedAt
+		key.ActivateAt = record.ActivateAt
+		keys = append(keys, key)
+	}
+
+	for _, kid := range utils.SetSigningKeys(keys) {
+		if err := s.keys.Delete(ctx, kid); err != nil {
+			log.Errorf("Failed to delete retired signing key %s: %v", kid, err)
+			continue
+		}
+		log.Infof("Deleted retired signing key %s", kid)
+	}
+	return nil
+}
+
+// Rotate publishes a new key now and lets it sign once verifiers have had time to fetch it
+func (s *signingKeyService) Rotate(ctx context.Context) (utils.KeyInfo, error) {
+	ctx, span := otel.Tracer("signing-key-service").Start(ctx, "Rotate")
+	defer span.End()
+
+	log := utils.NewLogger("SigningKeyService", "Rotate").WithContext(ctx)
+	if utils.StaticSigningKeys() {
+		return utils.KeyInfo{}, ErrStaticSigningKey
+	}
+	if err := s.Sync(ctx); err != nil {
+		return utils.KeyInfo{}, err
+	}
+
+	var current *utils.KeyInfo
+	now := time.Now()
+	for _, info := range s.List() {
+		if info.ActivateAt.After(now) {
+			return utils.KeyInfo{}, ErrKeyRotationPending
+		}
+		if info.Current {
+			current = &info
+		}
+	}
+	if current == nil {
+		return utils.KeyInfo{}, utils.ErrSigningKeyNotInitialized
+	}
+
+	record, err := createSigningKey(ctx, s.keys, current.ID, now.Add(utils.KeyActivationDelay))
+	if err == repository.ErrDuplicate {
+		return utils.KeyInfo{}, ErrKeyRotationPending
+	}
+	if err != nil {
+		return utils.KeyInfo{}, err
+	}
+	if err := s.Sync(ctx); err != nil {
+		return utils.KeyInfo{}, err
+	}
+
+	log.Infof("Signing key %s replaces %s at %s", record.ID, current.ID, record.ActivateAt.Format(time.RFC3339))
+	for _, info := range s.List() {
+		if info.ID == record.ID {
+			return info, nil
+		}
+	}
+	return utils.KeyInfo{}, fmt.Errorf("signing key %s missing after rotation", record.ID)
+}
+
+// List describes every key in the ring, newest first
+func (s *signingKeyService) List() []utils.KeyInfo {
+	return utils.ListSigningKeys()
+}
+
+// createSigningKey generates and stores a key that replaces successorOf at activateAt
+func createSigningKey(ctx context.Context, keys repository.SigningKeyRepository, successorOf string, activateAt time.Time) (models.SigningKeyRecord, error) {
+	alg := utils.SigningAlgorithm()
+	key, err := utils.GenerateSigningKey(alg)
+	if err != nil {
+		return models.SigningKeyRecord{}, err
+	}
+	encrypted, err := utils.EncryptSigningKey(key)
+	if err != nil {
+		return models.SigningKeyRecord{}, err
+	}
+
+	record := models.SigningKeyRecord{
+		ID:          key.ID,
+		Algorithm:   alg,
+		PrivateKey:  encrypted,
+		SuccessorOf: successorOf,
+		CreatedAt:   key.CreatedAt,
+		ActivateAt:  activateAt,
+	}
+	return record, keys.Create(ctx, record)
+}
+
+// rotationDue reports whether the current key has signed for interval and no successor is waiting
+func rotationDue(keys []utils.KeyInfo, interval time.Duration) bool {
+	now := time.Now()
+	due := false
+	for _, info := range keys {
+		if info.ActivateAt.After(now) {
+			return false
+		}
+		if info.Current {
+			due = now.Sub(info.ActivateAt) >= interval
+		}
+	}
+	return due
+}
@@ -0,0 +1,212 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"lem-be/models"
+	"lem-be/repository"
+	"lem-be/utils"
+
+	"go.opentelemetry.io/otel"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+	ErrSessionEnded        = errors.New("session has ended")
+)
+
+// TokenService issues access/refresh token pairs and rotates refresh tokens
+type TokenService interface {
+	// IssueTokens starts a session for a user who just authenticated with the amr methods
+	IssueTokens(ctx context.Context, user models.User, amr []string) (models.LoginResponse, error)
+	Refresh(ctx context.Context, refreshToken string) (models.LoginResponse, error)
+	// Reauthenticate moves the auth_time of the caller's session to now and returns an access token carrying it
+	Reauthenticate(ctx context.Context, claims *utils.JWTClaims, user models.User, amr []string) (models.LoginResponse, error)
+	Logout(ctx context.Context, claims *utils.JWTClaims) error
+	LogoutAll(ctx context.Context, userID string) error
+}
+
+type tokenService struct {
+	refreshTokens     repository.RefreshTokenRepository
+	users             repository.UserRepository
+	revocationService RevocationService
+}
+
+func NewTokenService(refreshTokens repository.RefreshTokenRepository, users repository.UserRepository, revocationService RevocationService) TokenService {
+	return &tokenService{refreshTokens: refreshTokens, users: users, revocationService: revocationService}
+}
+
+// IssueTokens starts a new session (refresh token family) for the user
+func (s *tokenService) IssueTokens(ctx context.Context, user models.User, amr []string) (models.LoginResponse, error) {
+	ctx, span := otel.Tracer("token-service").Start(ctx, "IssueTokens")
+	defer span.End()
+
+	familyID, err := utils.GenerateRandomID()
+	if err != nil {
+		return models.LoginResponse{}, ErrTokenGeneration
+	}
+
+	return s.issuePair(ctx, user, familyID, time.Now(), amr)
+}
+
+// Refresh exchanges a refresh token for a new pair. The presented token is marked as used;
+// presenting it again revokes every token of its family.
+func (s *tokenService) Refresh(ctx context.Context, refreshToken string) (models.LoginResponse, error) {
+	ctx, span := otel.Tracer("token-service").Start(ctx, "Refresh")
+	defer span.End()
+
+	log := utils.NewLogger("TokenService", "Refresh").WithContext(ctx)
+	claims, err := utils.ValidateToken(refreshToken)
+	if err != nil || claims.TokenType != utils.TokenTypeRefresh || claims.ID == "" {
+		log.Warn("Rejected invalid refresh token")
+		return models.LoginResponse{}, ErrInvalidRefreshToken
+	}
+
+	// Atomically mark the token as used so two concurrent refreshes cannot both succeed
+	now := time.Now()
+	record, err := s.refreshTokens.MarkUsed(ctx, claims.ID, now)
+	if err == repository.ErrNotFound {
+		// Either the token was never issued by us, or it has already been used/revoked
+		record, findErr := s.refreshTokens.FindByJTI(ctx, claims.ID)
+		if findErr != nil {
+			log.Warnf("Unknown refresh token jti %s for user %s", claims.ID, claims.UserID)
+			return models.LoginResponse{}, ErrInvalidRefreshToken
+		}
+
+		log.Warnf("Refresh token reuse detected for user %s, revoking family %s", record.UserID, record.FamilyID)
+		if err := s.refreshTokens.RevokeFamily(ctx, record.FamilyID, now); err != nil {
+			log.Errorf("Failed to revoke refresh token family %s: %v", record.FamilyID, err)
+			return models.LoginResponse{}, err
+		}
+		return models.LoginResponse{}, ErrRefreshTokenReused
+	}
+	if err != nil {
+		log.Errorf("Database error during refresh token lookup: %v", err)
+		return models.LoginResponse{}, err
+	}
+
+	// Reload the user so the new access token reflects the current email and role
+	user, err := s.users.FindByID(ctx, record.UserID)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			log.Warnf("User %s no longer exists", record.UserID)
+			return models.LoginResponse{}, ErrInvalidRefreshToken
+		}
+		return models.LoginResponse{}, err
+	}
+	if user.Disabled {
+		log.Warnf("Refresh refused for disabled user %s", record.UserID)
+		return models.LoginResponse{}, ErrInvalidRefreshToken
+	}
+
+	// The new pair keeps the session's auth_time: refreshing is not re-authenticating
+	return s.issuePair(ctx, user, record.FamilyID, record.AuthTime, record.AMR)
+}
+
+// Reauthenticate records a fresh authentication on the refresh tokens of the session, so tokens
+// refreshed later keep the new auth_time. The client keeps using its current refresh token.
+func (s *tokenService) Reauthenticate(ctx context.Context, claims *utils.JWTClaims, user models.User, amr []string) (models.LoginResponse, error) {
+	ctx, span := otel.Tracer("token-service").Start(ctx, "Reauthenticate")
+	defer span.End()
+
+	log := utils.NewLogger("TokenService", "Reauthenticate").WithContext(ctx)
+	if claims.SessionID == "" {
+		return models.LoginResponse{}, ErrSessionEnded
+	}
+
+	authTime := time.Now()
+	if err := s.refreshTokens.SetFamilyAuth(ctx, claims.SessionID, authTime, amr); err != nil {
+		if err == repository.ErrNotFound {
+			log.Warnf("Re-authentication for ended session %s of user %s", claims.SessionID, claims.UserID)
+			return models.LoginResponse{}, ErrSessionEnded
+		}
+		log.Errorf("Failed to record re-authentication for session %s: %v", claims.SessionID, err)
+		return models.LoginResponse{}, err
+	}
+
+	accessToken, err := utils.GenerateAccessToken(user.ID.Hex(), user.Email, user.Role, claims.SessionID, authTime, amr)
+	if err != nil {
+		log.Errorf("Failed to generate access token for user %s: %v", user.ID.Hex(), err)
+		return models.LoginResponse{}, ErrTokenGeneration
+	}
+	return models.LoginResponse{AccessToken: accessToken}, nil
+}
+
+// Logout ends the session of the presented access token: the token itself and its refresh token family are revoked
+func (s *tokenService) Logout(ctx context.Context, claims *utils.JWTClaims) error {
+	ctx, span := otel.Tracer("token-service").Start(ctx, "Logout")
+	defer span.End()
+
+	log := utils.NewLogger("TokenService", "Logout").WithContext(ctx)
+	if err := s.revocationService.RevokeToken(ctx, claims.ID, claims.UserID, claims.ExpiresAt.Time); err != nil {
+		return err
+	}
+
+	if claims.SessionID != "" {
+		if err := s.refreshTokens.RevokeFamily(ctx, claims.SessionID, time.Now()); err != nil {
+			log.Errorf("Failed to revoke refresh token family %s: %v", claims.SessionID, err)
+			return err
+		}
+	}
+
+	log.Infof("User %s logged out of session %s", claims.UserID, claims.SessionID)
+	return nil
+}
+
+// LogoutAll ends every session of the user
+func (s *tokenService) LogoutAll(ctx context.Context, userID string) error {
+	ctx, span := otel.Tracer("token-service").Start(ctx, "LogoutAll")
+	defer span.End()
+
+	log := utils.NewLogger("TokenService", "LogoutAll").WithContext(ctx)
+	if err := s.revocationService.RevokeUserTokens(ctx, userID); err != nil {
+		return err
+	}
+
+	if err := s.refreshTokens.RevokeUser(ctx, userID, time.Now()); err != nil {
+		log.Errorf("Failed to revoke refresh tokens for user %s: %v", userID, err)
+		return err
+	}
+
+	log.Infof("User %s logged out of all sessions", userID)
+	return nil
+}
+
+// issuePair generates an access/refresh pair in the given family and persists the refresh token
+func (s *tokenService) issuePair(ctx context.Context, user models.User, familyID string, authTime time.Time, amr []string) (models.LoginResponse, error) {
+	log := utils.NewLogger("TokenService", "issuePair").WithContext(ctx)
+
+	accessToken, err := utils.GenerateAccessToken(user.ID.Hex(), user.Email, user.Role, familyID, authTime, amr)
+	if err != nil {
+		log.Errorf("Failed to generate access token for user %s: %v", user.ID.Hex(), err)
+		return models.LoginResponse{}, ErrTokenGeneration
+	}
+
+	refreshToken, refreshClaims, err := utils.GenerateRefreshToken(user.ID.Hex(), familyID)
+	if err != nil {
+		log.Errorf("Failed to generate refresh token for user %s: %v", user.ID.Hex(), err)
+		return models.LoginResponse{}, ErrTokenGeneration
+	}
+
+	record := models.RefreshTokenRecord{
+		JTI:       refreshClaims.ID,
+		FamilyID:  familyID,
+		UserID:    user.ID.Hex(),
+		AuthTime:  authTime,
+		AMR:       amr,
+		ExpiresAt: refreshClaims.ExpiresAt.Time,
+		CreatedAt: time.Now(),
+	}
+	if err := s.refreshTokens.Create(ctx, record); err != nil {
+		log.Errorf("Failed to store refresh token for user %s: %v", user.ID.Hex(), err)
+		return models.LoginResponse{}, err
+	}
+
+	return models.LoginResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+	}, nil
+}
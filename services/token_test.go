@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"lem-be/models"
+	"lem-be/utils"
+)
+
+func TestRefreshRotatesTokens(t *testing.T) {
+	env := newTestEnv(t)
+	env.createUser(t, "alice@example.com")
+	first := env.loginUser(t, "alice@example.com")
+
+	second, err := env.tokens.Refresh(context.Background(), first.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Fatal("Refresh returned the same refresh token")
+	}
+
+	firstClaims, secondClaims := mustValidate(t, first.AccessToken), mustValidate(t, second.AccessToken)
+	if secondClaims.SessionID != firstClaims.SessionID {
+		t.Errorf("session changed on refresh: %s -> %s", firstClaims.SessionID, secondClaims.SessionID)
+	}
+	if !secondClaims.AuthTime.Time.Equal(firstClaims.AuthTime.Time) {
+		t.Errorf("auth_time changed on refresh: %v -> %v", firstClaims.AuthTime, secondClaims.AuthTime)
+	}
+
+	if _, err := env.tokens.Refresh(context.Background(), second.RefreshToken); err != nil {
+		t.Fatalf("Refresh with the rotated token: %v", err)
+	}
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	env := newTestEnv(t)
+	env.createUser(t, "alice@example.com")
+	first := env.loginUser(t, "alice@example.com")
+
+	second, err := env.tokens.Refresh(context.Background(), first.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	if _, err := env.tokens.Refresh(context.Background(), first.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("replaying a used refresh token: err = %v, want ErrRefreshTokenReused", err)
+	}
+	// The legitimate holder's token belongs to the revoked family too
+	if _, err := env.tokens.Refresh(context.Background(), second.RefreshToken); err == nil {
+		t.Fatal("refresh token of a revoked family was accepted")
+	}
+}
+
+func TestRefreshRejectsOtherTokenTypes(t *testing.T) {
+	env := newTestEnv(t)
+	env.createUser(t, "alice@example.com")
+	tokens := env.loginUser(t, "alice@example.com")
+
+	if _, err := env.tokens.Refresh(context.Background(), tokens.AccessToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("refresh with an access token: err = %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+func TestLogoutRevokesSession(t *testing.T) {
+	env := newTestEnv(t)
+	env.createUser(t, "alice@example.com")
+	tokens := env.loginUser(t, "alice@example.com")
+	other := env.loginUser(t, "alice@example.com")
+
+	if err := env.tokens.Logout(context.Background(), mustValidate(t, tokens.AccessToken)); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+
+	if _, err := utils.ValidateToken(tokens.AccessToken); !errors.Is(err, utils.ErrTokenRevoked) {
+		t.Errorf("access token after logout: err = %v, want ErrTokenRevoked", err)
+	}
+	if _, err := env.tokens.Refresh(context.Background(), tokens.RefreshToken); err == nil {
+		t.Error("refresh token of a logged out session was accepted")
+	}
+	// Other sessions are unaffected
+	mustValidate(t, other.AccessToken)
+	if _, err := env.tokens.Refresh(context.Background(), other.RefreshToken); err != nil {
+		t.Errorf("refresh of another session: %v", err)
+	}
+}
+
+func TestLogoutAllRevokesEverySession(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.createUser(t, "alice@example.com")
+	sessions := []models.LoginResponse{env.loginUser(t, "alice@example.com"), env.loginUser(t, "alice@example.com")}
+
+	if err := env.tokens.LogoutAll(context.Background(), user.ID.Hex()); err != nil {
+		t.Fatalf("LogoutAll: %v", err)
+	}
+	for i, tokens := range sessions {
+		if _, err := utils.ValidateToken(tokens.AccessToken); !errors.Is(err, utils.ErrTokenRevoked) {
+			t.Errorf("session %d access token: err = %v, want ErrTokenRevoked", i, err)
+		}
+		if _, err := env.tokens.Refresh(context.Background(), tokens.RefreshToken); err == nil {
+			t.Errorf("session %d refresh token was accepted", i)
+		}
+	}
+
+	// Signing in again right away works
+	fresh := env.loginUser(t, "alice@example.com")
+	mustValidate(t, fresh.AccessToken)
+}
+
+// Tokens issued just before a logout-all must not survive it,
+// and tokens issued right after it must not be caught by it
+func TestLogoutAllCoversTokensIssuedJustBefore(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.createUser(t, "alice@example.com")
+
+	for i := 0; i < 50; i++ {
+		before, err := env.tokens.IssueTokens(context.Background(), user, []string{utils.AMRPassword})
+		if err != nil {
+			t.Fatalf("IssueTokens: %v", err)
+		}
+		if err := env.tokens.LogoutAll(context.Background(), user.ID.Hex()); err != nil {
+			t.Fatalf("LogoutAll: %v", err)
+		}
+		after, err := env.tokens.IssueTokens(context.Background(), user, []string{utils.AMRPassword})
+		if err != nil {
+			t.Fatalf("IssueTokens: %v", err)
+		}
+
+		if _, err := utils.ValidateToken(before.AccessToken); !errors.Is(err, utils.ErrTokenRevoked) {
+			t.Fatalf("iteration %d: token issued before logout-all: err = %v, want ErrTokenRevoked", i, err)
+		}
+		if _, err := utils.ValidateToken(after.AccessToken); err != nil {
+			t.Fatalf("iteration %d: token issued after logout-all: %v", i, err)
+		}
+	}
+}
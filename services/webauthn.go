@@ -0,0 +1,518 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"lem-be/models"
+	"lem-be/repository"
+	"lem-be/utils"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"go.opentelemetry.io/otel"
+)
+
+var (
+	ErrWebAuthnDisabled           = errors.New("passkeys are not enabled")
+	ErrWebAuthnSessionInvalid     = errors.New("invalid or expired WebAuthn session")
+	ErrWebAuthnVerification       = errors.New("WebAuthn verification failed")
+	ErrWebAuthnNoCredentials      = errors.New("no passkeys are registered for this account")
+	ErrWebAuthnCredentialExists   = errors.New("credential is already registered")
+	ErrWebAuthnCredentialNotFound = errors.New("credential not found")
+	ErrWebAuthnCloneDetected      = errors.New("credential signature counter went backwards; the authenticator may have been cloned")
+)
+
+// webAuthnSessionTTL bounds how long a ceremony challenge can be answered
+const webAuthnSessionTTL = 5 * time.Minute
+
+// webAuthnDecoyPurpose keys the HMAC that derives decoy users from emails
+const webAuthnDecoyPurpose = "webauthn_decoy"
+
+// WebAuthnService registers passkeys and logs users in with them, either instead of a password
+// or as the second step of a two-factor login
+type WebAuthnService interface {
+	BeginRegistration(ctx context.Context, userID string) (models.WebAuthnOptionsResponse, error)
+	FinishRegistration(ctx context.Context, userID string, req models.FinishWebAuthnRequest) (models.WebAuthnCredential, error)
+	BeginLogin(ctx context.Context, req models.BeginWebAuthnLoginRequest) (models.WebAuthnOptionsResponse, error)
+	FinishLogin(ctx context.Context, req models.FinishWebAuthnRequest) (models.LoginResponse, error)
+	ListCredentials(ctx context.Context, userID string) ([]models.WebAuthnCredential, error)
+	DeleteCredential(ctx context.Context, userID string, credentialID []byte) error
+}
+
+type webAuthnService struct {
+	users             repository.UserRepository
+	sessions          repository.WebAuthnSessionRepository
+	tokenService      TokenService
+	revocationService RevocationService
+	relyingParty      *webauthn.WebAuthn
+}
+
+// NewWebAuthnService uses relyingParty for the ceremonies; a nil relyingParty disables passkeys
+func NewWebAuthnService(users repository.UserRepository, sessions repository.WebAuthnSessionRepository, tokenService TokenService, revocationService RevocationService, relyingParty *webauthn.WebAuthn) WebAuthnService {
+	return &webAuthnService{
+		users:             users,
+		sessions:          sessions,
+		tokenService:      tokenService,
+		revocationService: revocationService,
+		relyingParty:      relyingParty,
+	}
+}
+
+// webAuthnUser adapts models.User to webauthn.User. The user handle is the raw ObjectID.
+type webAuthnUser struct {
+	user models.User
+}
+
+func (u webAuthnUser) WebAuthnID() []byte {
+	return u.user.ID[:]
+}
+
+func (u webAuthnUser) WebAuthnName() string {
+	return u.user.Email
+}
+
+func (u webAuthnUser) WebAuthnDisplayName() string {
+	if u.user.Profile.DisplayName != "" {
+		return u.user.Profile.DisplayName
+	}
+	return u.user.Email
+}
+
+func (u webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, len(u.user.WebAuthn))
+	for i, credential := range u.user.WebAuthn {
+		credentials[i] = toLibraryCredential(credential)
+	}
+	return credentials
+}
+
+func toLibraryCredential(credential models.WebAuthnCredential) webauthn.Credential {
+	transports := make([]protocol.AuthenticatorTransport, len(credential.Transports))
+	for i, transport := range credential.Transports {
+		transports[i] = protocol.AuthenticatorTransport(transport)
+	}
+	return webauthn.Credential{
+		ID:              credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transport:       transports,
+		Flags:           webauthn.NewCredentialFlags(protocol.AuthenticatorFlags(credential.Flags)),
+		Authenticator: webauthn.Authenticator{
+			AAGUID:       credential.AAGUID,
+			SignCount:    credential.SignCount,
+			CloneWarning: credential.CloneWarning,
+		},
+	}
+}
+
+// credentialDescriptors lists the user's credentials for allow and exclude lists
+func credentialDescriptors(user models.User) []protocol.CredentialDescriptor {
+	descriptors := make([]protocol.CredentialDescriptor, 0, len(user.WebAuthn))
+	for _, credential := range (webAuthnUser{user}).WebAuthnCredentials() {
+		descriptors = append(descriptors, credential.Descriptor())
+	}
+	return descriptors
+}
+
+// BeginRegistration returns creation options for a new passkey on the signed-in account
+func (s *webAuthnService) BeginRegistration(ctx context.Context, userID string) (models.WebAuthnOptionsResponse, error) {
+	ctx, span := otel.Tracer("webauthn-service").Start(ctx, "BeginRegistration")
+	defer span.End()
+
+	log := utils.NewLogger("WebAuthnService", "BeginRegistration").WithContext(ctx)
+	if s.relyingParty == nil {
+		return models.WebAuthnOptionsResponse{}, ErrWebAuthnDisabled
+	}
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return models.WebAuthnOptionsResponse{}, err
+	}
+
+	// Resident keys make the passkey usable without typing an email; credProps reports whether we got one
+	creation, session, err := s.relyingParty.BeginRegistration(webAuthnUser{user},
+		webauthn.WithExclusions(credentialDescriptors(user)),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementPreferred),
+		webauthn.WithExtensions(webauthn.WithExtensionCredProps()),
+	)
+	if err != nil {
+		log.Errorf("Failed to begin passkey registration for %s: %v", user.Email, err)
+		return models.WebAuthnOptionsResponse{}, err
+	}
+
+	sessionID, err := s.saveSession(ctx, models.WebAuthnCeremonyRegistration, userID, false, session)
+	if err != nil {
+		log.Errorf("Failed to store registration session for %s: %v", user.Email, err)
+		return models.WebAuthnOptionsResponse{}, err
+	}
+	return models.WebAuthnOptionsResponse{SessionID: sessionID, Options: creation}, nil
+}
+
+// FinishRegistration verifies the attestation and stores the new credential
+func (s *webAuthnService) FinishRegistration(ctx context.Context, userID string, req models.FinishWebAuthnRequest) (models.WebAuthnCredential, error) {
+	ctx, span := otel.Tracer("webauthn-service").Start(ctx, "FinishRegistration")
+	defer span.End()
+
+	log := utils.NewLogger("WebAuthnService", "FinishRegistration").WithContext(ctx)
+	if s.relyingParty == nil {
+		return models.WebAuthnCredential{}, ErrWebAuthnDisabled
+	}
+	stored, session, err := s.takeSession(ctx, req.SessionID, models.WebAuthnCeremonyRegistration)
+	if err != nil {
+		return models.WebAuthnCredential{}, err
+	}
+	if stored.UserID != userID {
+		return models.WebAuthnCredential{}, ErrWebAuthnSessionInvalid
+	}
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return models.WebAuthnCredential{}, err
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(req.Credential)
+	if err != nil {
+		log.Warnf("Malformed registration response for %s: %v", user.Email, err)
+		return models.WebAuthnCredential{}, ErrWebAuthnVerification
+	}
+	created, err := s.relyingParty.CreateCredential(webAuthnUser{user}, session, parsed)
+	if err != nil {
+		log.Warnf("Passkey registration rejected for %s: %v", user.Email, err)
+		return models.WebAuthnCredential{}, ErrWebAuthnVerification
+	}
+
+	transports := make([]string, len(created.Transport))
+	for i, transport := range created.Transport {
+		transports[i] = string(transport)
+	}
+	credential := models.WebAuthnCredential{
+		ID:              created.ID,
+		Name:            req.Name,
+		PublicKey:       created.PublicKey,
+		AttestationType: created.AttestationType,
+		Transports:      transports,
+		AAGUID:          created.Authenticator.AAGUID,
+		SignCount:       created.Authenticator.SignCount,
+		Flags:           uint8(created.Flags.ProtocolValue()),
+		Discoverable:    created.Extensions.RK != nil && *created.Extensions.RK,
+		CreatedAt:       time.Now(),
+	}
+	if err := s.users.AddWebAuthnCredential(ctx, userID, credential); err != nil {
+		if err == repository.ErrDuplicate {
+			return models.WebAuthnCredential{}, ErrWebAuthnCredentialExists
+		}
+		log.Errorf("Failed to store passkey for %s: %v", user.Email, err)
+		return models.WebAuthnCredential{}, err
+	}
+
+	log.Infof("Passkey registered for %s", user.Email)
+	return credential, nil
+}
+
+// BeginLogin returns assertion options. An mfa_token targets the user who passed the password step,
+// an email targets that user's passkeys (or a decoy's), and neither starts a discoverable login.
+func (s *webAuthnService) BeginLogin(ctx context.Context, req models.BeginWebAuthnLoginRequest) (models.WebAuthnOptionsResponse, error) {
+	ctx, span := otel.Tracer("webauthn-service").Start(ctx, "BeginLogin")
+	defer span.End()
+
+	log := utils.NewLogger("WebAuthnService", "BeginLogin").WithContext(ctx)
+	req.Email = utils.NormalizeEmail(req.Email)
+	if s.relyingParty == nil {
+		return models.WebAuthnOptionsResponse{}, ErrWebAuthnDisabled
+	}
+
+	var (
+		assertion *protocol.CredentialAssertion
+		session   *webauthn.SessionData
+		userID    string
+		mfa       bool
+		err       error
+	)
+	switch {
+	case req.MFAToken != "":
+		user, err := s.mfaChallengeUser(ctx, req.MFAToken)
+		if err != nil {
+			return models.WebAuthnOptionsResponse{}, err
+		}
+		if len(user.WebAuthn) == 0 {
+			return models.WebAuthnOptionsResponse{}, ErrWebAuthnNoCredentials
+		}
+		userID, mfa = user.ID.Hex(), true
+		assertion, session, err = s.relyingParty.BeginLogin(webAuthnUser{user})
+		if err != nil {
+			log.Errorf("Failed to begin passkey verification for %s: %v", user.Email, err)
+			return models.WebAuthnOptionsResponse{}, err
+		}
+	case req.Email != "":
+		user, err := s.users.FindByEmail(ctx, req.Email)
+		if err != nil && err != repository.ErrNotFound {
+			return models.WebAuthnOptionsResponse{}, err
+		}
+		// Unknown emails and accounts without passkeys get options for a decoy, so the response
+		// does not reveal whether the email has an account
+		if err == repository.ErrNotFound || len(user.WebAuthn) == 0 {
+			if user, err = decoyWebAuthnUser(req.Email); err != nil {
+				return models.WebAuthnOptionsResponse{}, err
+			}
+		}
+		userID = user.ID.Hex()
+		// Passkeys replace the password here, so the authenticator must verify the user
+		assertion, session, err = s.relyingParty.BeginLogin(webAuthnUser{user},
+			webauthn.WithUserVerification(protocol.VerificationRequired))
+		if err != nil {
+			log.Errorf("Failed to begin passkey login for %s: %v", user.Email, err)
+			return models.WebAuthnOptionsResponse{}, err
+		}
+	default:
+		assertion, session, err = s.relyingParty.BeginDiscoverableLogin(
+			webauthn.WithUserVerification(protocol.VerificationRequired))
+		if err != nil {
+			log.Errorf("Failed to begin discoverable passkey login: %v", err)
+			return models.WebAuthnOptionsResponse{}, err
+		}
+	}
+
+	sessionID, err := s.saveSession(ctx, models.WebAuthnCeremonyLogin, userID, mfa, session)
+	if err != nil {
+		log.Errorf("Failed to store login session: %v", err)
+		return models.WebAuthnOptionsResponse{}, err
+	}
+	return models.WebAuthnOptionsResponse{SessionID: sessionID, Options: assertion}, nil
+}
+
+// FinishLogin verifies the assertion, records the new signature counter and issues tokens
+func (s *webAuthnService) FinishLogin(ctx context.Context, req models.FinishWebAuthnRequest) (models.LoginResponse, error) {
+	ctx, span := otel.Tracer("webauthn-service").Start(ctx, "FinishLogin")
+	defer span.End()
+
+	log := utils.NewLogger("WebAuthnService", "FinishLogin").WithContext(ctx)
+	if s.relyingParty == nil {
+		return models.LoginResponse{}, ErrWebAuthnDisabled
+	}
+	stored, session, err := s.takeSession(ctx, req.SessionID, models.WebAuthnCeremonyLogin)
+	if err != nil {
+		return models.LoginResponse{}, err
+	}
+
+	var challenge *utils.JWTClaims
+	if stored.MFA {
+		challenge, err = utils.ValidateMFAChallengeToken(req.MFAToken)
+		if err != nil || challenge.UserID != stored.UserID {
+			return models.LoginResponse{}, ErrInvalidMFAChallenge
+		}
+		// Burned before the assertion is checked, like a code challenge, so a reused challenge
+		// never reaches the passkey
+		if err := s.revocationService.BurnToken(ctx, challenge.ID, challenge.UserID, challenge.ExpiresAt.Time); err != nil {
+			if err == ErrTokenAlreadyUsed {
+				return models.LoginResponse{}, ErrInvalidMFAChallenge
+			}
+			return models.LoginResponse{}, err
+		}
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(req.Credential)
+	if err != nil {
+		log.Warnf("Malformed assertion response: %v", err)
+		return models.LoginResponse{}, ErrWebAuthnVerification
+	}
+
+	var (
+		user      models.User
+		validated *webauthn.Credential
+	)
+	if stored.UserID == "" {
+		// Discoverable login: the credential tells us who is signing in
+		var found webauthn.User
+		found, validated, err = s.relyingParty.ValidatePasskeyLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+			owner, err := s.users.FindByWebAuthnCredential(ctx, rawID)
+			if err != nil {
+				return nil, err
+			}
+			if !bytes.Equal(owner.ID[:], userHandle) {
+				return nil, ErrWebAuthnVerification
+			}
+			return webAuthnUser{owner}, nil
+		}, session, parsed)
+		if err == nil {
+			user = found.(webAuthnUser).user
+		}
+	} else {
+		user, err = s.getUser(ctx, stored.UserID)
+		if err == ErrUserNotFound {
+			// Also the answer for decoy sessions, which must fail like a wrong passkey
+			return models.LoginResponse{}, ErrWebAuthnVerification
+		}
+		if err != nil {
+			return models.LoginResponse{}, ErrWebAuthnSessionInvalid
+		}
+		validated, err = s.relyingParty.ValidateLogin(webAuthnUser{user}, session, parsed)
+	}
+	if err != nil {
+		log.Warnf("Passkey assertion rejected: %v", err)
+		return models.LoginResponse{}, ErrWebAuthnVerification
+	}
+
+	userID := user.ID.Hex()
+	index := -1
+	for i, credential := range user.WebAuthn {
+		if bytes.Equal(credential.ID, validated.ID) {
+			index = i
+		}
+	}
+	if index < 0 {
+		return models.LoginResponse{}, ErrWebAuthnVerification
+	}
+	credential := user.WebAuthn[index]
+	if credential.CloneWarning {
+		log.Warnf("Refusing passkey of %s previously flagged as cloned", user.Email)
+		return models.LoginResponse{}, ErrWebAuthnCloneDetected
+	}
+
+	now := time.Now()
+	credential.CloneWarning = validated.Authenticator.CloneWarning
+	credential.SignCount = validated.Authenticator.SignCount
+	credential.Flags = uint8(validated.Flags.ProtocolValue())
+	credential.LastUsedAt = &now
+	if stored.UserID == "" {
+		credential.Discoverable = true
+	}
+	if err := s.users.UpdateWebAuthnCredential(ctx, userID, credential); err != nil {
+		log.Errorf("Failed to update passkey of %s: %v", user.Email, err)
+		return models.LoginResponse{}, err
+	}
+	if credential.CloneWarning {
+		// The counter is kept at its old value; the credential stays refused until the user removes it
+		log.Warnf("Passkey signature counter regression for %s; possible cloned authenticator", user.Email)
+		return models.LoginResponse{}, ErrWebAuthnCloneDetected
+	}
+
+	if user.Disabled {
+		return models.LoginResponse{}, ErrAccountDisabled
+	}
+	amr := []string{utils.AMRHardwareKey}
+	if challenge != nil {
+		amr = withSecondFactor(challenge.AMR, utils.AMRHardwareKey)
+	}
+
+	log.Infof("Passkey login completed for %s", user.Email)
+	return s.tokenService.IssueTokens(ctx, user, amr)
+}
+
+// ListCredentials returns the passkeys registered to the user
+func (s *webAuthnService) ListCredentials(ctx context.Context, userID string) ([]models.WebAuthnCredential, error) {
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.WebAuthn == nil {
+		return []models.WebAuthnCredential{}, nil
+	}
+	return user.WebAuthn, nil
+}
+
+// DeleteCredential removes one of the user's passkeys
+func (s *webAuthnService) DeleteCredential(ctx context.Context, userID string, credentialID []byte) error {
+	ctx, span := otel.Tracer("webauthn-service").Start(ctx, "DeleteCredential")
+	defer span.End()
+
+	log := utils.NewLogger("WebAuthnService", "DeleteCredential").WithContext(ctx)
+	if err := s.users.RemoveWebAuthnCredential(ctx, userID, credentialID); err != nil {
+		if err == repository.ErrNotFound {
+			return ErrWebAuthnCredentialNotFound
+		}
+		log.Errorf("Failed to remove passkey of user %s: %v", userID, err)
+		return err
+	}
+	log.Infof("Passkey removed from user %s", userID)
+	return nil
+}
+
+// decoyWebAuthnUser stands in for an email without passkeys. Its ID and credential are derived
+// from the email with the server secret, so repeated requests for one email see the same options.
+func decoyWebAuthnUser(email string) (models.User, error) {
+	userHash, err := utils.HashOTP(email, webAuthnDecoyPurpose, "user")
+	if err != nil {
+		return models.User{}, err
+	}
+	credentialHash, err := utils.HashOTP(email, webAuthnDecoyPurpose, "credential")
+	if err != nil {
+		return models.User{}, err
+	}
+	userBytes, err := hex.DecodeString(userHash)
+	if err != nil {
+		return models.User{}, err
+	}
+	credentialID, err := hex.DecodeString(credentialHash)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	user := models.User{Email: email}
+	copy(user.ID[:], userBytes)
+	user.WebAuthn = []models.WebAuthnCredential{{ID: credentialID, Transports: []string{"hybrid", "internal"}}}
+	return user, nil
+}
+
+// mfaChallengeUser resolves the user an MFA challenge token was issued to
+func (s *webAuthnService) mfaChallengeUser(ctx context.Context, token string) (models.User, error) {
+	claims, err := utils.ValidateMFAChallengeToken(token)
+	if err != nil {
+		return models.User{}, ErrInvalidMFAChallenge
+	}
+	user, err := s.getUser(ctx, claims.UserID)
+	if err != nil || user.Email != claims.Email {
+		return models.User{}, ErrInvalidMFAChallenge
+	}
+	return user, nil
+}
+
+// saveSession stores the ceremony state server-side and returns the opaque ID the client echoes back
+func (s *webAuthnService) saveSession(ctx context.Context, ceremony, userID string, mfa bool, session *webauthn.SessionData) (string, error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return "", err
+	}
+	id, err := utils.GenerateRandomString(32)
+	if err != nil {
+		return "", err
+	}
+	err = s.sessions.Save(ctx, models.WebAuthnSession{
+		ID:        id,
+		Ceremony:  ceremony,
+		UserID:    userID,
+		MFA:       mfa,
+		Data:      data,
+		ExpiresAt: time.Now().Add(webAuthnSessionTTL),
+	})
+	return id, err
+}
+
+// takeSession consumes a stored ceremony so each challenge can be answered once
+func (s *webAuthnService) takeSession(ctx context.Context, id, ceremony string) (models.WebAuthnSession, webauthn.SessionData, error) {
+	stored, err := s.sessions.Take(ctx, id)
+	if err == repository.ErrNotFound {
+		return models.WebAuthnSession{}, webauthn.SessionData{}, ErrWebAuthnSessionInvalid
+	}
+	if err != nil {
+		return models.WebAuthnSession{}, webauthn.SessionData{}, err
+	}
+	if stored.Ceremony != ceremony {
+		return models.WebAuthnSession{}, webauthn.SessionData{}, ErrWebAuthnSessionInvalid
+	}
+	var session webauthn.SessionData
+	if err := json.Unmarshal(stored.Data, &session); err != nil {
+		return models.WebAuthnSession{}, webauthn.SessionData{}, err
+	}
+	return stored, session, nil
+}
+
+func (s *webAuthnService) getUser(ctx context.Context, userID string) (models.User, error) {
+	user, err := s.users.FindByID(ctx, userID)
+	if err == repository.ErrNotFound {
+		return models.User{}, ErrUserNotFound
+	}
+	return user, err
+}
@@ -0,0 +1,383 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"lem-be/models"
+	"lem-be/utils"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+)
+
+const (
+	testRPID   = "example.com"
+	testOrigin = "https://example.com"
+)
+
+// softAuthenticator is a platform authenticator in software: one ES256 passkey with a settable signature counter
+type softAuthenticator struct {
+	t            *testing.T
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	signCount    uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	credentialID := make([]byte, 16)
+	if _, err := rand.Read(credentialID); err != nil {
+		t.Fatalf("rand: %v", err)
+	}
+	return &softAuthenticator{t: t, key: key, credentialID: credentialID}
+}
+
+// authenticatorData flags: user present, user verified and, on registration, attested credential data
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttestedData = 0x40
+)
+
+func (a *softAuthenticator) authenticatorData(flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+	data := append(rpIDHash[:], flags)
+	return binary.BigEndian.AppendUint32(data, a.signCount)
+}
+
+func clientData(t *testing.T, ceremony string, challenge []byte) []byte {
+	t.Helper()
+	data, err := json.Marshal(map[string]any{
+		"type":      ceremony,
+		"challenge": base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":    testOrigin,
+	})
+	if err != nil {
+		t.Fatalf("Marshal client data: %v", err)
+	}
+	return data
+}
+
+// register answers creation options with a "none" attestation
+func (a *softAuthenticator) register(options any) json.RawMessage {
+	a.t.Helper()
+	creation, ok := options.(*protocol.CredentialCreation)
+	if !ok {
+		a.t.Fatalf("creation options have type %T", options)
+	}
+	a.userHandle = creation.Response.User.ID.(protocol.URLEncodedBase64)
+
+	publicKey, err := a.key.PublicKey.ECDH()
+	if err != nil {
+		a.t.Fatalf("ECDH: %v", err)
+	}
+	point := publicKey.Bytes() // 0x04 || X || Y
+	coseKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{KeyType: int64(webauthncose.EllipticKey), Algorithm: int64(webauthncose.AlgES256)},
+		Curve:         int64(webauthncose.P256),
+		XCoord:        point[1:33],
+		YCoord:        point[33:],
+	})
+	if err != nil {
+		a.t.Fatalf("Marshal COSE key: %v", err)
+	}
+
+	authData := a.authenticatorData(flagUserPresent | flagUserVerified | flagAttestedData)
+	authData = append(authData, make([]byte, 16)...) // AAGUID
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.credentialID)))
+	authData = append(authData, a.credentialID...)
+	authData = append(authData, coseKey...)
+
+	attestation, err := webauthncbor.Marshal(struct {
+		Format   string         `cbor:"fmt"`
+		AttStmt  map[string]any `cbor:"attStmt"`
+		AuthData []byte         `cbor:"authData"`
+	}{Format: "none", AttStmt: map[string]any{}, AuthData: authData})
+	if err != nil {
+		a.t.Fatalf("Marshal attestation: %v", err)
+	}
+
+	return a.response(map[string]any{
+		"attestationObject": base64.RawURLEncoding.EncodeToString(attestation),
+		"clientDataJSON":    base64.RawURLEncoding.EncodeToString(clientData(a.t, "webauthn.create", creation.Response.Challenge)),
+	}, map[string]any{"credProps": map[string]any{"rk": true}})
+}
+
+// assert signs assertion options with the passkey
+func (a *softAuthenticator) assert(options any) json.RawMessage {
+	a.t.Helper()
+	assertion, ok := options.(*protocol.CredentialAssertion)
+	if !ok {
+		a.t.Fatalf("assertion options have type %T", options)
+	}
+
+	authData := a.authenticatorData(flagUserPresent | flagUserVerified)
+	client := clientData(a.t, "webauthn.get", assertion.Response.Challenge)
+	clientHash := sha256.Sum256(client)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		a.t.Fatalf("SignASN1: %v", err)
+	}
+
+	return a.response(map[string]any{
+		"authenticatorData": base64.RawURLEncoding.EncodeToString(authData),
+		"clientDataJSON":    base64.RawURLEncoding.EncodeToString(client),
+		"signature":         base64.RawURLEncoding.EncodeToString(signature),
+		"userHandle":        base64.RawURLEncoding.EncodeToString(a.userHandle),
+	}, map[string]any{})
+}
+
+func (a *softAuthenticator) response(response, extensions map[string]any) json.RawMessage {
+	a.t.Helper()
+	id := base64.RawURLEncoding.EncodeToString(a.credentialID)
+	data, err := json.Marshal(map[string]any{
+		"id":                      id,
+		"rawId":                   id,
+		"type":                    "public-key",
+		"authenticatorAttachment": "platform",
+		"response":                response,
+		"clientExtensionResults":  extensions,
+	})
+	if err != nil {
+		a.t.Fatalf("Marshal credential: %v", err)
+	}
+	return data
+}
+
+func newTestWebAuthnService(t *testing.T, env *testEnv) WebAuthnService {
+	t.Helper()
+	t.Setenv("WEBAUTHN_RP_ID", testRPID)
+	t.Setenv("WEBAUTHN_RP_ORIGINS", testOrigin)
+	if err := utils.InitWebAuthn(); err != nil {
+		t.Fatalf("InitWebAuthn: %v", err)
+	}
+	return NewWebAuthnService(env.repos.Users, env.repos.WebAuthn, env.tokens, env.revocations, utils.WebAuthnRelyingParty())
+}
+
+// registerPasskey runs a registration ceremony for the user
+func registerPasskey(t *testing.T, service WebAuthnService, userID string, authenticator *softAuthenticator) models.WebAuthnCredential {
+	t.Helper()
+	options, err := service.BeginRegistration(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("BeginRegistration: %v", err)
+	}
+	credential, err := service.FinishRegistration(context.Background(), userID, models.FinishWebAuthnRequest{
+		SessionID:  options.SessionID,
+		Name:       "Laptop",
+		Credential: authenticator.register(options.Options),
+	})
+	if err != nil {
+		t.Fatalf("FinishRegistration: %v", err)
+	}
+	return credential
+}
+
+// loginWithPasskey runs a login ceremony; an empty email starts a discoverable login
+func loginWithPasskey(t *testing.T, service WebAuthnService, email string, authenticator *softAuthenticator) (models.LoginResponse, error) {
+	t.Helper()
+	options, err := service.BeginLogin(context.Background(), models.BeginWebAuthnLoginRequest{Email: email})
+	if err != nil {
+		t.Fatalf("BeginLogin: %v", err)
+	}
+	return service.FinishLogin(context.Background(), models.FinishWebAuthnRequest{
+		SessionID:  options.SessionID,
+		Credential: authenticator.assert(options.Options),
+	})
+}
+
+func TestWebAuthnRegisterAndLogin(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.createUser(t, "alice@example.com")
+	service := newTestWebAuthnService(t, env)
+	authenticator := newSoftAuthenticator(t)
+
+	credential := registerPasskey(t, service, user.ID.Hex(), authenticator)
+	if !credential.Discoverable || credential.Name != "Laptop" {
+		t.Errorf("registered credential = %+v, want a discoverable credential named Laptop", credential)
+	}
+
+	authenticator.signCount = 1
+	tokens, err := loginWithPasskey(t, service, "alice@example.com", authenticator)
+	if err != nil {
+		t.Fatalf("FinishLogin: %v", err)
+	}
+	claims := mustValidate(t, tokens.AccessToken)
+	if claims.UserID != user.ID.Hex() || len(claims.AMR) != 1 || claims.AMR[0] != utils.AMRHardwareKey {
+		t.Errorf("claims = user %s amr %v, want user %s amr [hwk]", claims.UserID, claims.AMR, user.ID.Hex())
+	}
+
+	credentials, err := service.ListCredentials(context.Background(), user.ID.Hex())
+	if err != nil {
+		t.Fatalf("ListCredentials: %v", err)
+	}
+	if len(credentials) != 1 || credentials[0].SignCount != 1 || credentials[0].LastUsedAt == nil {
+		t.Errorf("credential after login = %+v, want sign count 1 and a last use", credentials)
+	}
+}
+
+func TestWebAuthnRejectsRegisteringTheSameCredentialTwice(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice@example.com")
+	bob := env.createUser(t, "bob@example.com")
+	service := newTestWebAuthnService(t, env)
+	authenticator := newSoftAuthenticator(t)
+	registerPasskey(t, service, alice.ID.Hex(), authenticator)
+
+	options, err := service.BeginRegistration(context.Background(), bob.ID.Hex())
+	if err != nil {
+		t.Fatalf("BeginRegistration: %v", err)
+	}
+	_, err = service.FinishRegistration(context.Background(), bob.ID.Hex(), models.FinishWebAuthnRequest{
+		SessionID:  options.SessionID,
+		Credential: authenticator.register(options.Options),
+	})
+	if !errors.Is(err, ErrWebAuthnCredentialExists) {
+		t.Fatalf("credential registered to another user: err = %v, want ErrWebAuthnCredentialExists", err)
+	}
+}
+
+func TestWebAuthnSignCountRegressionIsCloneDetected(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.createUser(t, "alice@example.com")
+	service := newTestWebAuthnService(t, env)
+	authenticator := newSoftAuthenticator(t)
+	registerPasskey(t, service, user.ID.Hex(), authenticator)
+
+	authenticator.signCount = 5
+	if _, err := loginWithPasskey(t, service, "alice@example.com", authenticator); err != nil {
+		t.Fatalf("FinishLogin: %v", err)
+	}
+
+	// A copy of the key that has signed fewer times than the original
+	authenticator.signCount = 3
+	if _, err := loginWithPasskey(t, service, "alice@example.com", authenticator); !errors.Is(err, ErrWebAuthnCloneDetected) {
+		t.Fatalf("sign count went backwards: err = %v, want ErrWebAuthnCloneDetected", err)
+	}
+
+	// The credential stays refused even once the counter moves forward again
+	authenticator.signCount = 10
+	if _, err := loginWithPasskey(t, service, "alice@example.com", authenticator); !errors.Is(err, ErrWebAuthnCloneDetected) {
+		t.Fatalf("credential flagged as cloned: err = %v, want ErrWebAuthnCloneDetected", err)
+	}
+	credentials, err := service.ListCredentials(context.Background(), user.ID.Hex())
+	if err != nil {
+		t.Fatalf("ListCredentials: %v", err)
+	}
+	if !credentials[0].CloneWarning || credentials[0].SignCount != 5 {
+		t.Errorf("credential = clone warning %t sign count %d, want true and 5", credentials[0].CloneWarning, credentials[0].SignCount)
+	}
+}
+
+func TestWebAuthnDiscoverableLogin(t *testing.T) {
+	env := newTestEnv(t)
+	env.createUser(t, "bob@example.com")
+	user := env.createUser(t, "alice@example.com")
+	service := newTestWebAuthnService(t, env)
+	authenticator := newSoftAuthenticator(t)
+	registerPasskey(t, service, user.ID.Hex(), authenticator)
+
+	authenticator.signCount = 1
+	tokens, err := loginWithPasskey(t, service, "", authenticator)
+	if err != nil {
+		t.Fatalf("discoverable FinishLogin: %v", err)
+	}
+	if claims := mustValidate(t, tokens.AccessToken); claims.UserID != user.ID.Hex() {
+		t.Errorf("discoverable login signed in %s, want %s", claims.UserID, user.ID.Hex())
+	}
+
+	// A user handle that does not own the credential is refused
+	authenticator.signCount = 2
+	authenticator.userHandle = make([]byte, len(authenticator.userHandle))
+	if _, err := loginWithPasskey(t, service, "", authenticator); !errors.Is(err, ErrWebAuthnVerification) {
+		t.Fatalf("foreign user handle: err = %v, want ErrWebAuthnVerification", err)
+	}
+}
+
+func TestWebAuthnSessionIsSingleUse(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.createUser(t, "alice@example.com")
+	service := newTestWebAuthnService(t, env)
+	authenticator := newSoftAuthenticator(t)
+	registerPasskey(t, service, user.ID.Hex(), authenticator)
+
+	options, err := service.BeginLogin(context.Background(), models.BeginWebAuthnLoginRequest{Email: "alice@example.com"})
+	if err != nil {
+		t.Fatalf("BeginLogin: %v", err)
+	}
+	authenticator.signCount = 1
+	req := models.FinishWebAuthnRequest{SessionID: options.SessionID, Credential: authenticator.assert(options.Options)}
+	if _, err := service.FinishLogin(context.Background(), req); err != nil {
+		t.Fatalf("FinishLogin: %v", err)
+	}
+	if _, err := service.FinishLogin(context.Background(), req); !errors.Is(err, ErrWebAuthnSessionInvalid) {
+		t.Fatalf("replayed assertion: err = %v, want ErrWebAuthnSessionInvalid", err)
+	}
+}
+
+// allowedCredentials returns the credential IDs login options allow
+func allowedCredentials(t *testing.T, options any) [][]byte {
+	t.Helper()
+	assertion, ok := options.(*protocol.CredentialAssertion)
+	if !ok {
+		t.Fatalf("options are %T, want *protocol.CredentialAssertion", options)
+	}
+	ids := make([][]byte, len(assertion.Response.AllowedCredentials))
+	for i, credential := range assertion.Response.AllowedCredentials {
+		ids[i] = credential.CredentialID
+	}
+	return ids
+}
+
+// BeginLogin must answer the same way whether or not the email has an account with passkeys
+func TestWebAuthnBeginLoginDoesNotRevealAccounts(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.createUser(t, "alice@example.com")
+	env.createUser(t, "bob@example.com")
+	service := newTestWebAuthnService(t, env)
+	authenticator := newSoftAuthenticator(t)
+	registerPasskey(t, service, user.ID.Hex(), authenticator)
+
+	for _, email := range []string{"alice@example.com", "bob@example.com", "nobody@example.com"} {
+		options, err := service.BeginLogin(context.Background(), models.BeginWebAuthnLoginRequest{Email: email})
+		if err != nil {
+			t.Fatalf("BeginLogin(%s): %v", email, err)
+		}
+		if ids := allowedCredentials(t, options.Options); len(ids) != 1 {
+			t.Errorf("BeginLogin(%s) allows %d credentials, want 1", email, len(ids))
+		}
+	}
+
+	// A decoy looks the same on every request and cannot be completed
+	first, err := service.BeginLogin(context.Background(), models.BeginWebAuthnLoginRequest{Email: "nobody@example.com"})
+	if err != nil {
+		t.Fatalf("BeginLogin: %v", err)
+	}
+	second, err := service.BeginLogin(context.Background(), models.BeginWebAuthnLoginRequest{Email: "nobody@example.com"})
+	if err != nil {
+		t.Fatalf("BeginLogin: %v", err)
+	}
+	if !bytes.Equal(allowedCredentials(t, first.Options)[0], allowedCredentials(t, second.Options)[0]) {
+		t.Error("decoy credential changed between requests")
+	}
+	authenticator.signCount = 1
+	if _, err := loginWithPasskey(t, service, "nobody@example.com", authenticator); !errors.Is(err, ErrWebAuthnVerification) {
+		t.Fatalf("login to a decoy: err = %v, want ErrWebAuthnVerification", err)
+	}
+}
@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// GetEnvInt reads an integer environment variable, falling back when unset or invalid
+func GetEnvInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		NewLogger("ConfigUtils", "GetEnvInt").Warnf("Invalid integer for %s: %q, using %d", key, value, fallback)
+		return fallback
+	}
+	return n
+}
+
+// GetEnvDuration reads a Go duration (e.g. "15m") environment variable, falling back when unset or invalid
+func GetEnvDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		NewLogger("ConfigUtils", "GetEnvDuration").Warnf("Invalid duration for %s: %q, using %s", key, value, fallback)
+		return fallback
+	}
+	return d
+}
@@ -1,14 +1,50 @@
 package utils
 
 import (
+	"html"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"gopkg.in/gomail.v2"
 )
 
+// NormalizeEmail is the form every email address is stored, looked up and keyed by
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
 // SendOTPEmail sends a 6-digit OTP code to the specified email address
 func SendOTPEmail(to, code string) error {
+	return sendEmail(to, "Your Password Reset OTP", "<h2>Password Reset</h2><p>Your 6-digit OTP code is: <b>"+code+"</b></p><p>This code will expire in 5 minutes.</p>")
+}
+
+// SendVerificationEmail sends the email verification code and a link that confirms the address in one click
+func SendVerificationEmail(to, code, link string) error {
+	return sendEmail(to, "Verify your email address", "<h2>Welcome!</h2><p>Confirm your email address by clicking <a href=\""+html.EscapeString(link)+"\">this link</a> or entering the code <b>"+code+"</b>.</p><p>This code will expire in 24 hours.</p>")
+}
+
+// SendLoginEmail sends a passwordless sign-in code, a one-click sign-in link, or both; empty values are left out
+func SendLoginEmail(to, code, link string, ttl time.Duration) error {
+	body := "<h2>Sign in</h2>"
+	if link != "" {
+		body += "<p>Sign in by clicking <a href=\"" + html.EscapeString(link) + "\">this link</a>.</p>"
+	}
+	if code != "" {
+		body += "<p>Your sign-in code is: <b>" + code + "</b></p>"
+	}
+	body += "<p>This expires in " + strconv.Itoa(int(ttl.Minutes())) + " minutes. If you did not try to sign in, you can ignore this email.</p>"
+	return sendEmail(to, "Sign in to your account", body)
+}
+
+// SendEmailChangeEmail sends the code that confirms a new email address for an existing account
+func SendEmailChangeEmail(to, code string, ttl time.Duration) error {
+	return sendEmail(to, "Confirm your new email address", "<h2>Confirm your new email address</h2><p>Enter the code <b>"+code+"</b> to use this address for your account.</p><p>This code will expire in "+strconv.Itoa(int(ttl.Minutes()))+" minutes. If you did not ask for this, you can ignore this email.</p>")
+}
+
+// sendEmail sends an HTML email through the configured SMTP server
+func sendEmail(to, subject, body string) error {
 	host := os.Getenv("SMTP_HOST")
 	portStr := os.Getenv("SMTP_PORT")
 	user := os.Getenv("SMTP_USER")
@@ -16,7 +52,7 @@ func SendOTPEmail(to, code string) error {
 
 	// Fallback for development if not set
 	if host == "" {
-		NewLogger("EmailUtils", "SendOTPEmail").Warnf("SMTP_HOST not set. Email not sent to %s.", to)
+		NewLogger("EmailUtils", "sendEmail").Warnf("SMTP_HOST not set. Email %q not sent to %s.", subject, to)
 		return nil
 	}
 
@@ -28,15 +64,20 @@ func SendOTPEmail(to, code string) error {
 	m := gomail.NewMessage()
 	m.SetHeader("From", user)
 	m.SetHeader("To", to)
-	m.SetHeader("Subject", "Your Password Reset OTP")
-	m.SetBody("text/html", "<h2>Password Reset</h2><p>Your 6-digit OTP code is: <b>"+code+"</b></p><p>This code will expire in 5 minutes.</p>")
+	m.SetHeader("Subject", subject)
+	m.SetBody("text/html", body)
 
 	d := gomail.NewDialer(host, port, user, pass)
 
 	if err := d.DialAndSend(m); err != nil {
-		NewLogger("EmailUtils", "SendOTPEmail").Errorf("Failed to send email to %s: %v", to, err)
+		NewLogger("EmailUtils", "sendEmail").Errorf("Failed to send email to %s: %v", to, err)
 		return err
 	}
 
 	return nil
 }
+
+// SendPasswordChangedEmail notifies the user that their password was changed
+func SendPasswordChangedEmail(to string) error {
+	return sendEmail(to, "Your password was changed", "<h2>Password Changed</h2><p>The password for your account was just changed and all other sessions were signed out.</p><p>If you did not make this change, reset your password immediately and contact support.</p>")
+}
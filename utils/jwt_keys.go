@@ -0,0 +1,548 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey is an asymmetric key pair used to sign and verify JWTs.
+// Keys loaded for verification only have no PrivateKey.
+type SigningKey struct {
+	ID         string
+	Method     jwt.SigningMethod
+	PrivateKey crypto.Signer
+	PublicKey  crypto.PublicKey
+	CreatedAt  time.Time
+	ActivateAt time.Time  // When the key starts signing; it is published in the JWKS before that
+	RotatedAt  *time.Time // When the key stopped being the current signing key
+	RetireAt   *time.Time // When the last token signed by the key expires
+}
+
+// KeyInfo describes a key of the ring without exposing key material
+type KeyInfo struct {
+	ID         string     `json:"kid"`
+	Algorithm  string     `json:"alg"`
+	Current    bool       `json:"current"`
+	CanSign    bool       `json:"can_sign"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ActivateAt time.Time  `json:"activate_at"`
+	RotatedAt  *time.Time `json:"rotated_at,omitempty"`
+	RetireAt   *time.Time `json:"retire_at,omitempty"`
+}
+
+// JWK is the public part of a SigningKey in RFC 7517 format
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set as served on /.well-known/jwks.json
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKSCacheMaxAge is how long verifiers may cache the JWKS
+const JWKSCacheMaxAge = 5 * time.Minute
+
+// KeyActivationDelay is how long a new key is published in the JWKS before it signs, so
+// verifiers holding a cached key set have refreshed it by the time they see the new kid
+const KeyActivationDelay = 2 * JWKSCacheMaxAge
+
+// keyRing holds the signing keys: the current one, the next one waiting for activation and
+// every previous key whose tokens may still be in circulation
+type keyRing struct {
+	mu     sync.RWMutex
+	alg    string
+	static bool // The key comes from JWT_PRIVATE_KEY_FILE and is not rotated
+	keys   map[string]*SigningKey
+	// previous are the verification-only keys from JWT_PREVIOUS_KEY_FILES
+	previous []*SigningKey
+}
+
+var signingKeys = &keyRing{keys: map[string]*SigningKey{}}
+
+// maxSignedTokenTTL is the longest lifetime of any token we sign; a rotated key
+// is retired only once this has elapsed since it stopped signing
+const maxSignedTokenTTL = RefreshTokenTTL + time.Minute
+
+var ErrSigningKeyNotInitialized = errors.New("JWT signing key is not initialized")
+
+// InitSigningKeys reads JWT_SIGNING_ALG and the keys listed in JWT_PREVIOUS_KEY_FILES, which are kept
+// for verification only until RefreshTokenTTL after startup. If JWT_PRIVATE_KEY_FILE is set, that key
+// signs every token and is never rotated; otherwise the ring is filled with SetSigningKeys.
+func InitSigningKeys() error {
+	log := NewLogger("JWTKeys", "InitSigningKeys")
+	alg := getEnv("JWT_SIGNING_ALG", "RS256")
+
+	var previous []*SigningKey
+	if paths := os.Getenv("JWT_PREVIOUS_KEY_FILES"); paths != "" {
+		now := time.Now()
+		retireAt := now.Add(maxSignedTokenTTL)
+		for _, path := range strings.Split(paths, ",") {
+			path = strings.TrimSpace(path)
+			if path == "" {
+				continue
+			}
+			old, err := LoadVerificationKey(path)
+			if err != nil {
+				return fmt.Errorf("failed to load previous key from %s: %w", path, err)
+			}
+			old.PrivateKey = nil
+			old.RotatedAt = &now
+			old.RetireAt = &retireAt
+			previous = append(previous, old)
+			log.Infof("Loaded previous verification key %s from %s", old.ID, path)
+		}
+	}
+
+	signingKeys.mu.Lock()
+	defer signingKeys.mu.Unlock()
+	signingKeys.alg = alg
+	signingKeys.previous = previous
+	signingKeys.keys = map[string]*SigningKey{}
+	for _, old := range previous {
+		signingKeys.keys[old.ID] = old
+	}
+
+	keyFile := os.Getenv("JWT_PRIVATE_KEY_FILE")
+	signingKeys.static = keyFile != ""
+	if keyFile == "" {
+		return nil
+	}
+	key, err := LoadSigningKey(keyFile, alg)
+	if err != nil {
+		return fmt.Errorf("failed to load signing key from %s: %w", keyFile, err)
+	}
+	if kid := os.Getenv("JWT_KEY_ID"); kid != "" {
+		key.ID = kid
+	}
+	key.ActivateAt = key.CreatedAt
+	signingKeys.keys[key.ID] = key
+	log.Infof("Loaded %s signing key %s from %s", alg, key.ID, keyFile)
+	return nil
+}
+
+// StaticSigningKeys reports whether the signing key is pinned by JWT_PRIVATE_KEY_FILE
+func StaticSigningKeys() bool {
+	signingKeys.mu.RLock()
+	defer signingKeys.mu.RUnlock()
+	return signingKeys.static
+}
+
+// SigningAlgorithm is the JWS algorithm new keys are generated for (JWT_SIGNING_ALG)
+func SigningAlgorithm() string {
+	signingKeys.mu.RLock()
+	defer signingKeys.mu.RUnlock()
+	return signingKeys.alg
+}
+
+// SetSigningKeys replaces the rotated keys of the ring. Each key is current from its ActivateAt until
+// the next key activates, and retires once every token it signed has expired. The IDs of retired keys,
+// which are left out of the ring, are returned.
+func SetSigningKeys(keys []*SigningKey) []string {
+	sorted := slices.Clone(keys)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ActivateAt.Before(sorted[j].ActivateAt) })
+
+	now := time.Now()
+	ring := map[string]*SigningKey{}
+	var retired []string
+	for i, key := range sorted {
+		if i+1 < len(sorted) && !sorted[i+1].ActivateAt.After(now) {
+			rotatedAt := sorted[i+1].ActivateAt
+			retireAt := rotatedAt.Add(maxSignedTokenTTL)
+			key.RotatedAt = &rotatedAt
+			key.RetireAt = &retireAt
+			if now.After(retireAt) {
+				retired = append(retired, key.ID)
+				continue
+			}
+		}
+		ring[key.ID] = key
+	}
+
+	signingKeys.mu.Lock()
+	defer signingKeys.mu.Unlock()
+	for _, old := range signingKeys.previous {
+		ring[old.ID] = old
+	}
+	signingKeys.keys = ring
+	return retired
+}
+
+// ListSigningKeys describes every key currently in the ring, newest first
+func ListSigningKeys() []KeyInfo {
+	signingKeys.mu.RLock()
+	defer signingKeys.mu.RUnlock()
+
+	current := signingKeys.currentLocked(time.Now())
+	infos := make([]KeyInfo, 0, len(signingKeys.keys))
+	for _, key := range signingKeys.live(time.Now()) {
+		infos = append(infos, key.info(key == current))
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ActivateAt.After(infos[j].ActivateAt) })
+	return infos
+}
+
+// currentLocked returns the signing key activated most recently at now
+func (r *keyRing) currentLocked(now time.Time) *SigningKey {
+	var current *SigningKey
+	for _, key := range r.keys {
+		if key.PrivateKey == nil || key.ActivateAt.After(now) {
+			continue
+		}
+		if current == nil || key.ActivateAt.After(current.ActivateAt) {
+			current = key
+		}
+	}
+	return current
+}
+
+// live returns the keys that have not retired at now
+func (r *keyRing) live(now time.Time) []*SigningKey {
+	keys := make([]*SigningKey, 0, len(r.keys))
+	for _, key := range r.keys {
+		if key.RetireAt == nil || !now.After(*key.RetireAt) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (k *SigningKey) info(current bool) KeyInfo {
+	return KeyInfo{
+		ID:         k.ID,
+		Algorithm:  k.Method.Alg(),
+		Current:    current,
+		CanSign:    k.PrivateKey != nil,
+		CreatedAt:  k.CreatedAt,
+		ActivateAt: k.ActivateAt,
+		RotatedAt:  k.RotatedAt,
+		RetireAt:   k.RetireAt,
+	}
+}
+
+// jwtKeyCipher returns the AES-256-GCM cipher that protects stored signing keys
+func jwtKeyCipher() (cipher.AEAD, error) {
+	secret := os.Getenv("JWT_KEY_ENCRYPTION_KEY")
+	if secret == "" {
+		return nil, errors.New("JWT_KEY_ENCRYPTION_KEY environment variable is not set")
+	}
+	return secretCipher(secret)
+}
+
+// EncryptSigningKey encrypts the PKCS#8 encoded private key for storage
+func EncryptSigningKey(key *SigningKey) (string, error) {
+	aead, err := jwtKeyCipher()
+	if err != nil {
+		return "", err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key.PrivateKey)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawStdEncoding.EncodeToString(aead.Seal(nonce, nonce, der, nil)), nil
+}
+
+// DecryptSigningKey reverses EncryptSigningKey for a key used with alg
+func DecryptSigningKey(alg, encrypted string) (*SigningKey, error) {
+	aead, err := jwtKeyCipher()
+	if err != nil {
+		return nil, err
+	}
+	data, err := base64.RawStdEncoding.DecodeString(encrypted)
+	if err != nil || len(data) < aead.NonceSize() {
+		return nil, errors.New("malformed encrypted signing key")
+	}
+	der, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, err
+	}
+	private, err := parsePrivateKey(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err != nil {
+		return nil, err
+	}
+	return newSigningKey(alg, private)
+}
+
+// GenerateSigningKey creates a new key pair for the given algorithm (RS256, ES256 or EdDSA)
+func GenerateSigningKey(alg string) (*SigningKey, error) {
+	var private crypto.Signer
+	var err error
+	switch alg {
+	case "RS256":
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case "ES256":
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "EdDSA":
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newSigningKey(alg, private)
+}
+
+// LoadSigningKey reads a PEM encoded private key (PKCS#8, PKCS#1 or SEC 1) for the given algorithm
+func LoadSigningKey(path, alg string) (*SigningKey, error) {
+	block, err := readPEMBlock(path)
+	if err != nil {
+		return nil, err
+	}
+	private, err := parsePrivateKey(block)
+	if err != nil {
+		return nil, err
+	}
+	return newSigningKey(alg, private)
+}
+
+// LoadVerificationKey reads a PEM encoded private or public key, inferring its algorithm from the key type
+func LoadVerificationKey(path string) (*SigningKey, error) {
+	block, err := readPEMBlock(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if block.Type != "PUBLIC KEY" {
+		private, err := parsePrivateKey(block)
+		if err != nil {
+			return nil, err
+		}
+		alg, err := algorithmForKey(private.Public())
+		if err != nil {
+			return nil, err
+		}
+		return newSigningKey(alg, private)
+	}
+
+	public, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	alg, err := algorithmForKey(public)
+	if err != nil {
+		return nil, err
+	}
+	key := &SigningKey{Method: jwt.GetSigningMethod(alg), PublicKey: public, CreatedAt: time.Now()}
+	if key.ID, err = key.thumbprint(); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func readPEMBlock(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	return block, nil
+}
+
+func parsePrivateKey(block *pem.Block) (crypto.Signer, error) {
+	var parsed any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	private, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("key is not a signing key")
+	}
+	return private, nil
+}
+
+// algorithmForKey maps a public key type to the JWS algorithm we use it with
+func algorithmForKey(public crypto.PublicKey) (string, error) {
+	switch k := public.(type) {
+	case *rsa.PublicKey:
+		return "RS256", nil
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return "", fmt.Errorf("unsupported EC curve %s", k.Curve.Params().Name)
+		}
+		return "ES256", nil
+	case ed25519.PublicKey:
+		return "EdDSA", nil
+	default:
+		return "", fmt.Errorf("unsupported key type %T", public)
+	}
+}
+
+// newSigningKey checks that the key type matches the algorithm and derives its kid from the RFC 7638 thumbprint
+func newSigningKey(alg string, private crypto.Signer) (*SigningKey, error) {
+	var method jwt.SigningMethod
+	switch k := private.(type) {
+	case *rsa.PrivateKey:
+		if alg != "RS256" {
+			return nil, fmt.Errorf("RSA key cannot be used with %s", alg)
+		}
+		method = jwt.SigningMethodRS256
+	case *ecdsa.PrivateKey:
+		if alg != "ES256" || k.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("EC key on curve %s cannot be used with %s", k.Curve.Params().Name, alg)
+		}
+		method = jwt.SigningMethodES256
+	case ed25519.PrivateKey:
+		if alg != "EdDSA" {
+			return nil, fmt.Errorf("Ed25519 key cannot be used with %s", alg)
+		}
+		method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", private)
+	}
+
+	key := &SigningKey{Method: method, PrivateKey: private, PublicKey: private.Public(), CreatedAt: time.Now()}
+	thumbprint, err := key.thumbprint()
+	if err != nil {
+		return nil, err
+	}
+	key.ID = thumbprint
+	return key, nil
+}
+
+// JWK returns the public key in JWK format
+func (k *SigningKey) JWK() JWK {
+	jwk := JWK{Kid: k.ID, Use: "sig", Alg: k.Method.Alg()}
+	switch pub := k.PublicKey.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		// P-256 coordinates are always encoded as 32 bytes
+		ecdh, _ := pub.ECDH()
+		raw := ecdh.Bytes() // 0x04 || X || Y
+		jwk.Kty = "EC"
+		jwk.Crv = "P-256"
+		jwk.X = base64.RawURLEncoding.EncodeToString(raw[1:33])
+		jwk.Y = base64.RawURLEncoding.EncodeToString(raw[33:65])
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	}
+	return jwk
+}
+
+// thumbprint computes the RFC 7638 JWK thumbprint of the public key
+func (k *SigningKey) thumbprint() (string, error) {
+	jwk := k.JWK()
+	// Required members only, in lexicographic order
+	var members any
+	switch jwk.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{jwk.Crv, jwk.Kty, jwk.X, jwk.Y}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	default:
+		return "", errors.New("unsupported key type")
+	}
+
+	canonical, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(canonical)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// GetJWKS returns the public keys that verify tokens issued by this server, including the next
+// key before it starts signing
+func GetJWKS() JWKS {
+	signingKeys.mu.RLock()
+	defer signingKeys.mu.RUnlock()
+
+	jwks := JWKS{Keys: []JWK{}}
+	for _, key := range signingKeys.live(time.Now()) {
+		jwks.Keys = append(jwks.Keys, key.JWK())
+	}
+	sort.Slice(jwks.Keys, func(i, j int) bool { return jwks.Keys[i].Kid < jwks.Keys[j].Kid })
+	return jwks
+}
+
+// getSigningKey returns the key new tokens are signed with
+func getSigningKey() (*SigningKey, error) {
+	signingKeys.mu.RLock()
+	defer signingKeys.mu.RUnlock()
+
+	current := signingKeys.currentLocked(time.Now())
+	if current == nil {
+		return nil, ErrSigningKeyNotInitialized
+	}
+	return current, nil
+}
+
+// getVerificationKey returns the key identified by a token's kid header
+func getVerificationKey(kid string) (*SigningKey, error) {
+	signingKeys.mu.RLock()
+	defer signingKeys.mu.RUnlock()
+
+	key, ok := signingKeys.keys[kid]
+	if !ok || (key.RetireAt != nil && time.Now().After(*key.RetireAt)) {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
@@ -2,7 +2,8 @@ package utils
 
 import (
 	"errors"
-	"os"
+	"fmt"
+	"strings"
 	"time"
 
 	constants "lem-be/constants"
@@ -10,85 +11,308 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// Token types carried in the token_type claim
+const (
+	TokenTypeAccess        = "access"
+	TokenTypeRefresh       = "refresh"
+	TokenTypePasswordReset = "password_reset"
+	TokenTypeMFAChallenge  = "mfa_challenge"
+)
+
+// PasswordResetAudience is the aud claim of password reset tokens; no other token carries it
+const PasswordResetAudience = "password-reset"
+
+// MFAChallengeAudience is the aud claim of MFA challenge tokens; no other token carries it
+const MFAChallengeAudience = "mfa-challenge"
+
+// Authentication methods carried in the amr claim. The values follow RFC 8176;
+// "email" and "fed" have no registered equivalent.
+const (
+	AMRPassword    = "pwd"   // Password
+	AMROTP         = "otp"   // TOTP or recovery code
+	AMRHardwareKey = "hwk"   // WebAuthn passkey or security key
+	AMREmail       = "email" // Passwordless email code or link
+	AMRFederated   = "fed"   // External OAuth/OIDC provider
+	AMRMultiFactor = "mfa"   // More than one of the above
+)
+
+// Token lifetimes
+const (
+	AccessTokenTTL        = 15 * time.Minute
+	RefreshTokenTTL       = 7 * 24 * time.Hour
+	PasswordResetTokenTTL = 10 * time.Minute
+	MFAChallengeTokenTTL  = 5 * time.Minute
+)
+
+// ErrTokenRevoked is returned by ValidateToken for tokens found in the revocation store
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+// TokenRevocationChecker reports whether a token has been revoked server-side
+type TokenRevocationChecker func(claims *JWTClaims) (bool, error)
+
+var tokenRevocationChecker TokenRevocationChecker
+
+// SetTokenRevocationChecker registers the revocation store consulted by ValidateToken
+func SetTokenRevocationChecker(checker TokenRevocationChecker) {
+	tokenRevocationChecker = checker
+}
+
+// TokenEpochSource returns the user's current revocation epoch, stamped into every token issued to them
+type TokenEpochSource func(userID string) (int64, error)
+
+var tokenEpochSource TokenEpochSource
+
+// SetTokenEpochSource registers where token generators read the user's revocation epoch from
+func SetTokenEpochSource(source TokenEpochSource) {
+	tokenEpochSource = source
+}
+
+// tokenEpoch is 0 until the user's tokens are first revoked
+func tokenEpoch(userID string) (int64, error) {
+	if tokenEpochSource == nil {
+		return 0, nil
+	}
+	return tokenEpochSource(userID)
+}
+
 // JWTClaims defines the structure of JWT claims
 type JWTClaims struct {
-	UserID string `json:"user_id"`
-	Email  string `json:"email"`
-	Role   constants.Role `json:"role"`
+	UserID    string         `json:"user_id"`
+	Email     string         `json:"email"`
+	Role      constants.Role `json:"role"`
+	TokenType string         `json:"token_type,omitempty"`
+	SessionID string         `json:"sid,omitempty"` // Refresh token family shared by every token of a login session
+	// AuthTime is when the user last proved who they are in this session; it survives token refreshes
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
+	AMR      []string         `json:"amr,omitempty"` // How the user authenticated at AuthTime
+	// Epoch is the user's revocation epoch at issue time; a logout-all raises it past every earlier token
+	Epoch int64 `json:"rev,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// GetJWTSecret retrieves the JWT secret from environment variables
-func GetJWTSecret() (string, error) {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		NewLogger("JWTUtils", "GetJWTSecret").Errorf("JWT_SECRET environment variable is not set")
-		return "", errors.New("JWT_SECRET environment variable is not set")
+// signToken signs the claims with the current signing key and sets the kid header
+func signToken(claims jwt.Claims) (string, error) {
+	key, err := getSigningKey()
+	if err != nil {
+		return "", err
 	}
-	return secret, nil
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.PrivateKey)
 }
 
-// GenerateAccessToken generates a short-lived access token (15 minutes)
-func GenerateAccessToken(userID, email string, role constants.Role) (string, error) {
-	secret, err := GetJWTSecret()
+// GenerateAccessToken generates a short-lived access token (15 minutes).
+// A zero authTime (sessions started before auth_time was recorded) leaves the claim out.
+func GenerateAccessToken(userID, email string, role constants.Role, sessionID string, authTime time.Time, amr []string) (string, error) {
+	epoch, err := tokenEpoch(userID)
+	if err != nil {
+		return "", err
+	}
+
+	jti, err := GenerateRandomID()
 	if err != nil {
 		return "", err
 	}
 
 	claims := JWTClaims{
-		UserID: userID,
-		Email:  email,
-		Role:   role,
+		UserID:    userID,
+		Email:     email,
+		Role:      role,
+		TokenType: TokenTypeAccess,
+		SessionID: sessionID,
+		AMR:       amr,
+		Epoch:     epoch,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(15 * time.Minute)),
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
+	if !authTime.IsZero() {
+		claims.AuthTime = jwt.NewNumericDate(authTime)
+	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+	return signToken(claims)
 }
 
-// GenerateRefreshToken generates a long-lived refresh token (7 days)
-func GenerateRefreshToken(userID string) (string, error) {
-	secret, err := GetJWTSecret()
+// GenerateRefreshToken generates a long-lived refresh token (7 days) belonging to the given session.
+// The returned claims carry the token's jti and expiry so the caller can persist it.
+func GenerateRefreshToken(userID, sessionID string) (string, *JWTClaims, error) {
+	epoch, err := tokenEpoch(userID)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
-	claims := JWTClaims{
-		UserID: userID,
+	jti, err := GenerateRandomID()
+	if err != nil {
+		return "", nil, err
+	}
+
+	claims := &JWTClaims{
+		UserID:    userID,
+		TokenType: TokenTypeRefresh,
+		SessionID: sessionID,
+		Epoch:     epoch,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(7 * 24 * time.Hour)),
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(RefreshTokenTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+	signed, err := signToken(claims)
+	if err != nil {
+		return "", nil, err
+	}
+	return signed, claims, nil
 }
 
-// ValidateToken parses and validates a JWT token
-func ValidateToken(tokenString string) (*JWTClaims, error) {
-	secret, err := GetJWTSecret()
+// GenerateResetToken generates a single-purpose token that only authorizes setting a new password.
+// Its jti must be burned when it is used.
+func GenerateResetToken(userID, email string) (string, *JWTClaims, error) {
+	epoch, err := tokenEpoch(userID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	jti, err := GenerateRandomID()
+	if err != nil {
+		return "", nil, err
+	}
+
+	claims := &JWTClaims{
+		UserID:    userID,
+		Email:     email,
+		TokenType: TokenTypePasswordReset,
+		Epoch:     epoch,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Audience:  jwt.ClaimStrings{PasswordResetAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(PasswordResetTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	signed, err := signToken(claims)
+	if err != nil {
+		return "", nil, err
+	}
+	return signed, claims, nil
+}
+
+// ValidateResetToken validates a password reset token, rejecting every other kind of token
+func ValidateResetToken(tokenString string) (*JWTClaims, error) {
+	claims, err := parseToken(tokenString, jwt.WithAudience(PasswordResetAudience))
 	if err != nil {
-		NewLogger("JWTUtils", "ValidateToken").Errorf("Failed to get JWT secret: %v", err)
 		return nil, err
 	}
+	if claims.TokenType != TokenTypePasswordReset || claims.ID == "" {
+		return nil, errors.New("not a password reset token")
+	}
+	return claims, nil
+}
+
+// GenerateMFAChallengeToken generates the token returned by the first step of a login when the
+// user has a second factor; amr records how that step was passed. It only authorizes completing
+// that login. Its jti must be burned when it is used.
+func GenerateMFAChallengeToken(userID, email string, amr []string) (string, *JWTClaims, error) {
+	epoch, err := tokenEpoch(userID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	jti, err := GenerateRandomID()
+	if err != nil {
+		return "", nil, err
+	}
 
+	claims := &JWTClaims{
+		UserID:    userID,
+		Email:     email,
+		TokenType: TokenTypeMFAChallenge,
+		AMR:       amr,
+		Epoch:     epoch,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Audience:  jwt.ClaimStrings{MFAChallengeAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(MFAChallengeTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	signed, err := signToken(claims)
+	if err != nil {
+		return "", nil, err
+	}
+	return signed, claims, nil
+}
+
+// ValidateMFAChallengeToken validates an MFA challenge token, rejecting every other kind of token
+func ValidateMFAChallengeToken(tokenString string) (*JWTClaims, error) {
+	claims, err := parseToken(tokenString, jwt.WithAudience(MFAChallengeAudience))
+	if err != nil {
+		return nil, err
+	}
+	if claims.TokenType != TokenTypeMFAChallenge || claims.ID == "" {
+		return nil, errors.New("not an MFA challenge token")
+	}
+	return claims, nil
+}
+
+// ValidateToken parses and validates a JWT token
+func ValidateToken(tokenString string) (*JWTClaims, error) {
+	return parseToken(tokenString)
+}
+
+// parseToken verifies the signature, expiry and revocation status of a token
+func parseToken(tokenString string, opts ...jwt.ParserOption) (*JWTClaims, error) {
+	opts = append(opts, jwt.WithValidMethods([]string{"RS256", "ES256", "EdDSA"}))
 	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(secret), nil
-	})
+		kid, _ := token.Header["kid"].(string)
+		key, err := getVerificationKey(kid)
+		if err != nil {
+			return nil, err
+		}
+		// The algorithm is pinned by the key, never taken from the token alone
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %s for key %s", token.Method.Alg(), kid)
+		}
+		return key.PublicKey, nil
+	}, opts...)
 
 	if err != nil {
 		NewLogger("JWTUtils", "ValidateToken").Warnf("Token parsing failed: %v", err)
 		return nil, err
 	}
 
-	if claims, ok := token.Claims.(*JWTClaims); ok && token.Valid {
-		return claims, nil
+	claims, ok := token.Claims.(*JWTClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	if tokenRevocationChecker != nil {
+		revoked, err := tokenRevocationChecker(claims)
+		if err != nil {
+			// Fail closed: a token we cannot check is not accepted
+			NewLogger("JWTUtils", "ValidateToken").Errorf("Failed to check token revocation: %v", err)
+			return nil, err
+		}
+		if revoked {
+			NewLogger("JWTUtils", "ValidateToken").Warnf("Rejected revoked token %s for user %s", claims.ID, claims.UserID)
+			return nil, ErrTokenRevoked
+		}
 	}
 
-	return nil, errors.New("invalid token")
+	return claims, nil
 }
 
+// ExtractBearerToken returns the token from an "Authorization: Bearer <token>" header value
+func ExtractBearerToken(header string) (string, bool) {
+	scheme, token, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
@@ -1,24 +1,280 @@
 package utils
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
 	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
 
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 )
 
-var GoogleOAuthConfig *oauth2.Config
-
-// InitOAuthConfig initializes the OAuth2 configurations for supported providers
-func InitOAuthConfig() {
-	GoogleOAuthConfig = &oauth2.Config{
-		ClientID:     os.Getenv("GOOGLE_CLIENT_ID"),
-		ClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
-		RedirectURL:  os.Getenv("GOOGLE_REDIRECT_URL"),
-		Scopes: []string{
-			"https://www.googleapis.com/auth/userinfo.email",
-			"https://www.googleapis.com/auth/userinfo.profile",
+var ErrUnknownOAuthProvider = errors.New("unknown OAuth provider")
+
+// providerNamePattern restricts provider names to values that are safe as a route segment
+var providerNamePattern = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+// oauthProviders holds the providers enabled by configuration, keyed by route name
+var oauthProviders = map[string]*OAuthProvider{}
+
+// OAuthIdentity is the provider account information, normalized across providers
+type OAuthIdentity struct {
+	Provider      string
+	Subject       string // Stable account ID at the provider, stored as User.ProviderID
+	Email         string
+	EmailVerified bool
+	Name          string
+	AvatarURL     string
+}
+
+// OAuthProvider is one configured login provider. OIDC providers verify the ID token
+// returned with the access token; plain OAuth2 providers call an identity API instead.
+type OAuthProvider struct {
+	Name       string
+	Config     *oauth2.Config
+	Verifier   *OIDCVerifier // nil for plain OAuth2 providers
+	HTTPClient *http.Client
+
+	mapClaims     func(claims *IDTokenClaims) *OAuthIdentity
+	fetchIdentity func(ctx context.Context, client *http.Client, token *oauth2.Token) (*OAuthIdentity, error)
+}
+
+// AuthCodeURL builds the provider login URL carrying the state, PKCE challenge and nonce
+func (p *OAuthProvider) AuthCodeURL(state *OAuthState) string {
+	opts := []oauth2.AuthCodeOption{oauth2.S256ChallengeOption(state.CodeVerifier)}
+	if p.Verifier != nil {
+		opts = append(opts, oauth2.SetAuthURLParam("nonce", state.Nonce))
+	}
+	return p.Config.AuthCodeURL(state.State, opts...)
+}
+
+// Exchange redeems an authorization code together with its PKCE verifier
+func (p *OAuthProvider) Exchange(ctx context.Context, code, codeVerifier string) (*oauth2.Token, error) {
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, p.HTTPClient)
+	return p.Config.Exchange(ctx, code, oauth2.VerifierOption(codeVerifier))
+}
+
+// Identity resolves the account behind a token, verifying the ID token against nonce for OIDC providers
+func (p *OAuthProvider) Identity(ctx context.Context, token *oauth2.Token, nonce string) (*OAuthIdentity, error) {
+	var identity *OAuthIdentity
+	if p.Verifier != nil {
+		rawIDToken, ok := token.Extra("id_token").(string)
+		if !ok || rawIDToken == "" {
+			return nil, fmt.Errorf("%w: token response did not include an id_token", ErrInvalidIDToken)
+		}
+		claims, err := p.Verifier.Verify(ctx, rawIDToken, nonce)
+		if err != nil {
+			return nil, err
+		}
+		identity = p.mapClaims(claims)
+	} else {
+		var err error
+		identity, err = p.fetchIdentity(ctx, p.HTTPClient, token)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if identity.Subject == "" {
+		return nil, fmt.Errorf("%s did not return an account ID", p.Name)
+	}
+	identity.Provider = p.Name
+	return identity, nil
+}
+
+// GetOAuthProvider returns the enabled provider registered under name
+func GetOAuthProvider(name string) (*OAuthProvider, error) {
+	provider, ok := oauthProviders[name]
+	if !ok {
+		return nil, ErrUnknownOAuthProvider
+	}
+	return provider, nil
+}
+
+// OAuthProviders lists the enabled providers sorted by name
+func OAuthProviders() []*OAuthProvider {
+	providers := make([]*OAuthProvider, 0, len(oauthProviders))
+	for _, provider := range oauthProviders {
+		providers = append(providers, provider)
+	}
+	sort.Slice(providers, func(i, j int) bool { return providers[i].Name < providers[j].Name })
+	return providers
+}
+
+// InitOAuthConfig registers every provider whose <PREFIX>_CLIENT_ID is set.
+// Built-in providers are google, github, microsoft and gitlab; a generic provider
+// configured through OIDC discovery is registered as OIDC_PROVIDER_NAME (default "oidc").
+func InitOAuthConfig() error {
+	log := NewLogger("OAuthConfig", "InitOAuthConfig")
+	oauthProviders = map[string]*OAuthProvider{}
+
+	builders := []struct {
+		prefix string
+		build  func(config *oauth2.Config) (*OAuthProvider, error)
+	}{
+		{"GOOGLE", newGoogleProvider},
+		{"GITHUB", newGitHubProvider},
+		{"MICROSOFT", newMicrosoftProvider},
+		{"GITLAB", newGitLabProvider},
+		{"OIDC", newDiscoveredProvider},
+	}
+	for _, builder := range builders {
+		clientID := os.Getenv(builder.prefix + "_CLIENT_ID")
+		if clientID == "" {
+			continue
+		}
+		config := &oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: os.Getenv(builder.prefix + "_CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(builder.prefix + "_REDIRECT_URL"),
+		}
+		provider, err := builder.build(config)
+		if err != nil {
+			return fmt.Errorf("configure %s OAuth provider: %w", strings.ToLower(builder.prefix), err)
+		}
+		if _, exists := oauthProviders[provider.Name]; exists {
+			return fmt.Errorf("OAuth provider %q is configured twice", provider.Name)
+		}
+		if provider.HTTPClient == nil {
+			provider.HTTPClient = newOAuthHTTPClient()
+		}
+		oauthProviders[provider.Name] = provider
+		log.Infof("OAuth provider %s enabled", provider.Name)
+	}
+	return nil
+}
+
+func newOAuthHTTPClient() *http.Client {
+	return &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport), Timeout: 10 * time.Second}
+}
+
+// newGoogleProvider configures Google. Endpoints can be overridden to point at a local fake OIDC provider.
+func newGoogleProvider(config *oauth2.Config) (*OAuthProvider, error) {
+	config.Scopes = []string{"openid", "email", "profile"}
+	config.Endpoint = oauth2.Endpoint{
+		AuthURL:   getEnv("GOOGLE_AUTH_URL", google.Endpoint.AuthURL),
+		TokenURL:  getEnv("GOOGLE_TOKEN_URL", google.Endpoint.TokenURL),
+		AuthStyle: google.Endpoint.AuthStyle,
+	}
+
+	issuers := []string{"https://accounts.google.com", "accounts.google.com"}
+	if issuer := os.Getenv("GOOGLE_ISSUER"); issuer != "" {
+		issuers = []string{issuer}
+	}
+	return &OAuthProvider{
+		Name:      "google",
+		Config:    config,
+		Verifier:  NewOIDCVerifier(issuers, config.ClientID, getEnv("GOOGLE_JWKS_URL", "https://www.googleapis.com/oauth2/v3/certs")),
+		mapClaims: standardClaims,
+	}, nil
+}
+
+// newGitLabProvider configures gitlab.com or a self-managed instance at GITLAB_URL
+func newGitLabProvider(config *oauth2.Config) (*OAuthProvider, error) {
+	baseURL := strings.TrimSuffix(getEnv("GITLAB_URL", "https://gitlab.com"), "/")
+	config.Scopes = []string{"openid", "email", "profile"}
+	config.Endpoint = oauth2.Endpoint{
+		AuthURL:  baseURL + "/oauth/authorize",
+		TokenURL: baseURL + "/oauth/token",
+	}
+	return &OAuthProvider{
+		Name:      "gitlab",
+		Config:    config,
+		Verifier:  NewOIDCVerifier([]string{baseURL}, config.ClientID, baseURL+"/oauth/discovery/keys"),
+		mapClaims: standardClaims,
+	}, nil
+}
+
+// multiTenantMicrosoftTenants are the tenant aliases that accept accounts from any directory
+var multiTenantMicrosoftTenants = []string{"common", "organizations", "consumers"}
+
+// newMicrosoftProvider configures Microsoft Entra ID. MICROSOFT_TENANT_ID is a directory ID
+// or one of the multi-tenant aliases; the issuer always embeds the account's own tenant.
+func newMicrosoftProvider(config *oauth2.Config) (*OAuthProvider, error) {
+	tenant := getEnv("MICROSOFT_TENANT_ID", "common")
+	authority := "https://login.microsoftonline.com/" + tenant
+	config.Scopes = []string{"openid", "email", "profile"}
+	config.Endpoint = oauth2.Endpoint{
+		AuthURL:  authority + "/oauth2/v2.0/authorize",
+		TokenURL: authority + "/oauth2/v2.0/token",
+	}
+
+	verifier := NewOIDCVerifier(nil, config.ClientID, authority+"/discovery/v2.0/keys")
+	multiTenant := false
+	for _, alias := range multiTenantMicrosoftTenants {
+		multiTenant = multiTenant || tenant == alias
+	}
+	verifier.IssuerMatcher = func(claims *IDTokenClaims) bool {
+		if claims.TenantID == "" || (!multiTenant && claims.TenantID != tenant) {
+			return false
+		}
+		return claims.Issuer == "https://login.microsoftonline.com/"+claims.TenantID+"/v2.0"
+	}
+
+	return &OAuthProvider{
+		Name:     "microsoft",
+		Config:   config,
+		Verifier: verifier,
+		// Entra lets tenant admins set arbitrary email values; only trust them when the tenant
+		// owns the domain (the xms_edov optional claim must be enabled on the app registration)
+		mapClaims: func(claims *IDTokenClaims) *OAuthIdentity {
+			identity := standardClaims(claims)
+			identity.EmailVerified = bool(claims.EmailDomainOwnerVerified)
+			if identity.Name == "" {
+				identity.Name = claims.PreferredUsername
+			}
+			return identity
 		},
-		Endpoint: google.Endpoint,
+	}, nil
+}
+
+// newDiscoveredProvider configures any OpenID Connect provider from OIDC_ISSUER_URL's discovery document
+func newDiscoveredProvider(config *oauth2.Config) (*OAuthProvider, error) {
+	issuer := os.Getenv("OIDC_ISSUER_URL")
+	if issuer == "" {
+		return nil, errors.New("OIDC_ISSUER_URL is required")
+	}
+
+	client := newOAuthHTTPClient()
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	discovery, err := DiscoverOIDC(ctx, client, issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	config.Scopes = strings.Fields(getEnv("OIDC_SCOPES", "openid email profile"))
+	config.Endpoint = oauth2.Endpoint{
+		AuthURL:  discovery.AuthorizationEndpoint,
+		TokenURL: discovery.TokenEndpoint,
+	}
+	name := getEnv("OIDC_PROVIDER_NAME", "oidc")
+	if !providerNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("OIDC_PROVIDER_NAME %q must be lowercase letters, digits and dashes", name)
+	}
+	return &OAuthProvider{
+		Name:       name,
+		Config:     config,
+		Verifier:   NewOIDCVerifier([]string{discovery.Issuer}, config.ClientID, discovery.JWKSURI),
+		HTTPClient: client,
+		mapClaims:  standardClaims,
+	}, nil
+}
+
+// standardClaims maps the standard OIDC profile claims; sub is the stable account ID
+func standardClaims(claims *IDTokenClaims) *OAuthIdentity {
+	return &OAuthIdentity{
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+		Name:          claims.Name,
+		AvatarURL:     claims.Picture,
 	}
 }
@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// newGitHubProvider configures github.com or a GitHub Enterprise Server at GITHUB_URL/GITHUB_API_URL.
+// GitHub has no ID token, so the identity comes from its REST API.
+func newGitHubProvider(config *oauth2.Config) (*OAuthProvider, error) {
+	baseURL := strings.TrimSuffix(getEnv("GITHUB_URL", "https://github.com"), "/")
+	apiURL := strings.TrimSuffix(getEnv("GITHUB_API_URL", "https://api.github.com"), "/")
+	config.Scopes = []string{"read:user", "user:email"}
+	config.Endpoint = oauth2.Endpoint{
+		AuthURL:   baseURL + "/login/oauth/authorize",
+		TokenURL:  baseURL + "/login/oauth/access_token",
+		AuthStyle: oauth2.AuthStyleInParams,
+	}
+	return &OAuthProvider{
+		Name:   "github",
+		Config: config,
+		fetchIdentity: func(ctx context.Context, client *http.Client, token *oauth2.Token) (*OAuthIdentity, error) {
+			return fetchGitHubIdentity(ctx, client, apiURL, token)
+		},
+	}, nil
+}
+
+type gitHubUser struct {
+	ID        int64  `json:"id"`
+	Login     string `json:"login"`
+	Name      string `json:"name"`
+	AvatarURL string `json:"avatar_url"`
+}
+
+type gitHubEmail struct {
+	Email    string `json:"email"`
+	Primary  bool   `json:"primary"`
+	Verified bool   `json:"verified"`
+}
+
+// fetchGitHubIdentity maps the numeric user ID to the subject and takes the primary email,
+// since the public profile email is optional and says nothing about verification
+func fetchGitHubIdentity(ctx context.Context, client *http.Client, apiURL string, token *oauth2.Token) (*OAuthIdentity, error) {
+	var user gitHubUser
+	if err := getGitHubJSON(ctx, client, apiURL+"/user", token, &user); err != nil {
+		return nil, err
+	}
+	var emails []gitHubEmail
+	if err := getGitHubJSON(ctx, client, apiURL+"/user/emails", token, &emails); err != nil {
+		return nil, err
+	}
+
+	identity := &OAuthIdentity{
+		Subject:   strconv.FormatInt(user.ID, 10),
+		Name:      user.Name,
+		AvatarURL: user.AvatarURL,
+	}
+	if user.ID == 0 {
+		identity.Subject = ""
+	}
+	if identity.Name == "" {
+		identity.Name = user.Login
+	}
+	for _, email := range emails {
+		if email.Primary {
+			identity.Email = email.Email
+			identity.EmailVerified = email.Verified
+			break
+		}
+	}
+	return identity, nil
+}
+
+func getGitHubJSON(ctx context.Context, client *http.Client, url string, token *oauth2.Token, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	token.SetAuthHeader(req)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GitHub API %s returned %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// OAuthStateCookie is the name of the cookie that binds an OAuth flow to the browser that started it
+const OAuthStateCookie = "oauth_state"
+
+// OAuthStateTTL bounds how long a user may take to complete the provider login
+const OAuthStateTTL = 10 * time.Minute
+
+var ErrInvalidOAuthState = errors.New("invalid or expired OAuth state")
+
+// OAuthState is the signed payload of the OAuth state cookie. The PKCE verifier and OIDC
+// nonce only ever travel between our server and the browser that started the flow.
+type OAuthState struct {
+	Provider     string `json:"p"`
+	State        string `json:"s"`
+	CodeVerifier string `json:"v"`
+	Nonce        string `json:"n"`
+	RedirectURI  string `json:"r,omitempty"`
+	LinkUserID   string `json:"u,omitempty"` // Set when a logged-in user is linking the provider account
+	ExpiresAt    int64  `json:"e"`
+}
+
+// GetOAuthStateSecret retrieves the key used to sign OAuth state cookies
+func GetOAuthStateSecret() (string, error) {
+	secret := os.Getenv("OAUTH_STATE_SECRET")
+	if secret == "" {
+		NewLogger("OAuthState", "GetOAuthStateSecret").Errorf("OAUTH_STATE_SECRET environment variable is not set")
+		return "", errors.New("OAUTH_STATE_SECRET environment variable is not set")
+	}
+	return secret, nil
+}
+
+// NewOAuthState creates a state for provider with random state, PKCE verifier and nonce values and an optional post-login redirect
+func NewOAuthState(provider, redirectURI string) (*OAuthState, error) {
+	state, err := GenerateRandomString(32)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := GenerateRandomString(32)
+	if err != nil {
+		return nil, err
+	}
+	return &OAuthState{
+		Provider:     provider,
+		State:        state,
+		CodeVerifier: oauth2.GenerateVerifier(),
+		Nonce:        nonce,
+		RedirectURI:  redirectURI,
+		ExpiresAt:    time.Now().Add(OAuthStateTTL).Unix(),
+	}, nil
+}
+
+// EncodeOAuthState serializes and signs the state as "<payload>.<hmac>"
+func EncodeOAuthState(state *OAuthState) (string, error) {
+	secret, err := GetOAuthStateSecret()
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(state)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + signOAuthState(secret, encoded), nil
+}
+
+// DecodeOAuthState verifies the signature and expiry of a cookie value and checks it was issued
+// for provider and matches the state echoed back by it
+func DecodeOAuthState(cookieValue, provider, returnedState string) (*OAuthState, error) {
+	secret, err := GetOAuthStateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	encoded, signature, found := strings.Cut(cookieValue, ".")
+	if !found || !hmac.Equal([]byte(signature), []byte(signOAuthState(secret, encoded))) {
+		return nil, ErrInvalidOAuthState
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidOAuthState
+	}
+	var state OAuthState
+	if err := json.Unmarshal(payload, &state); err != nil {
+		return nil, ErrInvalidOAuthState
+	}
+
+	if time.Now().Unix() > state.ExpiresAt || state.Provider != provider {
+		return nil, ErrInvalidOAuthState
+	}
+	if returnedState == "" || subtle.ConstantTimeCompare([]byte(state.State), []byte(returnedState)) != 1 {
+		return nil, ErrInvalidOAuthState
+	}
+	return &state, nil
+}
+
+// IsAllowedRedirectURI reports whether uri exactly matches an entry of OAUTH_ALLOWED_REDIRECT_URIS
+func IsAllowedRedirectURI(uri string) bool {
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" || parsed.Fragment != "" {
+		return false
+	}
+	for _, allowed := range strings.Split(os.Getenv("OAUTH_ALLOWED_REDIRECT_URIS"), ",") {
+		if allowed = strings.TrimSpace(allowed); allowed != "" && allowed == uri {
+			return true
+		}
+	}
+	return false
+}
+
+func signOAuthState(secret, encoded string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
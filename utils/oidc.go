@@ -0,0 +1,252 @@
+package utils
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrInvalidIDToken = errors.New("invalid ID token")
+
+// jwksRefetchInterval limits how often an unknown kid can trigger a JWKS refetch
+const jwksRefetchInterval = time.Minute
+
+// IDTokenClaims are the OpenID Connect claims we read from a provider's ID token
+type IDTokenClaims struct {
+	Email             string       `json:"email"`
+	EmailVerified     FlexibleBool `json:"email_verified"`
+	Name              string       `json:"name"`
+	PreferredUsername string       `json:"preferred_username,omitempty"`
+	Picture           string       `json:"picture,omitempty"`
+	Nonce             string       `json:"nonce"`
+	AuthorizedParty   string       `json:"azp,omitempty"`
+	// Microsoft Entra only: tenant of the account and whether the tenant owns the email domain
+	TenantID                 string       `json:"tid,omitempty"`
+	EmailDomainOwnerVerified FlexibleBool `json:"xms_edov,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// FlexibleBool decodes both JSON booleans and the "true"/"false" strings some providers send
+type FlexibleBool bool
+
+func (b *FlexibleBool) UnmarshalJSON(data []byte) error {
+	switch string(data) {
+	case "true", `"true"`:
+		*b = true
+	case "false", `"false"`, "null":
+		*b = false
+	default:
+		return fmt.Errorf("invalid boolean %s", data)
+	}
+	return nil
+}
+
+// OIDCVerifier verifies ID tokens issued by one OpenID Connect provider.
+// Provider keys are fetched from JWKSURL and cached for CacheTTL.
+type OIDCVerifier struct {
+	Issuers []string // Accepted iss values; Google uses two spellings
+	// IssuerMatcher replaces the Issuers check for multi-tenant providers whose iss embeds the tenant
+	IssuerMatcher func(claims *IDTokenClaims) bool
+	ClientID      string
+	JWKSURL       string
+	HTTPClient    *http.Client
+	CacheTTL      time.Duration
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// NewOIDCVerifier creates a verifier using an instrumented HTTP client and a one hour key cache
+func NewOIDCVerifier(issuers []string, clientID, jwksURL string) *OIDCVerifier {
+	return &OIDCVerifier{
+		Issuers:    issuers,
+		ClientID:   clientID,
+		JWKSURL:    jwksURL,
+		HTTPClient: newOAuthHTTPClient(),
+		CacheTTL:   time.Hour,
+	}
+}
+
+// Verify checks the signature, iss, aud, exp and nonce of a raw ID token
+func (v *OIDCVerifier) Verify(ctx context.Context, rawIDToken, nonce string) (*IDTokenClaims, error) {
+	claims := &IDTokenClaims{}
+	_, err := jwt.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return v.publicKey(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "ES256"}),
+		jwt.WithAudience(v.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	if v.IssuerMatcher != nil {
+		if !v.IssuerMatcher(claims) {
+			return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidIDToken, claims.Issuer)
+		}
+	} else if !slices.Contains(v.Issuers, claims.Issuer) {
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidIDToken, claims.Issuer)
+	}
+	// With several audiences the token must have been issued to us
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != v.ClientID {
+		return nil, fmt.Errorf("%w: unexpected authorized party %q", ErrInvalidIDToken, claims.AuthorizedParty)
+	}
+	if nonce == "" || subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	return claims, nil
+}
+
+// OIDCDiscovery is the subset of an OpenID Provider's metadata we need
+type OIDCDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// DiscoverOIDC fetches <issuer>/.well-known/openid-configuration and checks it describes that issuer
+func DiscoverOIDC(ctx context.Context, client *http.Client, issuer string) (*OIDCDiscovery, error) {
+	issuer = strings.TrimSuffix(issuer, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("discovery endpoint returned %s", resp.Status)
+	}
+
+	var discovery OIDCDiscovery
+	if err := json.NewDecoder(resp.Body).Decode(&discovery); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("discovery document is for issuer %q, expected %q", discovery.Issuer, issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("discovery document is missing required endpoints")
+	}
+	return &discovery, nil
+}
+
+// publicKey returns the cached key for kid, refreshing the JWKS when it is stale or the kid is unknown
+func (v *OIDCVerifier) publicKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	key, ok := v.keys[kid]
+	stale := time.Since(v.fetchedAt) > v.CacheTTL
+	if ok && !stale {
+		return key, nil
+	}
+	if !stale && time.Since(v.fetchedAt) < jwksRefetchInterval {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+
+	keys, err := v.fetchKeys(ctx)
+	if err != nil {
+		if ok {
+			// Keep serving the cached key if the provider is briefly unreachable
+			NewLogger("OIDCVerifier", "publicKey").WithContext(ctx).Warnf("JWKS refresh from %s failed, using cached key: %v", v.JWKSURL, err)
+			return key, nil
+		}
+		return nil, err
+	}
+	v.keys = keys
+	v.fetchedAt = time.Now()
+
+	if key, ok := v.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key %q", kid)
+}
+
+func (v *OIDCVerifier) fetchKeys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.JWKSURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := v.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("JWKS endpoint returned %s", resp.Status)
+	}
+
+	var jwks JWKS
+	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.PublicKey()
+		if err != nil {
+			NewLogger("OIDCVerifier", "fetchKeys").WithContext(ctx).Warnf("Skipping key %s: %v", jwk.Kid, err)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys, nil
+}
+
+// PublicKey decodes an RSA or P-256 JWK into a public key
+func (jwk JWK) PublicKey() (crypto.PublicKey, error) {
+	decode := base64.RawURLEncoding.DecodeString
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decode(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if jwk.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %s", jwk.Crv)
+		}
+		x, err := decode(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", jwk.Kty)
+	}
+}
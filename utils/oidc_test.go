@@ -0,0 +1,309 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testOIDCClientID = "test-client"
+
+// fakeIssuer is an OpenID Provider serving discovery, JWKS and a token endpoint that enforces PKCE
+type fakeIssuer struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *SigningKey
+
+	mu sync.Mutex
+	// codes maps issued authorization codes to their PKCE challenge and the ID token to return
+	codes map[string]fakeAuthorization
+}
+
+type fakeAuthorization struct {
+	challenge string
+	idToken   string
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	t.Helper()
+	key, err := GenerateSigningKey("ES256")
+	if err != nil {
+		t.Fatalf("GenerateSigningKey: %v", err)
+	}
+	issuer := &fakeIssuer{t: t, key: key, codes: map[string]fakeAuthorization{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(OIDCDiscovery{
+			Issuer:                issuer.URL(),
+			AuthorizationEndpoint: issuer.URL() + "/authorize",
+			TokenEndpoint:         issuer.URL() + "/token",
+			JWKSURI:               issuer.URL() + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(JWKS{Keys: []JWK{key.JWK()}})
+	})
+	mux.HandleFunc("POST /token", issuer.handleToken)
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+	return issuer
+}
+
+func (f *fakeIssuer) URL() string {
+	return f.server.URL
+}
+
+// authorize plays the provider login: it records the PKCE challenge of the request and issues a code
+func (f *fakeIssuer) authorize(authURL, idToken string) string {
+	f.t.Helper()
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		f.t.Fatalf("parse auth URL: %v", err)
+	}
+	query := parsed.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		f.t.Fatalf("auth URL %s has no S256 PKCE challenge", authURL)
+	}
+
+	code, err := GenerateRandomString(16)
+	if err != nil {
+		f.t.Fatalf("GenerateRandomString: %v", err)
+	}
+	f.mu.Lock()
+	f.codes[code] = fakeAuthorization{challenge: query.Get("code_challenge"), idToken: idToken}
+	f.mu.Unlock()
+	return code
+}
+
+func (f *fakeIssuer) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	authorization, ok := f.codes[r.PostForm.Get("code")]
+	delete(f.codes, r.PostForm.Get("code"))
+	f.mu.Unlock()
+
+	verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(verifier[:]) != authorization.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"access_token": "access-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     authorization.idToken,
+	})
+}
+
+// idToken signs claims with the issuer key
+func (f *fakeIssuer) idToken(claims *IDTokenClaims) string {
+	f.t.Helper()
+	token := jwt.NewWithClaims(f.key.Method, claims)
+	token.Header["kid"] = f.key.ID
+	signed, err := token.SignedString(f.key.PrivateKey)
+	if err != nil {
+		f.t.Fatalf("sign ID token: %v", err)
+	}
+	return signed
+}
+
+// claims are valid ID token claims for the test client, to be altered by each case
+func (f *fakeIssuer) claims(nonce string) *IDTokenClaims {
+	now := time.Now()
+	return &IDTokenClaims{
+		Email:         "Alice@Example.com",
+		EmailVerified: true,
+		Name:          "Alice",
+		Nonce:         nonce,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    f.URL(),
+			Subject:   "alice-subject",
+			Audience:  jwt.ClaimStrings{testOIDCClientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		},
+	}
+}
+
+// discoveredProvider registers the fake issuer as the generic OIDC provider
+func discoveredProvider(t *testing.T, issuer *fakeIssuer) *OAuthProvider {
+	t.Helper()
+	for _, prefix := range []string{"GOOGLE", "GITHUB", "MICROSOFT", "GITLAB"} {
+		t.Setenv(prefix+"_CLIENT_ID", "")
+	}
+	t.Setenv("OIDC_CLIENT_ID", testOIDCClientID)
+	t.Setenv("OIDC_CLIENT_SECRET", "test-secret")
+	t.Setenv("OIDC_REDIRECT_URL", "http://localhost:8080/api/v1/auth/oidc/callback")
+	t.Setenv("OIDC_ISSUER_URL", issuer.URL())
+	t.Setenv("OIDC_PROVIDER_NAME", "oidc")
+	t.Cleanup(func() { oauthProviders = map[string]*OAuthProvider{} })
+
+	if err := InitOAuthConfig(); err != nil {
+		t.Fatalf("InitOAuthConfig: %v", err)
+	}
+	provider, err := GetOAuthProvider("oidc")
+	if err != nil {
+		t.Fatalf("GetOAuthProvider: %v", err)
+	}
+	return provider
+}
+
+func TestDiscoveredProviderLogin(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	provider := discoveredProvider(t, issuer)
+
+	state, err := NewOAuthState("oidc", "")
+	if err != nil {
+		t.Fatalf("NewOAuthState: %v", err)
+	}
+	authURL := provider.AuthCodeURL(state)
+	parsed, _ := url.Parse(authURL)
+	if got := parsed.Query().Get("nonce"); got != state.Nonce {
+		t.Errorf("auth URL nonce = %q, want the state nonce", got)
+	}
+	if got := parsed.Query().Get("state"); got != state.State {
+		t.Errorf("auth URL state = %q, want the state value", got)
+	}
+
+	code := issuer.authorize(authURL, issuer.idToken(issuer.claims(state.Nonce)))
+	token, err := provider.Exchange(context.Background(), code, state.CodeVerifier)
+	if err != nil {
+		t.Fatalf("Exchange with the PKCE verifier: %v", err)
+	}
+	identity, err := provider.Identity(context.Background(), token, state.Nonce)
+	if err != nil {
+		t.Fatalf("Identity: %v", err)
+	}
+	want := OAuthIdentity{Provider: "oidc", Subject: "alice-subject", Email: "Alice@Example.com", EmailVerified: true, Name: "Alice"}
+	if *identity != want {
+		t.Errorf("identity = %+v, want %+v", *identity, want)
+	}
+}
+
+func TestDiscoveredProviderRejectsWrongPKCEVerifier(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	provider := discoveredProvider(t, issuer)
+
+	state, err := NewOAuthState("oidc", "")
+	if err != nil {
+		t.Fatalf("NewOAuthState: %v", err)
+	}
+	other, err := NewOAuthState("oidc", "")
+	if err != nil {
+		t.Fatalf("NewOAuthState: %v", err)
+	}
+	code := issuer.authorize(provider.AuthCodeURL(state), issuer.idToken(issuer.claims(state.Nonce)))
+	if _, err := provider.Exchange(context.Background(), code, other.CodeVerifier); err == nil {
+		t.Fatal("Exchange with another flow's PKCE verifier succeeded")
+	}
+}
+
+func TestOIDCVerifierRejectsInvalidIDTokens(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	verifier := NewOIDCVerifier([]string{issuer.URL()}, testOIDCClientID, issuer.URL()+"/jwks")
+	const nonce = "expected-nonce"
+
+	tests := []struct {
+		name   string
+		modify func(claims *IDTokenClaims)
+		nonce  string
+		valid  bool
+	}{
+		{name: "valid", modify: func(claims *IDTokenClaims) {}, nonce: nonce, valid: true},
+		{name: "wrong nonce", modify: func(claims *IDTokenClaims) { claims.Nonce = "other-nonce" }, nonce: nonce},
+		{name: "missing nonce", modify: func(claims *IDTokenClaims) { claims.Nonce = "" }, nonce: nonce},
+		{name: "no expected nonce", modify: func(claims *IDTokenClaims) { claims.Nonce = "" }, nonce: ""},
+		{name: "wrong audience", modify: func(claims *IDTokenClaims) { claims.Audience = jwt.ClaimStrings{"other-client"} }, nonce: nonce},
+		{name: "wrong issuer", modify: func(claims *IDTokenClaims) { claims.Issuer = "https://evil.example.com" }, nonce: nonce},
+		{name: "expired", modify: func(claims *IDTokenClaims) { claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute)) }, nonce: nonce},
+		{
+			name: "several audiences without azp",
+			modify: func(claims *IDTokenClaims) {
+				claims.Audience = jwt.ClaimStrings{testOIDCClientID, "other-client"}
+			},
+			nonce: nonce,
+		},
+		{
+			name: "several audiences with another azp",
+			modify: func(claims *IDTokenClaims) {
+				claims.Audience = jwt.ClaimStrings{testOIDCClientID, "other-client"}
+				claims.AuthorizedParty = "other-client"
+			},
+			nonce: nonce,
+		},
+		{
+			name: "several audiences with our azp",
+			modify: func(claims *IDTokenClaims) {
+				claims.Audience = jwt.ClaimStrings{testOIDCClientID, "other-client"}
+				claims.AuthorizedParty = testOIDCClientID
+			},
+			nonce: nonce,
+			valid: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := issuer.claims(nonce)
+			tt.modify(claims)
+			_, err := verifier.Verify(context.Background(), issuer.idToken(claims), tt.nonce)
+			if tt.valid && err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidIDToken) {
+				t.Fatalf("Verify err = %v, want ErrInvalidIDToken", err)
+			}
+		})
+	}
+}
+
+func TestOIDCVerifierRejectsTokensSignedByAnotherKey(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	verifier := NewOIDCVerifier([]string{issuer.URL()}, testOIDCClientID, issuer.URL()+"/jwks")
+
+	// Same kid, different key: the signature must not verify
+	forger := newFakeIssuer(t)
+	forger.key.ID = issuer.key.ID
+	claims := issuer.claims("nonce")
+	if _, err := verifier.Verify(context.Background(), forger.idToken(claims), "nonce"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("Verify err = %v, want ErrInvalidIDToken", err)
+	}
+}
+
+func TestDiscoverOIDCRejectsMismatchedIssuer(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	if _, err := DiscoverOIDC(context.Background(), http.DefaultClient, issuer.URL()+"/"); err != nil {
+		t.Fatalf("DiscoverOIDC with a trailing slash: %v", err)
+	}
+
+	// A document served from one URL that claims to describe another issuer
+	impostor := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(OIDCDiscovery{
+			Issuer:                issuer.URL(),
+			AuthorizationEndpoint: issuer.URL() + "/authorize",
+			TokenEndpoint:         issuer.URL() + "/token",
+			JWKSURI:               issuer.URL() + "/jwks",
+		})
+	}))
+	defer impostor.Close()
+	if _, err := DiscoverOIDC(context.Background(), http.DefaultClient, impostor.URL); err == nil {
+		t.Fatal("DiscoverOIDC accepted a document for another issuer")
+	}
+}
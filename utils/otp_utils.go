@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+)
+
+// GetOTPSecret retrieves the server secret used to hash OTP codes
+func GetOTPSecret() (string, error) {
+	secret := os.Getenv("OTP_HMAC_SECRET")
+	if secret == "" {
+		NewLogger("OTPUtils", "GetOTPSecret").Errorf("OTP_HMAC_SECRET environment variable is not set")
+		return "", errors.New("OTP_HMAC_SECRET environment variable is not set")
+	}
+	return secret, nil
+}
+
+// HashOTP returns the HMAC-SHA256 of an OTP code, bound to the email and purpose it was issued for
+func HashOTP(email, purpose, code string) (string, error) {
+	secret, err := GetOTPSecret()
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(purpose + "\x00" + email + "\x00" + code))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// VerifyOTPHash compares a code against a stored hash in constant time
+func VerifyOTPHash(hash, email, purpose, code string) bool {
+	expected, err := HashOTP(email, purpose, code)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal([]byte(expected), []byte(hash))
+}
@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"strings"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+var relyingParty *webauthn.WebAuthn
+
+// InitWebAuthn configures passkeys from WEBAUTHN_RP_ID, WEBAUTHN_RP_DISPLAY_NAME and the comma-separated
+// WEBAUTHN_RP_ORIGINS. Passkeys stay disabled when WEBAUTHN_RP_ID is unset.
+func InitWebAuthn() error {
+	log := NewLogger("WebAuthnConfig", "InitWebAuthn")
+	relyingParty = nil
+
+	rpID := strings.TrimSpace(getEnv("WEBAUTHN_RP_ID", ""))
+	if rpID == "" {
+		log.Info("WebAuthn disabled: WEBAUTHN_RP_ID is not set")
+		return nil
+	}
+
+	var origins []string
+	for _, origin := range strings.Split(getEnv("WEBAUTHN_RP_ORIGINS", "https://"+rpID), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+
+	rp, err := webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: getEnv("WEBAUTHN_RP_DISPLAY_NAME", TOTPIssuer()),
+		RPOrigins:     origins,
+	})
+	if err != nil {
+		return err
+	}
+	relyingParty = rp
+	log.Infof("WebAuthn enabled for relying party %s", rpID)
+	return nil
+}
+
+// WebAuthnRelyingParty returns the configured relying party, or nil when passkeys are disabled
+func WebAuthnRelyingParty() *webauthn.WebAuthn {
+	return relyingParty
+}